@@ -0,0 +1,416 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package dup
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// A Location is the place of a line in the input.
+type Location struct {
+	File string // "-" for the standard input
+	Line int    // from 1
+}
+
+func (l Location) String() string { return fmt.Sprintf("%s:%d", l.File, l.Line) }
+
+// A Dup is a distinct line of the input, with the number of times it
+// occurs and where.
+type Dup struct {
+	Line      string
+	Count     int
+	Files     []FileCount // the files in which it occurs, in input order
+	Locations []Location  // the first occurrences, in input order
+}
+
+// A FileCount is the number of times a line occurs in a file.
+type FileCount struct {
+	File  string
+	Count int
+}
+
+// A Counter counts the occurrences of lines, and remembers where the
+// first of them are. It holds the distinct lines in memory up to a
+// limit, beyond which it writes them, sorted, to a temporary file, and
+// starts afresh; at the end it merges these runs. It can so count
+// inputs far larger than memory, in time proportional to their size
+// times the logarithm of the number of runs.
+//
+// A Counter must be closed, to remove its temporary files.
+type Counter struct {
+	Limit     int    // bytes of lines to hold in memory, or 0 for no limit
+	Locations int    // number of locations to remember for each line
+	Dir       string // directory for temporary files, or "" for the default
+
+	lines map[string]*Dup
+	size  int        // bytes used by lines, roughly
+	runs  []*os.File // sorted runs, in input order
+	files []string   // the files counted, in input order
+}
+
+// Memory used by a distinct line, beyond its bytes, and by a location
+// or a file count of one.
+const (
+	dupSize      = 120
+	locationSize = 24
+)
+
+// fanIn is the most runs merged at once, which bounds the open files.
+const fanIn = 64
+
+// Add counts one occurrence of line, at loc.
+func (c *Counter) Add(line string, loc Location) error {
+	if c.lines == nil {
+		c.lines = make(map[string]*Dup)
+	}
+	d := c.lines[line]
+	if d == nil {
+		d = &Dup{Line: line}
+		c.lines[line] = d
+		c.size += len(line) + dupSize
+	}
+	if n := len(c.files); n == 0 || c.files[n-1] != loc.File {
+		c.files = append(c.files, loc.File)
+	}
+	d.Count++
+	if n := len(d.Files); n > 0 && d.Files[n-1].File == loc.File {
+		d.Files[n-1].Count++
+	} else {
+		d.Files = append(d.Files, FileCount{loc.File, 1})
+		c.size += locationSize
+	}
+	if len(d.Locations) < c.Locations {
+		d.Locations = append(d.Locations, loc)
+		c.size += locationSize
+	}
+	if c.Limit > 0 && c.size > c.Limit {
+		return c.spill()
+	}
+	return nil
+}
+
+// AddFile counts the lines read from r, which is the file of the given
+// name, each normalized by n.
+func (c *Counter) AddFile(name string, r io.Reader, n *Normalizer) error {
+	input := bufio.NewScanner(r)
+	input.Buffer(nil, 1<<20)
+	for i := 1; input.Scan(); i++ {
+		if err := c.Add(n.Normalize(input.Text()), Location{name, i}); err != nil {
+			return err
+		}
+	}
+	if err := input.Err(); err != nil {
+		return fmt.Errorf("reading %s: %v", name, err)
+	}
+	return nil
+}
+
+// sorted returns the lines in memory in lexical order.
+func (c *Counter) sorted() []*Dup {
+	dups := make([]*Dup, 0, len(c.lines))
+	for _, d := range c.lines {
+		dups = append(dups, d)
+	}
+	sort.Slice(dups, func(i, j int) bool { return dups[i].Line < dups[j].Line })
+	return dups
+}
+
+// spill writes the lines in memory to a new run.
+func (c *Counter) spill() error {
+	f, err := ioutil.TempFile(c.Dir, "dup")
+	if err != nil {
+		return err
+	}
+	c.runs = append(c.runs, f)
+	w := newRunWriter(f)
+	for _, d := range c.sorted() {
+		w.write(d)
+	}
+	if err := w.flush(); err != nil {
+		return fmt.Errorf("writing %s: %v", f.Name(), err)
+	}
+	c.lines = nil
+	c.size = 0
+	return nil
+}
+
+// Each calls f for each distinct line counted, in lexical order, and
+// stops at the first error.
+func (c *Counter) Each(f func(d *Dup) error) error {
+	if len(c.runs) == 0 {
+		for _, d := range c.sorted() {
+			if err := f(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(c.lines) > 0 {
+		if err := c.spill(); err != nil {
+			return err
+		}
+	}
+	// Merge the runs in groups until few enough remain to merge at once.
+	// Each group is replaced by its merge, so the runs stay in input
+	// order, as do the locations of each line.
+	for len(c.runs) > fanIn {
+		out, err := ioutil.TempFile(c.Dir, "dup")
+		if err != nil {
+			return err
+		}
+		w := newRunWriter(out)
+		err = c.merge(c.runs[:fanIn], func(d *Dup) error {
+			w.write(d)
+			return nil
+		})
+		if err == nil {
+			err = w.flush()
+		}
+		for _, f := range c.runs[:fanIn] {
+			remove(f)
+		}
+		c.runs = append([]*os.File{out}, c.runs[fanIn:]...)
+		if err != nil {
+			return err
+		}
+	}
+	return c.merge(c.runs, f)
+}
+
+// merge calls f for each distinct line in runs, in lexical order, with
+// the counts and locations of the line in all the runs combined.
+func (c *Counter) merge(runs []*os.File, f func(d *Dup) error) error {
+	var h runHeap
+	for i, run := range runs {
+		if _, err := run.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r := &runReader{in: bufio.NewReader(run), name: run.Name(), order: i}
+		if r.next() {
+			h = append(h, r)
+		} else if r.err != nil {
+			return r.err
+		}
+	}
+	heap.Init(&h)
+	for len(h) > 0 {
+		d := h[0].dup
+		// Each run holds a line at most once, and the heap yields equal
+		// lines in run order.
+		for {
+			r := h[0]
+			if r.next() {
+				heap.Fix(&h, 0)
+			} else if r.err != nil {
+				return r.err
+			} else {
+				heap.Pop(&h)
+			}
+			if len(h) == 0 || h[0].dup.Line != d.Line {
+				break
+			}
+			d.Count += h[0].dup.Count
+			d.Files = appendFiles(d.Files, h[0].dup.Files)
+			d.Locations = append(d.Locations, h[0].dup.Locations...)
+		}
+		if len(d.Locations) > c.Locations {
+			d.Locations = d.Locations[:c.Locations]
+		}
+		if err := f(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendFiles appends the file counts of more, which follow those of
+// files in input order, to files, and adds the counts of a file split
+// between them.
+func appendFiles(files, more []FileCount) []FileCount {
+	if n := len(files); n > 0 && len(more) > 0 && files[n-1].File == more[0].File {
+		files[n-1].Count += more[0].Count
+		more = more[1:]
+	}
+	return append(files, more...)
+}
+
+// Close removes the temporary files of c.
+func (c *Counter) Close() error {
+	var first error
+	for _, f := range c.runs {
+		if err := remove(f); err != nil && first == nil {
+			first = err
+		}
+	}
+	c.runs = nil
+	c.lines = nil
+	return first
+}
+
+// remove closes and removes the temporary file f.
+func remove(f *os.File) error {
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// A run is a sequence of Dups in lexical order of line, each written
+// as the length of the line, the line, the count, the number of file
+// counts, the file name and count of each, the number of locations,
+// and the file name and line number of each, with the numbers as
+// unsigned varints. A file name is written only where it differs from
+// the one before, and is otherwise empty.
+
+// A runWriter writes a run.
+type runWriter struct {
+	out  *bufio.Writer
+	buf  [binary.MaxVarintLen64]byte
+	file string // of the last location written
+}
+
+func newRunWriter(w io.Writer) *runWriter {
+	return &runWriter{out: bufio.NewWriter(w)}
+}
+
+func (w *runWriter) write(d *Dup) {
+	w.string(d.Line)
+	w.uint(uint64(d.Count))
+	w.uint(uint64(len(d.Files)))
+	for _, f := range d.Files {
+		w.fileName(f.File)
+		w.uint(uint64(f.Count))
+	}
+	w.uint(uint64(len(d.Locations)))
+	for _, loc := range d.Locations {
+		w.fileName(loc.File)
+		w.uint(uint64(loc.Line))
+	}
+}
+
+func (w *runWriter) fileName(name string) {
+	if name == w.file {
+		w.string("")
+	} else {
+		w.string(name)
+		w.file = name
+	}
+}
+
+func (w *runWriter) uint(x uint64) {
+	n := binary.PutUvarint(w.buf[:], x)
+	w.out.Write(w.buf[:n])
+}
+
+func (w *runWriter) string(s string) {
+	w.uint(uint64(len(s)))
+	w.out.WriteString(s)
+}
+
+// flush reports any error in writing the run.
+func (w *runWriter) flush() error { return w.out.Flush() }
+
+// A runReader reads a run.
+type runReader struct {
+	in    *bufio.Reader
+	name  string // of the file of the run
+	order int    // of the run among those merged
+	dup   *Dup   // the last read
+	file  string // of the last location read
+	err   error
+}
+
+// next reads the next Dup of the run, and reports whether there was
+// one. At the end of the run, or on an error, which it records in
+// r.err, it returns false.
+func (r *runReader) next() bool {
+	line, err := r.string()
+	if err == io.EOF {
+		return false
+	}
+	d := &Dup{Line: line}
+	var count, n uint64
+	if err == nil {
+		count, err = binary.ReadUvarint(r.in)
+	}
+	if err == nil {
+		n, err = binary.ReadUvarint(r.in)
+	}
+	for i := uint64(0); err == nil && i < n; i++ {
+		var f FileCount
+		f.File, f.Count, err = r.fileNumber()
+		d.Files = append(d.Files, f)
+	}
+	if err == nil {
+		n, err = binary.ReadUvarint(r.in)
+	}
+	for i := uint64(0); err == nil && i < n; i++ {
+		var loc Location
+		loc.File, loc.Line, err = r.fileNumber()
+		d.Locations = append(d.Locations, loc)
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = fmt.Errorf("reading %s: %v", r.name, err)
+		return false
+	}
+	d.Count = int(count)
+	r.dup = d
+	return true
+}
+
+// fileNumber reads a file name and a number.
+func (r *runReader) fileNumber() (string, int, error) {
+	file, err := r.string()
+	if err != nil {
+		return "", 0, err
+	}
+	if file != "" {
+		r.file = file
+	}
+	n, err := binary.ReadUvarint(r.in)
+	return r.file, int(n), err
+}
+
+func (r *runReader) string() (string, error) {
+	n, err := binary.ReadUvarint(r.in)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r.in, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// A runHeap is a heap of runReaders, ordered by their last line read,
+// and then by their order, for container/heap.
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].dup.Line != h[j].dup.Line {
+		return h[i].dup.Line < h[j].dup.Line
+	}
+	return h[i].order < h[j].order
+}
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,113 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package dup
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCounter checks that a Counter that spills to many runs, which it
+// must merge in more than one pass, counts as one that holds all lines
+// in memory, and as a map.
+func TestCounter(t *testing.T) {
+	const locations = 3
+	counts := make(map[string]int)
+	where := make(map[string][]Location)
+	mem := &Counter{Locations: locations}
+	dir := t.TempDir()
+	disk := &Counter{Limit: 2000, Locations: locations, Dir: dir}
+
+	rng := rand.New(rand.NewSource(1))
+	for _, file := range []string{"a", "b", "c"} {
+		for i := 1; i <= 5000; i++ {
+			line := fmt.Sprintf("line %d", rng.Intn(1000))
+			counts[line]++
+			if len(where[line]) < locations {
+				where[line] = append(where[line], Location{file, i})
+			}
+			for _, c := range []*Counter{mem, disk} {
+				if err := c.Add(line, Location{file, i}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	if len(mem.runs) != 0 || len(disk.runs) <= fanIn {
+		t.Fatalf("got %d and %d runs, want 0 and more than %d", len(mem.runs), len(disk.runs), fanIn)
+	}
+
+	each := func(c *Counter) []Dup {
+		var dups []Dup
+		if err := c.Each(func(d *Dup) error {
+			dups = append(dups, *d)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return dups
+	}
+	got, want := each(disk), each(mem)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("spilling Counter differs from one in memory")
+	}
+	if len(want) != len(counts) {
+		t.Errorf("got %d lines, want %d", len(want), len(counts))
+	}
+	for i, d := range want {
+		if i > 0 && want[i-1].Line >= d.Line {
+			t.Errorf("%q after %q", d.Line, want[i-1].Line)
+		}
+		if d.Count != counts[d.Line] || !reflect.DeepEqual(d.Locations, where[d.Line]) {
+			t.Errorf("%q: got %d at %v, want %d at %v", d.Line, d.Count, d.Locations, counts[d.Line], where[d.Line])
+		}
+	}
+
+	if err := disk.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Close left %d temporary files", len(files))
+	}
+}
+
+func TestWrite(t *testing.T) {
+	c := &Counter{Limit: 1, Locations: 2, Dir: t.TempDir()}
+	defer c.Close()
+	n := &Normalizer{Trim: true}
+	if err := c.AddFile("x", strings.NewReader("b\na\n b\nc\nb \nerror 1\n"), n); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddFile("y", strings.NewReader("c\nc\nerror 2\n"), n); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		opts Options
+		want string
+	}{
+		{Options{Min: 2}, "3\tb\n\tx:1\n\tx:3\n3\tc\n\tx:4\n\ty:1\n"},
+		{Options{Min: 1, Sort: "count"}, "3\tb\n\tx:1\n\tx:3\n3\tc\n\tx:4\n\ty:1\n" +
+			"1\ta\n\tx:2\n1\terror 1\n\tx:6\n1\terror 2\n\ty:3\n"},
+		{Options{Min: 3, Format: "json"}, `{"line":"b","count":3,"files":{"x":3},"locations":["x:1","x:3"]}
+{"line":"c","count":3,"files":{"x":1,"y":2},"locations":["x:4","y:1"]}
+`},
+		{Options{Min: 3, Format: "csv", Sort: "line"}, "line,count,files,locations\nb,3,x=3,x:1;x:3\nc,3,x=1;y=2,x:4;y:1\n"},
+		// The near duplicates "error 1" and "error 2" are merged.
+		{Options{Min: 2, Near: 0.5, Shingle: 2, Format: "csv", Sort: "count"},
+			"line,count,files,locations\nb,3,x=3,x:1;x:3\nc,3,x=1;y=2,x:4;y:1\nerror 1,2,x=1;y=1,x:6;y:3\n"},
+	} {
+		var buf bytes.Buffer
+		if err := test.opts.Write(&buf, c); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%+v: Write wrote %q, want %q", test.opts, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package dup
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// Options are the options of the dup programs for matching lines.
+type Options struct {
+	Normalizer
+	Near    float64 // least similarity of near duplicates, or 0 for exact matching
+	Shingle int     // length in runes of the shingles compared for Near
+	Memory  int     // megabytes of lines to hold in memory, or 0 for no limit
+	Where   int     // number of locations to report for each line
+	Format  string  // of the output: "text", "json" or "csv"
+	Sort    string  // the order of the output: by "count", by "line", or "" for either
+	Min     int     // least count of the lines output
+}
+
+// AddFlags defines flags in fs that set the fields of o.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Trim, "trim", false, "remove leading and trailing white space")
+	fs.BoolVar(&o.Collapse, "collapse", false, "replace each run of white space by one space")
+	fs.BoolVar(&o.Fold, "fold", false, "fold case")
+	fs.BoolVar(&o.NFC, "nfc", false, "put lines in Unicode normalization form C")
+	fs.Var((*maskFlag)(&o.Masks), "mask", "replace text matched by a regular expression, or one of "+
+		strings.Join(MaskNames(), ", ")+", by a placeholder such as <timestamp>; may be repeated")
+	fs.Float64Var(&o.Near, "near", 0, "count lines whose similarity is at least this, from 0 to 1, as duplicates")
+	fs.IntVar(&o.Shingle, "shingle", 5, "compare lines for -near by their substrings of this many characters")
+	fs.IntVar(&o.Memory, "mem", 0, "hold at most this many megabytes of lines in memory, and sort the rest in temporary files")
+	fs.IntVar(&o.Where, "where", 0, "print the file and line number of the first `N` occurrences of each line")
+	fs.StringVar(&o.Format, "format", "text", "print lines as "+strings.Join(Formats, ", ")+
+		"; json and csv give the count of each line in each file")
+	fs.StringVar(&o.Sort, "sort", "", "sort lines by `count`, most first, or by line")
+	fs.IntVar(&o.Min, "min", 2, "print only lines that occur at least `N` times")
+}
+
+// Check reports whether the options set by flags are valid.
+func (o *Options) Check() error {
+	if o.Near < 0 || o.Near > 1 {
+		return fmt.Errorf("-near %g is not between 0 and 1", o.Near)
+	}
+	if o.Shingle < 1 {
+		return fmt.Errorf("-shingle %d is not positive", o.Shingle)
+	}
+	if o.Memory < 0 {
+		return fmt.Errorf("-mem %d is negative", o.Memory)
+	}
+	if o.Where < 0 {
+		return fmt.Errorf("-where %d is negative", o.Where)
+	}
+	if o.Near > 0 && o.Memory > 0 {
+		return fmt.Errorf("-near compares all lines in memory, so cannot be used with -mem")
+	}
+	if o.Format != "" && !contains(Formats, o.Format) {
+		return fmt.Errorf("-format %q is not one of %s", o.Format, strings.Join(Formats, ", "))
+	}
+	if o.Sort != "" && o.Sort != "count" && o.Sort != "line" {
+		return fmt.Errorf("-sort %q is neither count nor line", o.Sort)
+	}
+	return nil
+}
+
+// NewCounter returns a Counter with the limits set by o, to count lines
+// for Write, or nil if o needs none: if it asks for the text of lines
+// that occur more than once, which a map can count, and no more.
+func (o *Options) NewCounter() *Counter {
+	if o.Memory == 0 && o.Where == 0 && (o.Format == "" || o.Format == "text") && o.Sort == "" && o.Min == 2 {
+		return nil
+	}
+	return &Counter{Limit: o.Memory << 20, Locations: o.Where}
+}
+
+// Merge returns counts, with the counts of near duplicates merged, if
+// o asks for them, as by the function Merge.
+func (o *Options) Merge(counts map[string]int) map[string]int {
+	if o.Near == 0 {
+		return counts
+	}
+	return Merge(counts, o.Near, o.Shingle)
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// A maskFlag is a flag.Value that appends to a list of masks.
+type maskFlag []Mask
+
+func (f *maskFlag) String() string {
+	var names []string
+	for _, m := range *f {
+		names = append(names, m.Re.String())
+	}
+	return strings.Join(names, " ")
+}
+
+func (f *maskFlag) Set(s string) error {
+	m, err := ParseMask(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, m)
+	return nil
+}
@@ -0,0 +1,216 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package dup
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// A Cluster is a set of distinct lines that are nearly the same.
+type Cluster struct {
+	Lines []string // the most frequent first, then in lexical order
+	Count int      // total occurrences of Lines
+}
+
+// numHashes is the length of a MinHash signature. The similarity
+// estimated from signatures of this length has a standard error of
+// at most 1/(2√numHashes), about 0.04.
+const numHashes = 128
+
+// A signature is the MinHash of a set of shingles: for each of
+// numHashes hash functions, the least hash of any shingle. The
+// fraction of the hash functions for which the signatures of two sets
+// agree estimates the Jaccard similarity of the sets: the size of
+// their intersection over that of their union.
+type signature [numHashes]uint64
+
+// seeds derive the hash functions of a signature from a hash of each
+// shingle. They are fixed, so that the clusters are reproducible.
+var seeds = func() (seeds [numHashes]uint64) {
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range seeds {
+		x = mix(x)
+		seeds[i] = x
+	}
+	return seeds
+}()
+
+// mix is the finalizer of SplitMix64, which scrambles the bits of x.
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// sign returns the signature of the set of k-rune shingles of line:
+// its substrings of k runes. A line of fewer than k runes is a single
+// shingle.
+func sign(line string, k int) *signature {
+	var sig signature
+	for i := range sig {
+		sig[i] = math.MaxUint64
+	}
+	// starts holds the offset of each rune of line, and then its end.
+	starts := make([]int, 0, len(line)+1)
+	for i := range line {
+		starts = append(starts, i)
+	}
+	starts = append(starts, len(line))
+	runes := len(starts) - 1
+
+	for i := 0; i == 0 || i+k <= runes; i++ {
+		end := i + k
+		if end > runes {
+			end = runes
+		}
+		x := fnv64a(line[starts[i]:starts[end]])
+		for j := range sig {
+			if v := mix(x ^ seeds[j]); v < sig[j] {
+				sig[j] = v
+			}
+		}
+	}
+	return &sig
+}
+
+// fnv64a returns the 64-bit FNV-1a hash of s.
+func fnv64a(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// similarity estimates the Jaccard similarity of the sets of shingles
+// of two signatures.
+func (sig *signature) similarity(other *signature) float64 {
+	same := 0
+	for i := range sig {
+		if sig[i] == other[i] {
+			same++
+		}
+	}
+	return float64(same) / numHashes
+}
+
+// bands returns the number of bands into which to divide signatures,
+// so that two whose similarity is at least threshold are very likely
+// to agree in all the rows of some band, and so be compared. Two of
+// similarity s agree in some band with probability 1 - (1 - s^r)^b,
+// which rises most steeply at about (1/b)^(1/r); it is better to
+// compare too many than to miss some, so the steepest point is put
+// below threshold.
+func bands(threshold float64) int {
+	best := numHashes
+	for b := numHashes; b >= 1; b /= 2 {
+		r := numHashes / b
+		if math.Pow(1/float64(b), 1/float64(r)) < threshold-0.1 {
+			best = b
+		}
+	}
+	return best
+}
+
+// Clusters groups the distinct lines of counts, which maps each to its
+// number of occurrences, into clusters of lines whose sets of k-rune
+// shingles have a Jaccard similarity of at least threshold, as
+// estimated by MinHash. Lines are linked to those they are similar to,
+// and each cluster is a set of linked lines. Clusters are returned in
+// decreasing order of count, and then in lexical order of first line.
+func Clusters(counts map[string]int, threshold float64, k int) []Cluster {
+	lines := make([]string, 0, len(counts))
+	for line := range counts {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines) // for reproducible results
+	sigs := make([]*signature, len(lines))
+	for i, line := range lines {
+		sigs[i] = sign(line, k)
+	}
+
+	// 【Go vs Java】并查集
+	// Java:  int[] parent = new int[n];
+	// Go:    parent := make([]int, n)，切片的长度可以在运行时决定
+	parent := make([]int, len(lines))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// Compare only the lines whose signatures agree in a band, by
+	// locality-sensitive hashing, rather than every pair of lines.
+	b := bands(threshold)
+	r := numHashes / b
+	key := make([]byte, 8*r)
+	for band := 0; band < b; band++ {
+		buckets := make(map[string][]int) // keyed by the rows of the band
+		for i, sig := range sigs {
+			for j, v := range sig[band*r : (band+1)*r] {
+				binary.LittleEndian.PutUint64(key[8*j:], v)
+			}
+			buckets[string(key)] = append(buckets[string(key)], i)
+		}
+		for _, bucket := range buckets {
+			// Compare each line with every earlier one in the bucket,
+			// not just the first, which may be unlike both of two
+			// lines that are alike.
+			for n, i := range bucket {
+				for _, j := range bucket[:n] {
+					if find(i) != find(j) && sigs[i].similarity(sigs[j]) >= threshold {
+						parent[find(i)] = find(j)
+					}
+				}
+			}
+		}
+	}
+
+	byRoot := make(map[int]*Cluster)
+	var clusters []*Cluster
+	for i, line := range lines {
+		root := find(i)
+		c := byRoot[root]
+		if c == nil {
+			c = new(Cluster)
+			byRoot[root] = c
+			clusters = append(clusters, c)
+		}
+		c.Lines = append(c.Lines, line)
+		c.Count += counts[line]
+	}
+	result := make([]Cluster, len(clusters))
+	for i, c := range clusters {
+		// Put the most frequent line first; the sort is stable, so
+		// lines of equal count stay in lexical order.
+		sort.SliceStable(c.Lines, func(i, j int) bool { return counts[c.Lines[i]] > counts[c.Lines[j]] })
+		result[i] = *c
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Lines[0] < result[j].Lines[0]
+	})
+	return result
+}
+
+// Merge returns the counts of the clusters of near duplicates in
+// counts, as found by Clusters, by their first lines.
+func Merge(counts map[string]int, threshold float64, k int) map[string]int {
+	merged := make(map[string]int)
+	for _, c := range Clusters(counts, threshold, k) {
+		merged[c.Lines[0]] = c.Count
+	}
+	return merged
+}
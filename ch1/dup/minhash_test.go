@@ -0,0 +1,75 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package dup
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	// The shingles of "abcdef" are ab bc cd de ef, and of "abcdxy"
+	// ab bc cd dx xy, so their Jaccard similarity is 3/7.
+	got := sign("abcdef", 2).similarity(sign("abcdxy", 2))
+	if math.Abs(got-3.0/7) > 0.15 {
+		t.Errorf("similarity = %.2f, want about %.2f", got, 3.0/7)
+	}
+	if got := sign("abc", 5).similarity(sign("abc", 5)); got != 1 {
+		t.Errorf("similarity of short line to itself = %g, want 1", got)
+	}
+}
+
+func TestClusters(t *testing.T) {
+	counts := map[string]int{
+		"connection reset by peer 10.0.0.1":                   3,
+		"connection reset by peer 10.0.0.2":                   1,
+		"connection reset by peer 10.0.0.17":                  1,
+		"disk /dev/sda1 on /var is 91% full, free some space": 2,
+		"disk /dev/sda1 on /var is 92% full, free some space": 2,
+		"user alice logged in":                                1,
+		"completely different line of text!!":                 4,
+	}
+	got := Clusters(counts, 0.7, 5)
+	want := []Cluster{
+		{[]string{"connection reset by peer 10.0.0.1", "connection reset by peer 10.0.0.17",
+			"connection reset by peer 10.0.0.2"}, 5},
+		{[]string{"completely different line of text!!"}, 4},
+		{[]string{"disk /dev/sda1 on /var is 91% full, free some space",
+			"disk /dev/sda1 on /var is 92% full, free some space"}, 4},
+		{[]string{"user alice logged in"}, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Clusters = %q, want %q", got, want)
+	}
+
+	// With a threshold of 1, only identical shingle sets are merged.
+	if got := Clusters(counts, 1, 5); len(got) != len(counts) {
+		t.Errorf("Clusters with threshold 1 = %q, want %d clusters", got, len(counts))
+	}
+
+	merged := Merge(counts, 0.7, 5)
+	wantMerged := map[string]int{
+		"connection reset by peer 10.0.0.1":                   5,
+		"completely different line of text!!":                 4,
+		"disk /dev/sda1 on /var is 91% full, free some space": 4,
+		"user alice logged in":                                1,
+	}
+	if !reflect.DeepEqual(merged, wantMerged) {
+		t.Errorf("Merge = %v, want %v", merged, wantMerged)
+	}
+}
+
+// TestClustersRecall checks that banding finds nearly all the pairs
+// above the threshold, among many lines.
+func TestClustersRecall(t *testing.T) {
+	counts := make(map[string]int)
+	for i := 0; i < 500; i++ {
+		counts[fmt.Sprintf("worker %03d finished processing the queue of jobs that were waiting for it at startup", i)] = 1
+	}
+	if got := Clusters(counts, 0.8, 5); len(got) > 5 {
+		t.Errorf("Clusters of 500 near duplicates = %d clusters, want at most 5", len(got))
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Package dup provides the ways of matching lines shared by the dup
+// programs: normalizing lines before they are compared, so that lines
+// that differ only in spacing, case, or a timestamp count as the same,
+// and clustering lines that are nearly the same.
+package dup
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A Normalizer rewrites lines into a normal form, in which lines that
+// differ only in ways that do not matter are the same. The zero value
+// leaves lines as they are.
+//
+// A Normalizer must not be used by more than one goroutine at a time.
+type Normalizer struct {
+	NFC      bool   // put in Unicode normalization form C
+	Masks    []Mask // replace the text matched by each mask, in order
+	Fold     bool   // fold case, so that "Straße" is "strasse"
+	Collapse bool   // replace each run of white space by one space
+	Trim     bool   // remove leading and trailing white space
+
+	fold *cases.Caser // for Fold, which has state
+}
+
+// A Mask replaces the text matched by a regular expression with
+// the name of what it matches, such as <timestamp>.
+type Mask struct {
+	Name string
+	Re   *regexp.Regexp
+}
+
+// Masks are the masks that can be chosen by name.
+var Masks = map[string]*regexp.Regexp{
+	// ISO 8601, as in 2006-01-02T15:04:05.000Z or 2006-01-02 15:04:05,000;
+	// syslog, as in Jan  2 15:04:05; Apache, as in 02/Jan/2006:15:04:05 -0700;
+	// and a time of day alone, as in 15:04:05.000.
+	"timestamp": regexp.MustCompile(`\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(?:[.,]\d+)?(?:Z|[+-]\d\d:?\d\d)?` +
+		`|\b(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) [ \d]\d \d\d:\d\d:\d\d` +
+		`|\d\d/(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)/\d{4}:\d\d:\d\d:\d\d(?: [+-]\d{4})?` +
+		`|\b\d\d:\d\d:\d\d(?:[.,]\d+)?\b`),
+	"uuid": regexp.MustCompile(`\b[[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12}\b`),
+	// A hexadecimal ID, such as a hash or an address: a number with
+	// the prefix 0x, or at least 8 digits.
+	"hex": regexp.MustCompile(`\b(?:0x[[:xdigit:]]+|[[:xdigit:]]{8,})\b`),
+	"ip":  regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`),
+	// A decimal number, which may be followed by a unit, as in 12.5ms.
+	"number": regexp.MustCompile(`-?\b\d+(?:\.\d+)?`),
+}
+
+// MaskNames returns the names of Masks, sorted.
+func MaskNames() []string {
+	var names []string
+	for name := range Masks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseMask returns the mask of the given name in Masks, or else the
+// mask of the regular expression s, which replaces its matches by <*>.
+func ParseMask(s string) (Mask, error) {
+	if re, ok := Masks[s]; ok {
+		return Mask{s, re}, nil
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return Mask{}, fmt.Errorf("mask %q is not one of %s, nor a regular expression: %v",
+			s, strings.Join(MaskNames(), ", "), err)
+	}
+	if re.MatchString("") {
+		return Mask{}, fmt.Errorf("mask %q matches the empty string", s)
+	}
+	return Mask{"*", re}, nil
+}
+
+// Normalize returns the normal form of line.
+func (n *Normalizer) Normalize(line string) string {
+	if n.NFC {
+		line = norm.NFC.String(line)
+	}
+	for _, m := range n.Masks {
+		line = m.Re.ReplaceAllLiteralString(line, "<"+m.Name+">")
+	}
+	if n.Fold {
+		if n.fold == nil {
+			c := cases.Fold()
+			n.fold = &c
+		}
+		line = n.fold.String(line)
+	}
+	if n.Collapse {
+		line = collapse(line)
+	}
+	if n.Trim {
+		line = strings.TrimSpace(line)
+	}
+	return line
+}
+
+// collapse replaces each run of white space in s by one space.
+func collapse(s string) string {
+	var b strings.Builder
+	space := false // in a run of white space
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package dup
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	mask := func(names ...string) []Mask {
+		var masks []Mask
+		for _, name := range names {
+			m, err := ParseMask(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			masks = append(masks, m)
+		}
+		return masks
+	}
+	for _, test := range []struct {
+		n          Normalizer
+		line, want string
+	}{
+		{Normalizer{}, "  Hello,  World ", "  Hello,  World "},
+		{Normalizer{Trim: true}, " \tHello,  World \r", "Hello,  World"},
+		{Normalizer{Collapse: true}, " Hello, \t World  ", " Hello, World "},
+		{Normalizer{Collapse: true, Trim: true}, " Hello, \t World  ", "Hello, World"},
+		{Normalizer{Fold: true}, "Straße STRASSE", "strasse strasse"},
+		{Normalizer{NFC: true}, "é", "é"},
+		{Normalizer{NFC: true, Fold: true}, "É", "é"},
+		{
+			Normalizer{Masks: mask("timestamp")},
+			"2021-03-04T05:06:07.890Z GET /index.html",
+			"<timestamp> GET /index.html",
+		},
+		{
+			Normalizer{Masks: mask("timestamp")},
+			"Mar  4 05:06:07 host sshd[123]: accepted",
+			"<timestamp> host sshd[123]: accepted",
+		},
+		{
+			Normalizer{Masks: mask("timestamp", "ip")},
+			`10.0.0.1:8080 - - [04/Mar/2021:05:06:07 -0700] "GET / HTTP/1.1"`,
+			`<ip> - - [<timestamp>] "GET / HTTP/1.1"`,
+		},
+		{
+			Normalizer{Masks: mask("uuid", "hex", "number")},
+			"request 123e4567-e89b-12d3-a456-426614174000 at 0xc000012345 took 12.5ms, commit deadbeef42",
+			"request <uuid> at <hex> took <number>ms, commit <hex>",
+		},
+		{
+			Normalizer{Masks: mask(`user=\w+`), Fold: true},
+			"Login user=Alice OK",
+			"login <*> ok",
+		},
+	} {
+		if got := test.n.Normalize(test.line); got != test.want {
+			t.Errorf("%+v.Normalize(%q) = %q, want %q", test.n, test.line, got, test.want)
+		}
+	}
+}
+
+func TestParseMaskErrors(t *testing.T) {
+	for _, test := range []struct{ mask, want string }{
+		{"(", "mask \"(\" is not one of hex, ip, number, timestamp, uuid, nor a regular expression: " +
+			"error parsing regexp: missing closing ): `(`"},
+		{"a*", `mask "a*" matches the empty string`},
+	} {
+		_, err := ParseMask(test.mask)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("ParseMask(%q) = %v, want %s", test.mask, err, test.want)
+		}
+	}
+}
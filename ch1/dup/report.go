@@ -0,0 +1,203 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package dup
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Write writes to w the lines counted by c that occur at least o.Min
+// times, merged with their near duplicates if o.Near is set, in the
+// format and order that o asks for. Sorting by count, or merging near
+// duplicates, holds the lines in memory; otherwise they are written as
+// c yields them.
+func (o *Options) Write(w io.Writer, c *Counter) error {
+	out, err := newWriter(w, o.Format)
+	if err != nil {
+		return err
+	}
+	if o.Near == 0 && o.Sort != "count" {
+		err := c.Each(func(d *Dup) error {
+			if d.Count >= o.Min {
+				return out.write(d)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return out.flush()
+	}
+
+	var dups []*Dup
+	err = c.Each(func(d *Dup) error {
+		if o.Near > 0 || d.Count >= o.Min {
+			dups = append(dups, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if o.Near > 0 {
+		dups = c.mergeNear(dups, o.Near, o.Shingle)
+	}
+	sort.SliceStable(dups, func(i, j int) bool {
+		if o.Sort == "count" && dups[i].Count != dups[j].Count {
+			return dups[i].Count > dups[j].Count
+		}
+		return dups[i].Line < dups[j].Line
+	})
+	for _, d := range dups {
+		if d.Count >= o.Min {
+			if err := out.write(d); err != nil {
+				return err
+			}
+		}
+	}
+	return out.flush()
+}
+
+// mergeNear returns a Dup for each cluster of near duplicates among
+// dups, as found by Clusters, with the text of its most frequent line
+// and the counts and locations of all its lines.
+func (c *Counter) mergeNear(dups []*Dup, threshold float64, k int) []*Dup {
+	counts := make(map[string]int)
+	byLine := make(map[string]*Dup)
+	for _, d := range dups {
+		counts[d.Line] = d.Count
+		byLine[d.Line] = d
+	}
+	order := make(map[string]int) // of the first occurrence of each file
+	for i := len(c.files) - 1; i >= 0; i-- {
+		order[c.files[i]] = i
+	}
+
+	var merged []*Dup
+	for _, cl := range Clusters(counts, threshold, k) {
+		if len(cl.Lines) == 1 {
+			merged = append(merged, byLine[cl.Lines[0]])
+			continue
+		}
+		d := &Dup{Line: cl.Lines[0], Count: cl.Count}
+		files := make(map[string]int)
+		for _, line := range cl.Lines {
+			for _, f := range byLine[line].Files {
+				files[f.File] += f.Count
+			}
+			d.Locations = append(d.Locations, byLine[line].Locations...)
+		}
+		for file, n := range files {
+			d.Files = append(d.Files, FileCount{file, n})
+		}
+		sort.Slice(d.Files, func(i, j int) bool { return order[d.Files[i].File] < order[d.Files[j].File] })
+		sort.Slice(d.Locations, func(i, j int) bool {
+			x, y := d.Locations[i], d.Locations[j]
+			if x.File != y.File {
+				return order[x.File] < order[y.File]
+			}
+			return x.Line < y.Line
+		})
+		if len(d.Locations) > c.Locations {
+			d.Locations = d.Locations[:c.Locations]
+		}
+		merged = append(merged, d)
+	}
+	return merged
+}
+
+// A writer writes Dups in some format.
+type writer interface {
+	write(d *Dup) error
+	flush() error
+}
+
+// Formats are the names of the formats in which Write can write.
+var Formats = []string{"text", "json", "csv"}
+
+func newWriter(w io.Writer, format string) (writer, error) {
+	switch format {
+	case "", "text":
+		return &textWriter{bufio.NewWriter(w)}, nil
+	case "json":
+		bw := bufio.NewWriter(w)
+		return &jsonWriter{bw, json.NewEncoder(bw)}, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"line", "count", "files", "locations"})
+		return &csvWriter{cw}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, want one of %s", format, strings.Join(Formats, ", "))
+}
+
+// A textWriter writes the count and text of each line, as the dup
+// programs always have, followed by its locations, indented.
+type textWriter struct{ out *bufio.Writer }
+
+func (w *textWriter) write(d *Dup) error {
+	fmt.Fprintf(w.out, "%d\t%s\n", d.Count, d.Line)
+	for _, loc := range d.Locations {
+		fmt.Fprintf(w.out, "\t%s\n", loc)
+	}
+	return nil
+}
+
+func (w *textWriter) flush() error { return w.out.Flush() }
+
+// A jsonWriter writes each line as a JSON object on a line of its own,
+// such as
+//
+//	{"line":"x","count":3,"files":{"a":2,"b":1},"locations":["a:1","a:7"]}
+type jsonWriter struct {
+	out *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonWriter) write(d *Dup) error {
+	var rec struct {
+		Line      string         `json:"line"`
+		Count     int            `json:"count"`
+		Files     map[string]int `json:"files"`
+		Locations []string       `json:"locations,omitempty"`
+	}
+	rec.Line = d.Line
+	rec.Count = d.Count
+	rec.Files = make(map[string]int)
+	for _, f := range d.Files {
+		rec.Files[f.File] = f.Count
+	}
+	for _, loc := range d.Locations {
+		rec.Locations = append(rec.Locations, loc.String())
+	}
+	return w.enc.Encode(rec)
+}
+
+func (w *jsonWriter) flush() error { return w.out.Flush() }
+
+// A csvWriter writes each line as a CSV record of the line, its count,
+// its file counts, as in "a=2;b=1", and its locations, as in "a:1;a:7".
+type csvWriter struct{ out *csv.Writer }
+
+func (w *csvWriter) write(d *Dup) error {
+	var files, locs []string
+	for _, f := range d.Files {
+		files = append(files, f.File+"="+strconv.Itoa(f.Count))
+	}
+	for _, loc := range d.Locations {
+		locs = append(locs, loc.String())
+	}
+	return w.out.Write([]string{d.Line, strconv.Itoa(d.Count), strings.Join(files, ";"), strings.Join(locs, ";")})
+}
+
+func (w *csvWriter) flush() error {
+	w.out.Flush()
+	return w.out.Error()
+}
@@ -6,17 +6,48 @@
 
 // Dup1 prints the text of each line that appears more than
 // once in the standard input, preceded by its count.
+//
+// Flags such as -trim, -fold and -mask timestamp make lines that
+// differ only in spacing, case or a timestamp count as the same, and
+// -near counts lines that are nearly the same; see dup.Options.
+// With -format json or csv, -sort and -min, it prints records that
+// other programs can read, in a stable order.
 package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
+
+	"gopl.io/ch1/dup"
 )
 
 // main 从标准输入读取内容，打印出现次数大于1的行及其次数
 // 【Go vs Java】Go的注释风格统一使用 // ，不推荐使用 /** */ 的JavaDoc风格
 func main() {
+	var opts dup.Options
+	opts.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := opts.Check(); err != nil {
+		fmt.Fprintf(os.Stderr, "dup1: %v\n", err)
+		os.Exit(2)
+	}
+
+	// 按 -format、-sort 等选项的要求，改用 dup.Counter 计数并输出记录
+	if c := opts.NewCounter(); c != nil {
+		err := c.AddFile("-", os.Stdin, &opts.Normalizer)
+		if err == nil {
+			err = opts.Write(os.Stdout, c)
+		}
+		c.Close() // 删除临时文件；注意：os.Exit不会执行defer，所以这里不用defer
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dup1: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 【Go vs Java】创建map的方式
 	// Java:  Map<String, Integer> counts = new HashMap<>();
 	// Go:    使用 make() 内置函数创建，语法为 make(map[KeyType]ValueType)
@@ -39,10 +70,14 @@ func main() {
 		// 【Go vs Java】获取当前行并更新计数
 		// Java:  counts.put(line, counts.getOrDefault(line, 0) + 1);
 		// Go:    直接用 [] 访问和赋值，未初始化的int默认值为0，可以直接 ++
-		counts[input.Text()]++
+		// 按选项规范化之后再计数，如去掉首尾空白、忽略大小写
+		counts[opts.Normalize(input.Text())]++
 	}
 	// 注意：这里忽略了 input.Err() 的潜在错误，生产代码应检查
 
+	// 把相似的行合并计数（仅当给出 -near 时）
+	counts = opts.Merge(counts)
+
 	// 【Go vs Java】遍历map
 	// Java:  for (Map.Entry<String, Integer> entry : counts.entrySet()) { ... }
 	// Go:    使用 range 关键字，可同时获取 key 和 value
@@ -6,18 +6,50 @@
 
 // Dup2 prints the count and text of lines that appear more than once
 // in the input.  It reads from stdin or from a list of named files.
+//
+// Flags such as -trim, -fold and -mask timestamp make lines that
+// differ only in spacing, case or a timestamp count as the same, and
+// -near counts lines that are nearly the same; see dup.Options.
+//
+// With -mem, it counts inputs larger than memory, by sorting them in
+// temporary files; with -where, it prints where each line occurs; and
+// with -format json or csv, -sort and -min, it prints records that
+// other programs can read, in a stable order.
 package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
+
+	"gopl.io/ch1/dup"
 )
 
+// opts 是命令行给出的比较行的选项
+var opts dup.Options
+
 // main 可以从标准输入或文件读取，统计重复行
 func main() {
+	opts.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := opts.Check(); err != nil {
+		fmt.Fprintf(os.Stderr, "dup2: %v\n", err)
+		os.Exit(2)
+	}
+
+	files := flag.Args()
+
+	// 按 -mem、-where、-format 等选项的要求，改用 dup.Counter 计数
+	if c := opts.NewCounter(); c != nil {
+		if err := countAll(c, files); err != nil {
+			fmt.Fprintf(os.Stderr, "dup2: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	counts := make(map[string]int)
-	files := os.Args[1:]
 
 	// 【Go vs Java】条件判断
 	// Java:  if (files.length == 0) { ... }
@@ -62,8 +94,8 @@ func main() {
 		}
 	}
 
-	// 打印重复的行
-	for line, n := range counts {
+	// 打印重复的行，相似的行已合并计数（仅当给出 -near 时）
+	for line, n := range opts.Merge(counts) {
 		if n > 1 {
 			fmt.Printf("%d\t%s\n", n, line)
 		}
@@ -82,9 +114,36 @@ func countLines(f *os.File, counts map[string]int) {
 		// Java:  counts.put(line, counts.getOrDefault(line, 0) + 1);
 		// Go:    counts[input.Text()]++ (直接修改，影响外部的map)
 		// 注意：Go的map、slice、channel是引用类型，函数内修改会影响外部
-		counts[input.Text()]++
+		counts[opts.Normalize(input.Text())]++
 	}
 	// 注意：这里忽略了 input.Err() 的潜在错误
 }
 
+// countAll 用c统计files（为空时是标准输入）中的行，并按选项打印重复的行及其位置。
+// c占用的内存超过上限时，会把排好序的行写到临时文件，最后再归并
+// 【Go vs Java】defer
+// Java:  try { ... } finally { c.close(); }
+// Go:    defer c.Close()，函数返回时执行，无论从哪里返回
+func countAll(c *dup.Counter, files []string) error {
+	defer c.Close()
+	if len(files) == 0 {
+		if err := c.AddFile("-", os.Stdin, &opts.Normalizer); err != nil {
+			return err
+		}
+	}
+	for _, arg := range files {
+		f, err := os.Open(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dup2: %v\n", err)
+			continue
+		}
+		err = c.AddFile(arg, f, &opts.Normalizer)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return opts.Write(os.Stdout, c)
+}
+
 //!-
@@ -7,21 +7,51 @@
 
 // Dup3 prints the count and text of lines that
 // appear more than once in the named input files.
+//
+// Flags such as -trim, -fold and -mask timestamp make lines that
+// differ only in spacing, case or a timestamp count as the same, and
+// -near counts lines that are nearly the same; see dup.Options.
+//
+// With -mem, it counts files larger than memory, reading them a line
+// at a time and sorting them in temporary files, rather than reading
+// each whole; with -where, it prints where each line occurs; and with
+// -format json or csv, -sort and -min, it prints records that other
+// programs can read, in a stable order.
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil" // I/O工具包（注意：Go 1.16+推荐用os.ReadFile）
 	"os"
 	"strings"
+
+	"gopl.io/ch1/dup"
 )
 
 // main 一次性读取整个文件内容，统计重复行
 func main() {
+	var opts dup.Options
+	opts.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := opts.Check(); err != nil {
+		fmt.Fprintf(os.Stderr, "dup3: %v\n", err)
+		os.Exit(2)
+	}
+
+	// 按 -mem、-where、-format 等选项的要求，改用 dup.Counter 逐行计数，而不是一次读取整个文件
+	if c := opts.NewCounter(); c != nil {
+		if err := countAll(c, &opts, flag.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "dup3: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	counts := make(map[string]int)
 
 	// 遍历所有文件参数
-	for _, filename := range os.Args[1:] {
+	for _, filename := range flag.Args() {
 		// 【Go vs Java】一次性读取整个文件
 		// Java:  String data = Files.readString(Path.of(filename));
 		// Go:    data, err := ioutil.ReadFile(filename)
@@ -42,18 +72,38 @@ func main() {
 			// Java:  new String(bytes) 或 new String(bytes, charset)
 			// Go:    string([]byte) 直接转换
 			// 注意：Go的类型转换语法是 Type(value)，不是 new Type(value)
-			counts[line]++
+			counts[opts.Normalize(line)]++
 		}
 	}
 
-	// 打印重复的行
-	for line, n := range counts {
+	// 打印重复的行，相似的行已合并计数（仅当给出 -near 时）
+	for line, n := range opts.Merge(counts) {
 		if n > 1 {
 			fmt.Printf("%d\t%s\n", n, line)
 		}
 	}
 }
 
+// countAll 用c逐行统计files中的行，并按选项打印重复的行及其位置。
+// c占用的内存超过上限时，会把排好序的行写到临时文件，最后再归并。
+// 注意：与strings.Split不同，逐行读取时文件末尾的换行不会多出一个空行
+func countAll(c *dup.Counter, opts *dup.Options, files []string) error {
+	defer c.Close()
+	for _, filename := range files {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dup3: %v\n", err)
+			continue
+		}
+		err = c.AddFile(filename, f, &opts.Normalizer)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return opts.Write(os.Stdout, c)
+}
+
 // 【dup1 vs dup2 vs dup3 对比】
 // dup1: 只从标准输入读取，流式处理
 // dup2: 可从标准输入或文件读取，流式处理（逐行）
@@ -5,25 +5,45 @@
 //!+
 
 // Fetch prints the content found at each specified URL.
+//
+// It keeps the pages it fetches in a cache, and fetches them again only
+// once they are out of date, and then only if they have changed; see
+// the Cache of gopl.io/ch1/fetchall/fetch. The flag -nocache bypasses
+// the cache, and -clear clears it. It also prints files named by file
+// URLs, for use offline.
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
-	"net/http" // HTTP客户端和服务器包
 	"os"
+
+	"gopl.io/ch1/fetchall/fetch"
 )
 
 // main 获取URL内容并打印到标准输出
 func main() {
+	var opts fetch.CacheOptions
+	opts.AddFlags(flag.CommandLine)
+	flag.Parse()
+	// 【Go vs Java】HTTP客户端
+	// Java:  HttpClient client = HttpClient.newBuilder()...build();
+	// Go:    client := &http.Client{Transport: ...}
+	// 注意：Transport决定请求如何发出，这里先查本地缓存
+	client, err := opts.Client()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fetch: %v\n", err)
+		os.Exit(1)
+	}
+
 	// 遍历所有URL参数
-	for _, url := range os.Args[1:] {
+	for _, url := range flag.Args() {
 		// 【Go vs Java】HTTP GET请求
-		// Java:  HttpClient client = HttpClient.newHttpClient();
-		//        HttpResponse<String> resp = client.send(request, ...);
-		// Go:    resp, err := http.Get(url)
-		// 注意：Go的http.Get非常简洁，一行代码搞定
-		resp, err := http.Get(url)
+		// Java:  HttpResponse<String> resp = client.send(request, ...);
+		// Go:    resp, err := client.Get(url)
+		// 注意：Go的client.Get（或http.Get）非常简洁，一行代码搞定
+		resp, err := client.Get(url)
 
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "fetch: %v\n", err)
@@ -0,0 +1,319 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package fetch
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Cache is an http.RoundTripper that keeps the responses to GET
+// requests for http and https URLs in files in a directory, and reuses
+// them. A response is reused without a request while it is younger
+// than the max-age of its Cache-Control header, and after that only
+// once the server confirms, in answer to a request with If-None-Match
+// or If-Modified-Since, that it has not changed.
+//
+// Each response that Cache returns has the header X-Cache, whose value
+// is "hit" if it came from the cache, "revalidated" if it came from the
+// cache after the server confirmed it, or "miss".
+type Cache struct {
+	Dir       string            // of the files of the cache
+	Transport http.RoundTripper // makes the requests; or nil for http.DefaultTransport
+}
+
+// A response is kept in a file named by the SHA-256 hash of its URL, in
+// the form in which HTTP/1.1 sends it, without a Content-Length or
+// Transfer-Encoding, so that its body runs to the end of the file.
+// The time of the file is the time at which the response was received,
+// or last revalidated.
+
+// name returns the name of the file of the response to a request for
+// url.
+func (c *Cache) name(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *Cache) transport() http.RoundTripper {
+	if c.Transport == nil {
+		return http.DefaultTransport
+	}
+	return c.Transport
+}
+
+// RoundTrip returns the response to req, from the cache if it can.
+func (c *Cache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || req.URL.Scheme != "http" && req.URL.Scheme != "https" ||
+		req.Header.Get("Range") != "" || req.Header.Get("If-None-Match") != "" ||
+		req.Header.Get("If-Modified-Since") != "" {
+		return c.transport().RoundTrip(req)
+	}
+	url := req.URL.String()
+	name := c.name(url)
+
+	cached, age, err := c.load(name, req)
+	if err != nil {
+		cached = nil // treat a damaged file as missing
+	}
+	if cached != nil {
+		if maxAge, ok := cacheControl(cached.Header, "max-age"); ok && !noCache(cached.Header) && age < maxAge {
+			cached.Header.Set("X-Cache", "hit")
+			return cached, nil
+		}
+		// Ask the server whether the cached response is still good.
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lm := cached.Header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	resp, err := c.transport().RoundTrip(req)
+	if err != nil {
+		if cached != nil {
+			cached.Body.Close()
+		}
+		return nil, err
+	}
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		// The 304 response may update the headers of the cached one.
+		for _, key := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified"} {
+			if v := resp.Header.Get(key); v != "" {
+				cached.Header.Set(key, v)
+			}
+		}
+		cached.Header.Set("X-Cache", "revalidated")
+		return c.store(name, cached)
+	}
+	if cached != nil {
+		cached.Body.Close()
+	}
+	resp.Header.Set("X-Cache", "miss")
+	if resp.StatusCode != http.StatusOK || !cacheable(resp.Header) {
+		os.Remove(name) // it would be out of date
+		return resp, nil
+	}
+	return c.store(name, resp)
+}
+
+// load returns the cached response to req, read from the named file,
+// and its age, or nil if there is none.
+func (c *Cache) load(name string, req *http.Request) (*http.Response, time.Duration, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(f), req)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	resp.Body = &fileBody{resp.Body, f}
+	return resp, time.Since(info.ModTime()), nil
+}
+
+// A fileBody is the body of a cached response, which closes its file.
+type fileBody struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (b *fileBody) Close() error {
+	b.ReadCloser.Close()
+	return b.f.Close()
+}
+
+// store returns resp, whose body, as it is read, is copied to a new
+// file in the cache, which replaces the named file once it is whole.
+func (c *Cache) store(name string, resp *http.Response) (*http.Response, error) {
+	if err := os.MkdirAll(c.Dir, 0777); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(c.Dir, tmpPrefix)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintf(w, "HTTP/1.1 %s\r\n", resp.Status)
+	header := resp.Header.Clone()
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+	header.Del("X-Cache")
+	header.Write(w)
+	w.WriteString("\r\n")
+	resp.Body = &storingBody{resp.Body, w, tmp, name, nil}
+	return resp, nil
+}
+
+// A storingBody is the body of a response that is being stored in
+// the cache: it copies what is read to a temporary file, which it
+// renames to the name of the file of the response at the end of the
+// body, or otherwise removes.
+type storingBody struct {
+	in   io.ReadCloser
+	out  *bufio.Writer
+	tmp  *os.File
+	name string
+	err  error // of writing to tmp
+}
+
+func (b *storingBody) Read(p []byte) (int, error) {
+	n, err := b.in.Read(p)
+	if b.err == nil && n > 0 {
+		_, b.err = b.out.Write(p[:n])
+	}
+	if err == io.EOF && b.tmp != nil {
+		b.finish(true)
+	}
+	return n, err
+}
+
+func (b *storingBody) Close() error {
+	if b.tmp != nil {
+		b.finish(false)
+	}
+	return b.in.Close()
+}
+
+// finish keeps the stored response, if whole is set and it was written
+// without error, and otherwise removes it.
+func (b *storingBody) finish(whole bool) {
+	if b.err == nil {
+		b.err = b.out.Flush()
+	}
+	if err := b.tmp.Close(); b.err == nil {
+		b.err = err
+	}
+	if whole && b.err == nil {
+		b.err = os.Rename(b.tmp.Name(), b.name)
+	}
+	if !whole || b.err != nil {
+		os.Remove(b.tmp.Name())
+	}
+	b.tmp = nil
+}
+
+// tmpPrefix begins the names of the files in which responses are
+// written before they are complete, so that Clear can tell them from
+// other files in the directory.
+const tmpPrefix = ".gopl-fetch-"
+
+// Clear removes all responses from the cache.
+func (c *Cache) Clear() error {
+	files, err := ioutil.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, f := range files {
+		// Remove only the files that the cache made.
+		name := f.Name()
+		if _, err := hex.DecodeString(name); err == nil && len(name) == 2*sha256.Size ||
+			strings.HasPrefix(name, tmpPrefix) {
+			if err := os.Remove(filepath.Join(c.Dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cacheControl returns the value in seconds of the named directive of
+// the Cache-Control header, and whether it has one.
+func cacheControl(h http.Header, directive string) (time.Duration, bool) {
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		d = strings.TrimSpace(d)
+		if n := len(directive) + 1; len(d) >= n && strings.EqualFold(d[:n], directive+"=") {
+			secs, err := strconv.ParseInt(strings.Trim(d[len(directive)+1:], `"`), 10, 64)
+			if err != nil || secs < 0 {
+				return 0, false
+			}
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// hasDirective reports whether the Cache-Control header has the named
+// directive, which has no value.
+func hasDirective(h http.Header, directive string) bool {
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(d), directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// noCache reports whether a response must be revalidated before reuse.
+func noCache(h http.Header) bool { return hasDirective(h, "no-cache") }
+
+// cacheable reports whether a response may be stored and is worth it:
+// whether it may be reused for a time, or revalidated.
+func cacheable(h http.Header) bool {
+	if hasDirective(h, "no-store") {
+		return false
+	}
+	maxAge, _ := cacheControl(h, "max-age")
+	return maxAge > 0 || h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+}
+
+// CacheOptions are the options of the fetch programs for caching.
+type CacheOptions struct {
+	Dir    string // of the cache
+	Bypass bool   // neither use nor update the cache
+	Clear  bool   // remove all responses from the cache before fetching
+}
+
+// AddFlags defines flags in fs that set the fields of o.
+func (o *CacheOptions) AddFlags(fs *flag.FlagSet) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	fs.StringVar(&o.Dir, "cache", filepath.Join(dir, "gopl-fetch"), "directory of the cache of fetched pages")
+	fs.BoolVar(&o.Bypass, "nocache", false, "neither use nor update the cache")
+	fs.BoolVar(&o.Clear, "clear", false, "clear the cache before fetching")
+}
+
+// Client returns a client that fetches file URLs from the local file
+// system, and others through the cache, unless o bypasses it. It first
+// clears the cache, if o asks it to.
+func (o *CacheOptions) Client() (*http.Client, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	c := &Cache{Dir: o.Dir, Transport: t}
+	if o.Clear {
+		if err := c.Clear(); err != nil {
+			return nil, err
+		}
+	}
+	if o.Bypass {
+		return &http.Client{Transport: t}, nil
+	}
+	return &http.Client{Transport: c}, nil
+}
@@ -0,0 +1,160 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var requests, conditional int32
+	version := "1"
+	modified := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			atomic.AddInt32(&conditional, 1)
+		}
+		switch r.URL.Path {
+		case "/etag": // fresh for an hour
+			w.Header().Set("Cache-Control", "Max-Age=3600")
+			w.Header().Set("ETag", `"v`+version+`"`)
+			if r.Header.Get("If-None-Match") == `"v`+version+`"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/modified": // must always be revalidated
+			w.Header().Set("Cache-Control", "no-cache")
+			http.ServeContent(w, r, "", modified, strings.NewReader("modified "+version))
+			return
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store, max-age=3600")
+		case "/plain": // neither fresh nor revalidatable
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "%s %s", r.URL.Path, version)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	cache := &Cache{Dir: dir}
+	client := &http.Client{Transport: cache}
+	get := func(path, wantBody, wantCache string, wantRequests, wantConditional int32) {
+		t.Helper()
+		atomic.StoreInt32(&requests, 0)
+		atomic.StoreInt32(&conditional, 0)
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != wantBody || resp.Header.Get("X-Cache") != wantCache ||
+			requests != wantRequests || conditional != wantConditional {
+			t.Errorf("GET %s: got %q, %s, %d requests, %d conditional; want %q, %s, %d, %d",
+				path, body, resp.Header.Get("X-Cache"), requests, conditional,
+				wantBody, wantCache, wantRequests, wantConditional)
+		}
+	}
+
+	get("/etag", "/etag 1", "miss", 1, 0)
+	get("/etag", "/etag 1", "hit", 0, 0)
+	// Once it is out of date, the server is asked whether it changed.
+	age(t, cache, ts.URL+"/etag", 2*time.Hour)
+	get("/etag", "/etag 1", "revalidated", 1, 1)
+	get("/etag", "/etag 1", "hit", 0, 0) // revalidation made it fresh again
+	age(t, cache, ts.URL+"/etag", 2*time.Hour)
+	version = "2"
+	get("/etag", "/etag 2", "miss", 1, 1)
+	get("/etag", "/etag 2", "hit", 0, 0)
+
+	get("/modified", "modified 2", "miss", 1, 0)
+	get("/modified", "modified 2", "revalidated", 1, 1)
+
+	get("/nostore", "/nostore 2", "miss", 1, 0)
+	get("/nostore", "/nostore 2", "miss", 1, 0)
+	get("/plain", "/plain 2", "miss", 1, 0)
+	get("/plain", "/plain 2", "miss", 1, 0)
+	get("/missing", "404 page not found\n", "miss", 1, 0)
+
+	// A response that is not read to the end is not stored.
+	version = "3"
+	age(t, cache, ts.URL+"/etag", 2*time.Hour)
+	resp, err := client.Get(ts.URL + "/etag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.CopyN(ioutil.Discard, resp.Body, 2)
+	resp.Body.Close()
+	get("/etag", "/etag 3", "miss", 1, 1)
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 { // /etag and /modified
+		t.Errorf("cache has %d files, want 2", len(files))
+	}
+	// Clear removes the responses and any leftover temporary file,
+	// but not other files.
+	ioutil.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0666)
+	ioutil.WriteFile(filepath.Join(dir, "tmp.txt"), nil, 0666)
+	ioutil.WriteFile(filepath.Join(dir, tmpPrefix+"123"), nil, 0666)
+	if err := cache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ = ioutil.ReadDir(dir)
+	if len(files) != 2 || files[0].Name() != "notes.txt" || files[1].Name() != "tmp.txt" {
+		t.Errorf("after Clear, cache has %d files, want only notes.txt and tmp.txt", len(files))
+	}
+	get("/etag", "/etag 3", "miss", 1, 0)
+}
+
+// age makes the cached response to url older by d.
+func age(t *testing.T, c *Cache, url string, d time.Duration) {
+	name := c.name(url)
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	then := info.ModTime().Add(-d)
+	if err := os.Chtimes(name, then, then); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheOptions(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.html")
+	if err := ioutil.WriteFile(file, []byte("offline"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []CacheOptions{{Dir: dir}, {Dir: dir, Bypass: true}} {
+		client, err := opts.Client()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get("file://" + filepath.ToSlash(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "offline" {
+			t.Errorf("%+v: got %q, want %q", opts, body, "offline")
+		}
+	}
+}
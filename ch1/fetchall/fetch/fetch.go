@@ -0,0 +1,300 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Package fetch fetches many URLs concurrently, within limits on the
+// time of each request and on the number in flight, in all and to
+// each host. It retries requests that fail for reasons that may pass,
+// and reports how long each took in DNS lookup, connection and the
+// wait for the first byte.
+//
+// It also provides Cache, which keeps fetched pages on disk and fetches
+// them again only if they have changed, for the fetch programs.
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// A Fetcher fetches URLs. Its fields must not be changed once it is in
+// use. The zero value fetches with no limits and no retries.
+type Fetcher struct {
+	Client      *http.Client  // or nil for http.DefaultClient
+	Timeout     time.Duration // of each attempt, reading the body included; 0 for none
+	Concurrency int           // most requests in flight; 0 for no limit
+	PerHost     int           // most requests in flight to a host; 0 for no limit
+	Retries     int           // most retries of a request that fails with a 5xx status or a network error
+	Backoff     time.Duration // delay before the first retry, doubled for each one after
+	MaxBackoff  time.Duration // greatest delay between retries; 0 for no limit
+
+	once  sync.Once
+	all   chan struct{}            // a token for each request in flight
+	mu    sync.Mutex               // guards hosts and rng
+	hosts map[string]chan struct{} // by host, a token for each request in flight to it
+	rng   *rand.Rand               // for jitter
+}
+
+// A Result is the outcome of fetching a URL.
+type Result struct {
+	URL      string
+	Status   int   // of the last response, or 0 if none
+	Bytes    int64 // in the body of the last response
+	Attempts int
+	Err      error // of the last attempt, or nil if it got a whole response
+
+	transient bool // Err is from the network, and may pass
+
+	// The times taken by the last attempt. DNS and Connect are zero if
+	// it reused a connection, and TLS if it used none.
+	DNS     time.Duration // to look up the host
+	Connect time.Duration // to connect to it
+	TLS     time.Duration // for the TLS handshake
+	TTFB    time.Duration // from the start of the request to the first byte of the response
+	Total   time.Duration // of all attempts and the delays between them
+}
+
+func (f *Fetcher) init() {
+	f.once.Do(func() {
+		if f.Concurrency > 0 {
+			f.all = make(chan struct{}, f.Concurrency)
+		}
+		f.hosts = make(map[string]chan struct{})
+		f.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	})
+}
+
+// FetchAll fetches urls concurrently, and returns their results in the
+// same order.
+func (f *Fetcher) FetchAll(ctx context.Context, urls []string) []*Result {
+	results := make([]*Result, len(urls))
+
+	// 【Go vs Java】创建channel
+	// Java:  CountDownLatch done = new CountDownLatch(urls.size());
+	// Go:    done := make(chan struct{})
+	// 注意：channel是Go的核心并发原语，用于goroutine间通信
+	done := make(chan struct{})
+	for i, url := range urls {
+		// 【Go vs Java】启动并发任务
+		// Java:  executor.submit(() -> { results[i] = fetch(url); done.countDown(); });
+		// Go:    go func(i int, url string) { ... }(i, url)
+		// 注意：i和url作为参数传入，每个goroutine得到自己的副本；
+		//      不同goroutine写切片的不同元素，不需要加锁
+		go func(i int, url string) {
+			results[i] = f.Fetch(ctx, url)
+			done <- struct{}{}
+		}(i, url) // start a goroutine
+	}
+	// 注意：<-done 从channel接收数据，会阻塞直到有数据
+	for range urls {
+		<-done // receive from channel done
+	}
+	return results
+}
+
+// Fetch fetches url, and discards its body. It retries it, after a
+// delay, if it fails with a 5xx status or a network error, unless ctx
+// is done.
+func (f *Fetcher) Fetch(ctx context.Context, rawurl string) *Result {
+	f.init()
+	start := time.Now()
+	r := &Result{URL: rawurl}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	for {
+		r.Attempts++
+		f.attempt(ctx, u, r)
+		if !retry(r) || r.Attempts > f.Retries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(f.backoff(r.Attempts)):
+		case <-ctx.Done():
+		}
+	}
+	r.Total = time.Since(start)
+	return r
+}
+
+// retry reports whether an attempt that gave r may succeed if retried.
+func retry(r *Result) bool {
+	if r.Err != nil {
+		return r.transient
+	}
+	return r.Status >= 500
+}
+
+// isNetwork reports whether err, from a client's Do method, is a
+// failure of the network or of the server's connection, rather than
+// a problem with the request, such as an unsupported scheme.
+func isNetwork(err error) bool {
+	var uerr *url.Error
+	if !errors.As(err, &uerr) {
+		return false
+	}
+	// A *url.Error is itself a net.Error, so look at the one it wraps.
+	var nerr net.Error
+	return errors.As(uerr.Err, &nerr) ||
+		errors.Is(uerr.Err, io.EOF) || errors.Is(uerr.Err, io.ErrUnexpectedEOF)
+}
+
+// backoff returns the delay before retry n, counting from 1: it grows
+// exponentially, and is chosen at random from its upper half, so that
+// clients that failed together do not retry together.
+func (f *Fetcher) backoff(n int) time.Duration {
+	d := f.Backoff
+	// Stop doubling before d overflows, even with no MaxBackoff.
+	for i := 1; i < n && (f.MaxBackoff == 0 || d < f.MaxBackoff) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if f.MaxBackoff > 0 && d > f.MaxBackoff {
+		d = f.MaxBackoff
+	}
+	if d <= 1 {
+		return d
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return d/2 + time.Duration(f.rng.Int63n(int64(d/2)+1))
+}
+
+// acquire waits for a turn to send a request to host, and returns a
+// function that ends it, or an error if ctx is done first.
+func (f *Fetcher) acquire(ctx context.Context, host string) (release func(), err error) {
+	// Take the token for the host before the one for all hosts, so as
+	// not to hold up requests to other hosts while waiting for this one.
+	var hostc chan struct{}
+	if f.PerHost > 0 {
+		f.mu.Lock()
+		hostc = f.hosts[host]
+		if hostc == nil {
+			hostc = make(chan struct{}, f.PerHost)
+			f.hosts[host] = hostc
+		}
+		f.mu.Unlock()
+		select {
+		case hostc <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if f.all != nil {
+		select {
+		case f.all <- struct{}{}:
+		case <-ctx.Done():
+			if hostc != nil {
+				<-hostc
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return func() {
+		if f.all != nil {
+			<-f.all
+		}
+		if hostc != nil {
+			<-hostc
+		}
+	}, nil
+}
+
+// attempt makes one attempt to fetch u, and records its outcome in r.
+func (f *Fetcher) attempt(ctx context.Context, u *url.URL, r *Result) {
+	r.Status, r.Bytes, r.Err, r.transient = 0, 0, nil, false
+	r.DNS, r.Connect, r.TLS, r.TTFB = 0, 0, 0, 0
+
+	release, err := f.acquire(ctx, u.Host)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	defer release()
+
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	var t timings
+	defer t.copy(r)
+	req, err := http.NewRequestWithContext(t.trace(ctx), "GET", u.String(), nil)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		r.Err, r.transient = err, isNetwork(err)
+		return
+	}
+	r.Status = resp.StatusCode
+	r.Bytes, err = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close() // don't leak resources
+	if err != nil {
+		r.Err, r.transient = fmt.Errorf("while reading %s: %v", r.URL, err), true
+	}
+}
+
+// timings records the times taken by a request. The transport may call
+// its hooks from other goroutines, even after the request is done, so
+// they hold a lock.
+type timings struct {
+	mu                                   sync.Mutex
+	start, dnsStart, connStart, tlsStart time.Time
+	dns, connect, tls, ttfb              time.Duration
+}
+
+// trace returns a context derived from ctx that records the times of
+// a request made with it in t, starting now.
+func (t *timings) trace(ctx context.Context) context.Context {
+	t.start = time.Now()
+	// begin records the start of a step, and since its duration.
+	begin := func(start *time.Time) {
+		t.mu.Lock()
+		if start.IsZero() { // the first of several addresses, for connections
+			*start = time.Now()
+		}
+		t.mu.Unlock()
+	}
+	since := func(start *time.Time, d *time.Duration) {
+		t.mu.Lock()
+		if !start.IsZero() {
+			*d = time.Since(*start)
+		}
+		t.mu.Unlock()
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { begin(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { since(&t.dnsStart, &t.dns) },
+		ConnectStart:         func(network, addr string) { begin(&t.connStart) },
+		ConnectDone:          func(network, addr string, err error) { since(&t.connStart, &t.connect) },
+		TLSHandshakeStart:    func() { begin(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { since(&t.tlsStart, &t.tls) },
+		GotFirstResponseByte: func() { since(&t.start, &t.ttfb) },
+	})
+}
+
+// copy copies the times recorded so far into r.
+func (t *timings) copy(r *Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r.DNS, r.Connect, r.TLS, r.TTFB = t.dns, t.connect, t.tls, t.ttfb
+}
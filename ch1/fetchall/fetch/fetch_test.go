@@ -0,0 +1,216 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky": // fails twice, then succeeds
+			if atomic.AddInt32(&calls, 1) <= 2 {
+				http.Error(w, "try again", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "hello")
+		case "/down":
+			http.Error(w, "down", http.StatusBadGateway)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	f := &Fetcher{Timeout: 50 * time.Millisecond, Retries: 3, Backoff: time.Millisecond}
+	for _, test := range []struct {
+		url      string
+		status   int
+		bytes    int64
+		attempts int
+		err      string
+	}{
+		{ts.URL + "/flaky", 200, 5, 3, ""},
+		{ts.URL + "/down", 502, 5, 4, ""},
+		{ts.URL + "/missing", 404, 19, 1, ""}, // not retried
+		{ts.URL + "/slow", 0, 0, 4, "deadline exceeded"},
+		{closed.URL, 0, 0, 4, "connection refused"},
+		{"http://[::1", 0, 0, 0, "missing ']'"},
+		{"gopher://example.com/", 0, 0, 1, "unsupported protocol scheme"}, // not retried
+	} {
+		r := f.Fetch(context.Background(), test.url)
+		if r.Status != test.status || r.Bytes != test.bytes || r.Attempts != test.attempts {
+			t.Errorf("%s: got status %d, %d bytes, %d attempts; want %d, %d, %d",
+				test.url, r.Status, r.Bytes, r.Attempts, test.status, test.bytes, test.attempts)
+		}
+		if test.err == "" && r.Err != nil || test.err != "" && (r.Err == nil || !strings.Contains(r.Err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.url, r.Err, test.err)
+		}
+	}
+
+	// Retries stop when the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	f = &Fetcher{Retries: 100, Backoff: 10 * time.Millisecond}
+	if r := f.Fetch(ctx, closed.URL); r.Err == nil || r.Attempts > 20 || r.Total > time.Second {
+		t.Errorf("Fetch with canceled context: %d attempts in %v, error %v", r.Attempts, r.Total, r.Err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	f := &Fetcher{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	f.init()
+	for _, test := range []struct {
+		n   int
+		max time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	} {
+		for i := 0; i < 100; i++ {
+			if d := f.backoff(test.n); d < test.max/2 || d > test.max {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", test.n, d, test.max/2, test.max)
+			}
+		}
+	}
+}
+
+func TestBackoffUnlimited(t *testing.T) {
+	// With no MaxBackoff, the delay grows without overflowing.
+	f := &Fetcher{Backoff: time.Second}
+	f.init()
+	for _, n := range []int{40, 100, 1000} {
+		if d := f.backoff(n); d < time.Hour {
+			t.Errorf("backoff(%d) = %v, want at least an hour", n, d)
+		}
+	}
+}
+
+// TestLimits checks that no more requests are in flight at once than
+// the limits allow.
+func TestLimits(t *testing.T) {
+	// handler counts the requests in flight to each server.
+	handler := func(inFlight, most *int32) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(inFlight, 1)
+			defer atomic.AddInt32(inFlight, -1)
+			for {
+				m := atomic.LoadInt32(most)
+				if n <= m || atomic.CompareAndSwapInt32(most, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		})
+	}
+	var inFlight [2]int32
+	var most [2]int32
+	var urls []string
+	for i := range inFlight {
+		ts := httptest.NewServer(handler(&inFlight[i], &most[i]))
+		defer ts.Close()
+		for j := 0; j < 20; j++ {
+			urls = append(urls, fmt.Sprintf("%s/%d", ts.URL, j))
+		}
+	}
+
+	f := &Fetcher{Concurrency: 3, PerHost: 2}
+	results := f.FetchAll(context.Background(), urls)
+	for i, r := range results {
+		if r.URL != urls[i] || r.Status != 200 || r.Err != nil {
+			t.Errorf("result %d is %s %d %v, want %s 200", i, r.URL, r.Status, r.Err, urls[i])
+		}
+	}
+	for i := range most {
+		if most[i] > 2 {
+			t.Errorf("server %d had %d requests in flight, want at most 2", i, most[i])
+		}
+	}
+	if most[0]+most[1] < 3 {
+		t.Errorf("servers had at most %d and %d requests in flight; limits too strict", most[0], most[1])
+	}
+}
+
+func TestReport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, "hello, world\n")
+	}))
+	defer ts.Close()
+	var f Fetcher
+	results := f.FetchAll(context.Background(), []string{ts.URL, ts.URL + "/x"})
+	// httptest.Server listens on a numeric address, so there is no DNS
+	// lookup.
+	r := results[0]
+	if r.Status != 200 || r.Bytes != 13 || r.Connect == 0 || r.TTFB < 5*time.Millisecond || r.Total < r.TTFB {
+		t.Errorf("got %+v", r)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	var rec struct {
+		URL    string  `json:"url"`
+		Status int     `json:"status"`
+		TTFB   float64 `json:"ttfb_ms"`
+	}
+	if err := json.NewDecoder(&buf).Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.URL != ts.URL || rec.Status != 200 || rec.TTFB < 5 {
+		t.Errorf("WriteJSON wrote %+v", rec)
+	}
+
+	buf.Reset()
+	results[1].Err = fmt.Errorf("oops")
+	if err := WriteTable(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(strings.TrimSpace(lines[0]), "STATUS") ||
+		!strings.HasSuffix(lines[2], ts.URL+"/x: oops") {
+		t.Errorf("WriteTable wrote\n%s", buf.String())
+	}
+}
+
+// Fetch may be called from many goroutines; run with -race.
+func TestConcurrentFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") == "1" {
+			http.Error(w, "fail", http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+	f := &Fetcher{PerHost: 4, Retries: 1, Backoff: time.Millisecond, Timeout: time.Second}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f.Fetch(context.Background(), fmt.Sprintf("%s/?fail=%d", ts.URL, i%2))
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,85 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteTable writes results to w as a table, with a row for each.
+func WriteTable(w io.Writer, results []*Result) error {
+	tw := new(tabwriter.Writer).Init(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "STATUS\tBYTES\tTRIES\tDNS\tCONNECT\tTLS\tTTFB\tTOTAL\t URL\n")
+	for _, r := range results {
+		status := "-"
+		if r.Status != 0 {
+			status = fmt.Sprint(r.Status)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t %s", status, r.Bytes, r.Attempts,
+			ms(r.DNS), ms(r.Connect), ms(r.TLS), ms(r.TTFB), ms(r.Total), r.URL)
+		if r.Err != nil {
+			fmt.Fprintf(tw, ": %v", r.Err)
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+	return tw.Flush()
+}
+
+// ms formats d in milliseconds, or as "-" if it is zero.
+func ms(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fms", millis(d))
+}
+
+// WriteJSON writes results to w as JSON objects, one to a line, such as
+//
+//	{"url":"http://gopl.io","status":200,"bytes":4154,"attempts":1,
+//	 "dns_ms":1.2,"connect_ms":95.6,"tls_ms":0,"ttfb_ms":190.3,"total_ms":191}
+//
+// with "error" added if there was one.
+func WriteJSON(w io.Writer, results []*Result) error {
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		rec := struct {
+			URL      string  `json:"url"`
+			Status   int     `json:"status"`
+			Bytes    int64   `json:"bytes"`
+			Attempts int     `json:"attempts"`
+			DNS      float64 `json:"dns_ms"`
+			Connect  float64 `json:"connect_ms"`
+			TLS      float64 `json:"tls_ms"`
+			TTFB     float64 `json:"ttfb_ms"`
+			Total    float64 `json:"total_ms"`
+			Error    string  `json:"error,omitempty"`
+		}{
+			URL:      r.URL,
+			Status:   r.Status,
+			Bytes:    r.Bytes,
+			Attempts: r.Attempts,
+			DNS:      millis(r.DNS),
+			Connect:  millis(r.Connect),
+			TLS:      millis(r.TLS),
+			TTFB:     millis(r.TTFB),
+			Total:    millis(r.Total),
+		}
+		if r.Err != nil {
+			rec.Error = r.Err.Error()
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// millis returns d in milliseconds, to the nearest microsecond.
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -5,93 +5,75 @@
 //!+
 
 // Fetchall fetches URLs in parallel and reports their times and sizes.
+//
+// It limits the time of each request and the number in flight, retries
+// requests that fail with a 5xx status or a network error, and reports
+// the times taken in DNS lookup, connection and the wait for the first
+// byte, as a table or as JSON.
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"time" // 时间处理包
+
+	"gopl.io/ch1/fetchall/fetch"
+)
+
+// 【Go vs Java】命令行参数
+// Java:  手动解析args，或使用第三方库（如picocli）
+// Go:    标准库flag包，flag.Duration可直接解析 "10s"、"500ms" 这样的时长
+var (
+	timeout     = flag.Duration("timeout", 30*time.Second, "time limit of each attempt to fetch a URL")
+	concurrency = flag.Int("c", 10, "most requests in flight; 0 for no limit")
+	perHost     = flag.Int("per-host", 2, "most requests in flight to each host; 0 for no limit")
+	retries     = flag.Int("retries", 2, "most retries of a request that fails with a 5xx status or a network error")
+	backoff     = flag.Duration("backoff", 500*time.Millisecond, "delay before the first retry, doubled for each one after")
+	format      = flag.String("format", "table", "report as a table or as json")
 )
 
 // main 并发获取多个URL，统计时间和大小
 // 【Go vs Java】并发模型对比
 // Java:  ExecutorService + Future 或 CompletableFuture
-// Go:    goroutine + channel（更轻量、更简洁）
+// Go:    goroutine + channel（更轻量、更简洁），见 fetch.FetchAll
 func main() {
+	flag.Parse()
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "fetchall: unknown format %q, want table or json\n", *format)
+		os.Exit(2)
+	}
+
 	// 【Go vs Java】记录开始时间
 	// Java:  long start = System.currentTimeMillis();
 	// Go:    start := time.Now()
 	start := time.Now()
 
-	// 【Go vs Java】创建channel
-	// Java:  BlockingQueue<String> queue = new LinkedBlockingQueue<>();
-	// Go:    ch := make(chan string)
-	// 注意：channel是Go的核心并发原语，用于goroutine间通信
-	ch := make(chan string)
-
-	// 为每个URL启动一个goroutine
-	for _, url := range os.Args[1:] {
-		// 【Go vs Java】启动并发任务
-		// Java:  executor.submit(() -> fetch(url, queue));
-		// Go:    go fetch(url, ch)
-		// 注意：go关键字启动goroutine，比Java线程轻量得多（几KB栈空间）
-		go fetch(url, ch) // start a goroutine
-	}
-
-	// 等待所有goroutine完成
-	// 【Go vs Java】从channel接收数据
-	// Java:  for (int i = 0; i < urls.size(); i++) { queue.take(); }
-	// Go:    for range os.Args[1:] { <-ch }
-	// 注意：<-ch 从channel接收数据，会阻塞直到有数据
-	for range os.Args[1:] {
-		fmt.Println(<-ch) // receive from channel ch
+	f := &fetch.Fetcher{
+		Timeout:     *timeout,
+		Concurrency: *concurrency,
+		PerHost:     *perHost,
+		Retries:     *retries,
+		Backoff:     *backoff,
+		MaxBackoff:  30 * time.Second,
 	}
+	results := f.FetchAll(context.Background(), flag.Args())
 
-	// 【Go vs Java】计算耗时
-	// Java:  double elapsed = (System.currentTimeMillis() - start) / 1000.0;
-	// Go:    time.Since(start).Seconds()
-	fmt.Printf("%.2fs elapsed\n", time.Since(start).Seconds())
-}
-
-// fetch 获取URL内容并通过channel发送结果
-// 【Go vs Java】channel方向
-// Java:  无对应概念
-// Go:    chan<- string 表示只能发送的channel（类型安全）
-// 注意：chan<- 是send-only，<-chan 是receive-only
-func fetch(url string, ch chan<- string) {
-	start := time.Now()
-	resp, err := http.Get(url)
-	if err != nil {
-		// 【Go vs Java】发送数据到channel
-		// Java:  queue.put(err.toString());
-		// Go:    ch <- fmt.Sprint(err)
-		// 注意：<- 是发送操作符，格式为 channel <- value
-		ch <- fmt.Sprint(err) // send to channel ch
-		return
+	var err error
+	if *format == "json" {
+		err = fetch.WriteJSON(os.Stdout, results)
+	} else {
+		err = fetch.WriteTable(os.Stdout, results)
+		// 【Go vs Java】计算耗时
+		// Java:  double elapsed = (System.currentTimeMillis() - start) / 1000.0;
+		// Go:    time.Since(start).Seconds()
+		fmt.Printf("%.2fs elapsed\n", time.Since(start).Seconds())
 	}
-
-	// 【Go vs Java】复制数据流
-	// Java:  long nbytes = resp.body().transferTo(OutputStream.nullOutputStream());
-	// Go:    nbytes, err := io.Copy(ioutil.Discard, resp.Body)
-	// 注意：ioutil.Discard 类似 /dev/null，丢弃所有写入的数据
-	nbytes, err := io.Copy(ioutil.Discard, resp.Body)
-	resp.Body.Close() // don't leak resources
-
 	if err != nil {
-		ch <- fmt.Sprintf("while reading %s: %v", url, err)
-		return
+		fmt.Fprintf(os.Stderr, "fetchall: %v\n", err)
+		os.Exit(1)
 	}
-
-	secs := time.Since(start).Seconds()
-
-	// 【Go vs Java】格式化字符串
-	// Java:  String.format("%.2fs  %7d  %s", secs, nbytes, url)
-	// Go:    fmt.Sprintf("%.2fs  %7d  %s", secs, nbytes, url)
-	// 注意：%7d 表示右对齐，宽度为7
-	ch <- fmt.Sprintf("%.2fs  %7d  %s", secs, nbytes, url)
 }
 
 //!-
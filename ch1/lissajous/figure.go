@@ -0,0 +1,174 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// A figure is an animation of a Lissajous figure, x = sin(t) and
+// y = sin(t*freq + phase), whose phase increases from frame to frame.
+// Its fields may be set by the URL parameters named in their tags,
+// within the bounds given there.
+type figure struct {
+	Cycles     float64 `http:"cycles" min:"0.1" max:"100"`   // number of complete x oscillator revolutions
+	Res        float64 `http:"res" min:"0.0001" max:"1"`     // angular resolution
+	Size       int     `http:"size" min:"8" max:"1000"`      // image canvas covers [-size..+size]
+	Frames     int     `http:"nframes" min:"1" max:"500"`    // number of animation frames
+	Delay      int     `http:"delay" min:"0" max:"1000"`     // delay between frames in 10ms units
+	Freq       float64 `http:"freq" min:"0" max:"100"`       // relative frequency of y oscillator
+	PhaseStep  float64 `http:"phase" min:"-3.15" max:"3.15"` // change of phase between frames
+	Background string  `http:"bg"`                           // color, as #rrggbb
+	Foreground string  `http:"fg"`                           // color of the curve, as #rrggbb
+	Format     string  `http:"format"`                       // "gif", "svg", or "png" for one frame
+	Frame      int     `http:"frame" min:"0" max:"499"`      // the frame drawn as PNG
+}
+
+// Limits on the work of drawing a figure, beyond those on each field.
+const (
+	maxPoints    = 20e6 // points plotted in all frames, which bounds the time taken
+	maxPixels    = 50e6 // pixels in all frames, which bounds the memory used
+	maxSVGPoints = 1e6  // points in the paths of an SVG animation, which bounds its size
+	svgRes       = 0.01 // the SVG joins points by lines, so needs no finer resolution
+)
+
+// defaultFigure returns the figure of the original program, with a
+// random frequency.
+func defaultFigure() *figure {
+	// 【Go vs Java】随机浮点数
+	// Java:  double freq = rand.nextDouble() * 3.0;
+	// Go:    freq := rand.Float64() * 3.0
+	return &figure{
+		Cycles:     5,
+		Res:        0.001,
+		Size:       100,
+		Frames:     64,
+		Delay:      8,
+		Freq:       rand.Float64() * 3.0,
+		PhaseStep:  0.1,
+		Background: "#ffffff",
+		Foreground: "#000000",
+		Format:     "gif",
+	}
+}
+
+// check reports whether f is one that may be drawn.
+func (f *figure) check() error {
+	if _, err := f.palette(); err != nil {
+		return err
+	}
+	points := f.Cycles * 2 * math.Pi / f.Res
+	pixels := float64(2*f.Size+1) * float64(2*f.Size+1)
+	switch f.Format {
+	case "gif":
+		if points*float64(f.Frames) > maxPoints {
+			return fmt.Errorf("too many points: cycles / res * nframes must be at most %.0f", maxPoints/(2*math.Pi))
+		}
+		if pixels*float64(f.Frames) > maxPixels {
+			return fmt.Errorf("too many pixels: (2*size+1)² * nframes must be at most %.0f", float64(maxPixels))
+		}
+	case "svg":
+		svgPoints := f.Cycles * 2 * math.Pi / math.Max(f.Res, svgRes)
+		if svgPoints*float64(f.Frames) > maxSVGPoints {
+			return fmt.Errorf("too many points for SVG: cycles / max(res, %g) * nframes must be at most %.0f",
+				svgRes, maxSVGPoints/(2*math.Pi))
+		}
+	case "png":
+		if points > maxPoints {
+			return fmt.Errorf("too many points: cycles / res must be at most %.0f", maxPoints/(2*math.Pi))
+		}
+		if f.Frame >= f.Frames {
+			return fmt.Errorf("no frame %d of %d", f.Frame, f.Frames)
+		}
+	default:
+		return fmt.Errorf("unknown format %q, want gif, svg or png", f.Format)
+	}
+	return nil
+}
+
+// palette returns the background and foreground colors of f.
+func (f *figure) palette() (color.Palette, error) {
+	bg, err := parseColor(f.Background)
+	if err != nil {
+		return nil, fmt.Errorf("bg: %v", err)
+	}
+	fg, err := parseColor(f.Foreground)
+	if err != nil {
+		return nil, fmt.Errorf("fg: %v", err)
+	}
+	return color.Palette{bg, fg}, nil
+}
+
+// parseColor parses a color written as #rrggbb.
+func parseColor(s string) (color.RGBA, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("bad color %q, want #rrggbb", s)
+	}
+	rgb, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("bad color %q, want #rrggbb", s)
+	}
+	return color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 0xff}, nil
+}
+
+// trace calls plot for the points of the curve with the given phase,
+// in steps of res, on the canvas [-size..+size].
+func (f *figure) trace(phase, res float64, plot func(x, y float64)) {
+	size := float64(f.Size)
+	for t := 0.0; t < f.Cycles*2*math.Pi; t += res {
+		x := math.Sin(t)
+		y := math.Sin(t*f.Freq + phase)
+		plot(x*size, y*size)
+	}
+}
+
+// frame returns frame i of the animation. f must have been checked.
+func (f *figure) frame(i int) *image.Paletted {
+	palette, _ := f.palette()
+	rect := image.Rect(0, 0, 2*f.Size+1, 2*f.Size+1)
+	img := image.NewPaletted(rect, palette)
+	f.trace(float64(i)*f.PhaseStep, f.Res, func(x, y float64) {
+		// 【Go vs Java】类型转换
+		// Java:  (int)(x * size + 0.5)
+		// Go:    int(x*size + 0.5)
+		// 注意：Go的类型转换是 Type(value)，不是 (Type)value
+		img.SetColorIndex(f.Size+int(x+0.5), f.Size+int(y+0.5), blackIndex)
+	})
+	return img
+}
+
+// writeGIF writes the animation of f as a GIF.
+func (f *figure) writeGIF(out io.Writer) error {
+	// 【Go vs Java】结构体字面量
+	// Java:  GIF anim = new GIF(); anim.setLoopCount(nframes);
+	// Go:    anim := gif.GIF{LoopCount: nframes}
+	// 注意：Go的结构体可以用{字段名: 值}初始化
+	anim := gif.GIF{LoopCount: f.Frames}
+	for i := 0; i < f.Frames; i++ {
+		// 【Go vs Java】append追加元素
+		// Java:  anim.delays.add(delay);
+		// Go:    anim.Delay = append(anim.Delay, delay)
+		// 注意：append是内置函数，返回新切片，必须赋值回去
+		anim.Delay = append(anim.Delay, f.Delay)
+		anim.Image = append(anim.Image, f.frame(i))
+	}
+	// 【Go vs Java】取地址操作符
+	// Java:  GIF.encodeAll(out, anim);
+	// Go:    gif.EncodeAll(out, &anim)
+	// 注意：&取地址，传递指针避免复制大结构体
+	return gif.EncodeAll(out, &anim)
+}
+
+// writePNG writes frame f.Frame of the animation as a PNG.
+func (f *figure) writePNG(out io.Writer) error {
+	return png.Encode(out, f.frame(f.Frame))
+}
@@ -0,0 +1,117 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func get(url string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	serveFigure(rec, httptest.NewRequest("GET", url, nil))
+	return rec
+}
+
+func TestGIF(t *testing.T) {
+	rec := get("/?size=20&nframes=3&delay=5&freq=2&bg=%23000000&fg=%2300ff00")
+	if rec.Code != 200 || rec.Header().Get("Content-Type") != "image/gif" {
+		t.Fatalf("got %d %s\n%s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	anim, err := gif.DecodeAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 || anim.Delay[0] != 5 {
+		t.Fatalf("got %d frames, delay %d; want 3, 5", len(anim.Image), anim.Delay[0])
+	}
+	img := anim.Image[0]
+	if b := img.Bounds(); b.Dx() != 41 || b.Dy() != 41 {
+		t.Errorf("frame is %v, want 41 × 41", b)
+	}
+	// At t = 0, the curve is at the center, and no curve reaches a
+	// corner.
+	green, black := color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 0, 255}
+	if got := color.RGBAModel.Convert(img.At(20, 20)); got != green {
+		t.Errorf("center is %v, want %v", got, green)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != black {
+		t.Errorf("corner is %v, want %v", got, black)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	// With freq 1 and phase 0, the curve is the diagonal y = x. As
+	// in the original program, coordinates are rounded toward the
+	// center, so it does not reach the top left corner.
+	rec := get("/?format=png&size=10&freq=1&phase=0.5&frame=0")
+	if rec.Code != 200 || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("got %d %s\n%s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= 20; i++ {
+		for j := 0; j <= 20; j++ {
+			r, _, _, _ := img.At(i, j).RGBA()
+			if onCurve := r == 0; onCurve != (i == j && i > 0) {
+				t.Errorf("pixel (%d, %d) on curve: %t", i, j, onCurve)
+			}
+		}
+	}
+}
+
+func TestSVG(t *testing.T) {
+	rec := get("/?format=svg&size=10&nframes=4&delay=0&fg=%23ff0000")
+	if rec.Code != 200 || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("got %d %s\n%s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	var svg struct {
+		ViewBox string `xml:"viewBox,attr"`
+		Path    struct {
+			Stroke  string `xml:"stroke,attr"`
+			D       string `xml:"d,attr"`
+			Animate struct {
+				Dur    string `xml:"dur,attr"`
+				Values string `xml:"values,attr"`
+			} `xml:"animate"`
+		} `xml:"path"`
+	}
+	if err := xml.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&svg); err != nil {
+		t.Fatalf("%v\n%s", err, rec.Body)
+	}
+	if svg.ViewBox != "0 0 21 21" || svg.Path.Stroke != "#ff0000" || svg.Path.Animate.Dur != "40ms" {
+		t.Errorf("got viewBox %q, stroke %q, dur %q", svg.ViewBox, svg.Path.Stroke, svg.Path.Animate.Dur)
+	}
+	frames := strings.Split(svg.Path.Animate.Values, ";")
+	if len(frames) != 4 || frames[0] != svg.Path.D || !strings.HasPrefix(svg.Path.D, "M10.5 ") {
+		t.Errorf("got %d frames, first path %.20q...", len(frames), svg.Path.D)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	for _, test := range []struct{ query, want string }{
+		{"size=2000", "bad query: size: 2000 is greater than the maximum 1000"},
+		{"res=0", "bad query: res: 0 is less than the minimum 0.0001"},
+		{"nframes=x", "bad query: nframes: "},
+		{"fg=red", `fg: bad color "red", want #rrggbb`},
+		{"format=jpeg", `unknown format "jpeg", want gif, svg or png`},
+		{"cycles=100&res=0.0001", "too many points: "},
+		{"size=1000&nframes=100", "too many pixels: "},
+		{"format=svg&cycles=100&nframes=500", "too many points for SVG: "},
+		{"format=png&frame=64", "no frame 64 of 64"},
+	} {
+		rec := get("/?" + test.query)
+		if rec.Code != 400 || !strings.HasPrefix(rec.Body.String(), test.want) {
+			t.Errorf("%s: got %d %s, want 400 %s", test.query, rec.Code, rec.Body, test.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// writeSVG writes the animation of f as an SVG image, whose curve is a
+// path that SMIL animation changes from frame to frame.
+func (f *figure) writeSVG(out io.Writer) error {
+	side := 2*f.Size + 1
+	// A GIF with a delay of 0 shows each frame as briefly as the
+	// browser allows; here, that is 10ms.
+	delay := f.Delay
+	if delay == 0 {
+		delay = 1
+	}
+	dur := f.Frames * 10 * delay // milliseconds
+
+	bw := bufio.NewWriter(out)
+	fmt.Fprintf(bw, "<svg xmlns='http://www.w3.org/2000/svg' "+
+		"width='%d' height='%d' viewBox='0 0 %d %d'>\n", side, side, side, side)
+	fmt.Fprintf(bw, "<rect width='100%%' height='100%%' fill='%s'/>\n", f.Background)
+	fmt.Fprintf(bw, "<path fill='none' stroke='%s' stroke-width='1' d='%s'>\n",
+		f.Foreground, f.path(0))
+	if f.Frames > 1 {
+		fmt.Fprintf(bw, "<animate attributeName='d' dur='%dms' repeatCount='indefinite' "+
+			"calcMode='discrete' values='", dur)
+		for i := 0; i < f.Frames; i++ {
+			if i > 0 {
+				bw.WriteString(";")
+			}
+			bw.WriteString(f.path(i))
+		}
+		bw.WriteString("'/>\n")
+	}
+	bw.WriteString("</path>\n</svg>\n")
+	return bw.Flush()
+}
+
+// path returns the SVG path data of frame i, whose points are at the
+// centers of the pixels of the GIF.
+func (f *figure) path(i int) string {
+	var buf []byte
+	cmd := byte('M')
+	f.trace(float64(i)*f.PhaseStep, math.Max(f.Res, svgRes), func(x, y float64) {
+		buf = append(buf, cmd)
+		buf = strconv.AppendFloat(buf, math.Round((float64(f.Size)+x+0.5)*10)/10, 'f', -1, 64)
+		buf = append(buf, ' ')
+		buf = strconv.AppendFloat(buf, math.Round((float64(f.Size)+y+0.5)*10)/10, 'f', -1, 64)
+		cmd = 'L'
+	})
+	return string(buf)
+}
@@ -18,6 +18,10 @@ import (
 
 // Unpack populates the fields of the struct pointed to by ptr
 // from the HTTP request parameters in req.
+//
+// The value of a numeric field may be limited by min and max tags,
+// as in `http:"n" min:"1" max:"100"`; a parameter outside those
+// bounds is an error.
 func Unpack(req *http.Request, ptr interface{}) error {
 	if err := req.ParseForm(); err != nil {
 		return err
@@ -25,6 +29,7 @@ func Unpack(req *http.Request, ptr interface{}) error {
 
 	// Build map of fields keyed by effective name.
 	fields := make(map[string]reflect.Value)
+	tags := make(map[string]reflect.StructTag)
 	v := reflect.ValueOf(ptr).Elem() // the struct variable
 	for i := 0; i < v.NumField(); i++ {
 		fieldInfo := v.Type().Field(i) // a reflect.StructField
@@ -34,6 +39,7 @@ func Unpack(req *http.Request, ptr interface{}) error {
 			name = strings.ToLower(fieldInfo.Name)
 		}
 		fields[name] = v.Field(i)
+		tags[name] = tag
 	}
 
 	// Update struct field for each parameter in the request.
@@ -48,11 +54,17 @@ func Unpack(req *http.Request, ptr interface{}) error {
 				if err := populate(elem, value); err != nil {
 					return fmt.Errorf("%s: %v", name, err)
 				}
+				if err := check(elem, tags[name]); err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
 				f.Set(reflect.Append(f, elem))
 			} else {
 				if err := populate(f, value); err != nil {
 					return fmt.Errorf("%s: %v", name, err)
 				}
+				if err := check(f, tags[name]); err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
 			}
 		}
 	}
@@ -74,6 +86,13 @@ func populate(v reflect.Value, value string) error {
 		}
 		v.SetInt(i)
 
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
 	case reflect.Bool:
 		b, err := strconv.ParseBool(value)
 		if err != nil {
@@ -88,3 +107,34 @@ func populate(v reflect.Value, value string) error {
 }
 
 //!-populate
+
+// check reports whether the numeric value v is outside the bounds
+// given by the min and max tags, if any. NaN is outside any bounds.
+func check(v reflect.Value, tag reflect.StructTag) error {
+	var x float64
+	switch v.Kind() {
+	case reflect.Int:
+		x = float64(v.Int())
+	case reflect.Float32, reflect.Float64:
+		x = v.Float()
+	default:
+		return nil
+	}
+	for _, bound := range []string{"min", "max"} {
+		s, ok := tag.Lookup(bound)
+		if !ok {
+			continue
+		}
+		limit, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("bad %s tag %q", bound, s)
+		}
+		if bound == "min" && !(x >= limit) {
+			return fmt.Errorf("%v is less than the minimum %s", v, s)
+		}
+		if bound == "max" && !(x <= limit) {
+			return fmt.Errorf("%v is greater than the maximum %s", v, s)
+		}
+	}
+	return nil
+}
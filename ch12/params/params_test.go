@@ -0,0 +1,54 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params_test
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"gopl.io/ch12/params"
+)
+
+type query struct {
+	Labels []string  `http:"l"`
+	Max    int       `http:"max" min:"1" max:"100"`
+	Scale  float64   `http:"scale" min:"0"`
+	Angles []float32 `max:"360"`
+	Exact  bool      `http:"x"`
+}
+
+func TestUnpack(t *testing.T) {
+	tests := []struct {
+		query string
+		want  query
+		err   string
+	}{
+		{"l=a&l=b&max=5&x=true", query{Labels: []string{"a", "b"}, Max: 5, Exact: true}, ""},
+		{"scale=2.5&angles=30&angles=-45.5", query{Max: 10, Scale: 2.5, Angles: []float32{30, -45.5}}, ""},
+		{"unknown=1", query{Max: 10}, ""},
+		{"max=0", query{}, "max: 0 is less than the minimum 1"},
+		{"max=101", query{}, "max: 101 is greater than the maximum 100"},
+		{"scale=-1e-9", query{}, "scale: -1e-09 is less than the minimum 0"},
+		{"scale=NaN", query{}, "scale: NaN is less than the minimum 0"},
+		{"angles=400", query{}, "angles: 400 is greater than the maximum 360"},
+		{"scale=big", query{}, `scale: strconv.ParseFloat: parsing "big": invalid syntax`},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/?"+test.query, nil)
+		got := query{Max: 10} // default
+		err := params.Unpack(req, &got)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Unpack(%s): got error %v, want %s", test.query, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unpack(%s): %v", test.query, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Unpack(%s) = %+v, want %+v", test.query, got, test.want)
+		}
+	}
+}
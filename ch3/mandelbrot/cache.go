@@ -0,0 +1,90 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// A tile is a square of the map at zoom level z, in column x and row
+// y, which are integers in decimal, of the fractal chosen by settings.
+type tile struct {
+	z        int
+	x, y     string
+	settings settings
+}
+
+// A tileCache is a concurrency-safe cache of the encoded images of up
+// to max recently used tiles. As in gopl.io/ch9/memo4, a request for a
+// tile that is being rendered waits for it rather than rendering it
+// again.
+type tileCache struct {
+	render func(t tile, f fractal) []byte
+
+	mu      sync.Mutex
+	max     int
+	entries map[tile]*list.Element // values are *entry
+	lru     *list.List             // most recently used first
+}
+
+type entry struct {
+	key   tile
+	png   []byte
+	err   error         // if rendering failed
+	ready chan struct{} // closed when png or err is ready
+}
+
+func newTileCache(max int, render func(t tile, f fractal) []byte) *tileCache {
+	return &tileCache{
+		render:  render,
+		max:     max,
+		entries: make(map[tile]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get returns the image of tile t, rendering it from f, the fractal
+// of t.settings, if it is not in the cache, and whether it was.
+// If rendering panics, get reports the failure to each caller waiting
+// for the tile, and forgets the tile so that it is rendered afresh
+// next time.
+func (c *tileCache) get(t tile, f fractal) (png []byte, hit bool, err error) {
+	c.mu.Lock()
+	if el := c.entries[t]; el != nil {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		e := el.Value.(*entry)
+		<-e.ready // wait for the tile to be rendered
+		return e.png, true, e.err
+	}
+	e := &entry{key: t, ready: make(chan struct{})}
+	c.entries[t] = c.lru.PushFront(e)
+	// 【Go vs Java】LRU 缓存
+	// Java:  new LinkedHashMap<>(16, 0.75f, true) { removeEldestEntry(...) }
+	// Go:    没有现成的 LRU，用 map 加 container/list 双向链表自己实现
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		if x := recover(); x != nil {
+			e.err = fmt.Errorf("rendering tile %d/%s/%s: %v", t.z, t.x, t.y, x)
+			c.mu.Lock()
+			if el := c.entries[t]; el != nil && el.Value == e {
+				c.lru.Remove(el)
+				delete(c.entries, t)
+			}
+			c.mu.Unlock()
+			png, err = nil, e.err
+		}
+		close(e.ready) // broadcast ready condition
+	}()
+	e.png = c.render(t, f)
+	return e.png, false, nil
+}
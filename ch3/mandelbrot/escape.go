@@ -0,0 +1,245 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"image/color"
+	"math"
+	"math/big"
+)
+
+// A fractal colors the points of the complex plane.
+type fractal interface {
+	// near returns a function that colors the points near the
+	// center (re, im), given by their offsets from it, when the
+	// points to be colored are about pixel apart. It must be safe
+	// to call concurrently.
+	near(re, im *big.Float, pixel float64) func(d complex128) color.Color
+}
+
+// A plain fractal is a coloring function, which is computed in
+// float64 arithmetic and so cannot be zoomed into deeply.
+type plain func(c complex128) color.Color
+
+func (f plain) near(re, im *big.Float, pixel float64) func(d complex128) color.Color {
+	c0 := complex128Of(re, im)
+	return func(d complex128) color.Color { return f(c0 + d) }
+}
+
+// An escapeTime fractal colors each point outside it by the number of
+// iterations of a map, from a starting point, before the orbit escapes.
+type escapeTime struct {
+	iterations int      // maximum number, or 0 for more the deeper the zoom
+	smooth     bool     // shade the fractional number of iterations
+	palette    *palette // or nil for the greys of the original program
+}
+
+// A mandelbrotSet is the Mandelbrot set, of the points c whose orbits
+// under z = z*z + c, from z = 0, do not escape. Deep zooms are computed
+// by perturbation, in float64, of an orbit computed in arbitrary
+// precision.
+type mandelbrotSet struct{ escapeTime }
+
+// A juliaSet is the filled Julia set of c, of the points z whose orbits
+// under z = z*z + c do not escape.
+type juliaSet struct {
+	escapeTime
+	c complex128
+}
+
+// A burningShip is like the Mandelbrot set, but for the map
+// z = (|Re z| + |Im z|i)² + c.
+type burningShip struct{ escapeTime }
+
+const (
+	contrast  = 15    // change of grey per iteration
+	deepPixel = 1e-12 // smaller pixels need perturbation
+)
+
+// autoIterations returns the number of iterations for points pixel
+// apart: 200 for the whole set in 1024 pixels, and 50 more each time
+// the zoom doubles.
+func autoIterations(pixel float64) int {
+	doublings := math.Log2(4.0 / 1024 / pixel)
+	return 200 + int(50*math.Max(0, doublings))
+}
+
+// precision returns the number of bits needed to tell apart points
+// pixel apart in [-2, 2], with room for the errors of iteration.
+func precision(pixel float64) uint {
+	return uint(math.Max(64, 64-math.Logb(pixel)))
+}
+
+// limits returns the number of iterations for points pixel apart, and
+// the radius beyond which an orbit has escaped.
+func (e escapeTime) limits(pixel float64) (iterations int, bailout float64) {
+	iterations = e.iterations
+	if iterations == 0 {
+		iterations = autoIterations(pixel)
+	}
+	// Smooth shading needs a larger bailout radius, beyond which
+	// z grows so fast that log log |z| is nearly linear in n.
+	if e.smooth {
+		return iterations, 256
+	}
+	return iterations, 2
+}
+
+func (m mandelbrotSet) near(re, im *big.Float, pixel float64) func(d complex128) color.Color {
+	iterations, bailout := m.limits(pixel)
+	if pixel >= deepPixel {
+		c0 := complex128Of(re, im)
+		return func(d complex128) color.Color {
+			return m.color(escape(0, c0+d, iterations, bailout))
+		}
+	}
+	ref := newOrbit(re, im, iterations, bailout)
+	return func(d complex128) color.Color {
+		return m.color(ref.escape(d, iterations, bailout))
+	}
+}
+
+func (j juliaSet) near(re, im *big.Float, pixel float64) func(d complex128) color.Color {
+	iterations, bailout := j.limits(pixel)
+	z0 := complex128Of(re, im)
+	return func(d complex128) color.Color {
+		return j.color(escape(z0+d, j.c, iterations, bailout))
+	}
+}
+
+func (b burningShip) near(re, im *big.Float, pixel float64) func(d complex128) color.Color {
+	iterations, bailout := b.limits(pixel)
+	c0 := complex128Of(re, im)
+	return func(d complex128) color.Color {
+		c := c0 + d
+		var z complex128
+		for n := 0; n < iterations; n++ {
+			z = complex(math.Abs(real(z)), math.Abs(imag(z)))
+			z = z*z + c
+			if norm(z) > bailout*bailout {
+				return b.color(n, z, true)
+			}
+		}
+		return b.color(iterations, z, false)
+	}
+}
+
+// complex128Of returns re+im·i rounded to complex128.
+func complex128Of(re, im *big.Float) complex128 {
+	x, _ := re.Float64()
+	y, _ := im.Float64()
+	return complex(x, y)
+}
+
+// escape iterates z = z*z + c from z, and returns the first z whose
+// magnitude exceeds bailout, the number of iterations before it, and
+// true, or false if there is none within iterations.
+func escape(z, c complex128, iterations int, bailout float64) (int, complex128, bool) {
+	for n := 0; n < iterations; n++ {
+		z = z*z + c
+		if norm(z) > bailout*bailout {
+			return n, z, true
+		}
+	}
+	return iterations, z, false
+}
+
+// norm returns the square of the magnitude of z.
+func norm(z complex128) float64 { return real(z)*real(z) + imag(z)*imag(z) }
+
+// color returns the color of a point whose orbit escaped at z after
+// n iterations, as computed by escape.
+func (e escapeTime) color(n int, z complex128, escaped bool) color.Color {
+	if !escaped {
+		return color.Black
+	}
+	if !e.smooth {
+		if e.palette != nil {
+			return e.palette.at(float64(n))
+		}
+		return color.Gray{255 - contrast*uint8(n)}
+	}
+	// Count the last iteration in part, by how far z escaped: the
+	// count mu is continuous, and near n for a bailout radius of 2.
+	mu := float64(n) + 1 - math.Log2(math.Log(math.Sqrt(norm(z)))/math.Ln2)
+	if e.palette != nil {
+		return e.palette.at(math.Max(mu, 0))
+	}
+	return shade(mu)
+}
+
+// shade returns the grey for a point that escaped after mu iterations:
+// white for 0, darker by contrast for each iteration, like the bands
+// of the original program, but turning back toward white at black,
+// and vice versa, so that the shading is continuous.
+func shade(mu float64) color.Color {
+	t := math.Mod(contrast*math.Max(mu, 0), 510) // 0 to 255 and back
+	if t > 255 {
+		t = 510 - t
+	}
+	return color.Gray{uint8(math.Round(255 - t))}
+}
+
+// An orbit is the orbit of a reference point C under z = z*z + C,
+// computed in arbitrary precision and rounded to complex128, from
+// which the orbits of nearby points C+d are computed as small
+// perturbations in float64. This is the method of K. I. Martin,
+// with the rebasing of Zhuoran to avoid glitches, which arise where
+// the perturbation becomes as large as the orbit itself.
+type orbit []complex128
+
+// newOrbit returns the orbit of re+im·i, up to its first point whose
+// magnitude exceeds bailout or for the given number of iterations.
+func newOrbit(re, im *big.Float, iterations int, bailout float64) orbit {
+	prec := re.Prec()
+	if im.Prec() > prec {
+		prec = im.Prec()
+	}
+	newFloat := func() *big.Float { return new(big.Float).SetPrec(prec) }
+	x, y := newFloat(), newFloat() // z = x + y·i
+	xx, yy, xy := newFloat(), newFloat(), newFloat()
+
+	o := orbit{0}
+	for n := 0; n < iterations; n++ {
+		// z = z*z + C
+		xx.Mul(x, x)
+		yy.Mul(y, y)
+		xy.Mul(x, y)
+		x.Sub(xx, yy).Add(x, re)
+		y.Add(xy, xy).Add(y, im)
+
+		fx, _ := x.Float64()
+		fy, _ := y.Float64()
+		z := complex(fx, fy)
+		o = append(o, z)
+		if norm(z) > bailout*bailout {
+			break
+		}
+	}
+	return o
+}
+
+// escape is like the function escape for the point C+d, from 0.
+func (o orbit) escape(d complex128, iterations int, bailout float64) (n int, z complex128, escaped bool) {
+	// z = Z[m] + dz, where Z is the reference orbit.
+	var dz complex128
+	m := 0
+	for n := 0; n < iterations; n++ {
+		// z*z + C + d = (Z + dz)² + C + d = Z*Z + C + (2Z + dz)dz + d
+		dz = (2*o[m]+dz)*dz + d
+		m++
+		z = o[m] + dz
+		if norm(z) > bailout*bailout {
+			return n, z, true
+		}
+		// Rebase onto the start of the reference orbit, whose
+		// first point is 0, when z is nearer to it than to the
+		// reference, or at the end of the reference.
+		if norm(z) < norm(dz) || m == len(o)-1 {
+			dz = z
+			m = 0
+		}
+	}
+	return iterations, z, false
+}
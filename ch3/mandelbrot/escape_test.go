@@ -0,0 +1,82 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"image/color"
+	"math/big"
+	"testing"
+)
+
+// TestPerturbation checks the escape counts of points near a center,
+// computed by perturbation, against those of their own orbits computed
+// in arbitrary precision.
+func TestPerturbation(t *testing.T) {
+	for _, test := range []struct {
+		center     string
+		pixel      float64
+		iterations int
+		ds         []complex128
+	}{
+		{
+			"-0.743643887037158704752191506114774,0.131825904205311970493132056385139", 2e-22, 30000,
+			[]complex128{30 * 2e-22, 31 * 2e-22, 32 * 2e-22, 30*2e-22 + 20*2e-22i, -100*2e-22 + 50*2e-22i},
+		},
+		{
+			// This point does not escape within 1000 iterations,
+			// but does after 966 without rebasing.
+			"-1.7687788387,-0.0017389801", 1e-7, 1000,
+			[]complex128{-3.153155675544108e-05 + 2.8179037084181502e-05i},
+		},
+	} {
+		prec := 2 * precision(test.pixel)
+		re, im, err := parsePoint(test.center, prec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iterations := test.iterations
+		ref := newOrbit(re, im, iterations, 2)
+		for _, d := range test.ds {
+			got, _, _ := ref.escape(d, iterations, 2)
+			c := func(x *big.Float, dx float64) *big.Float {
+				return new(big.Float).SetPrec(prec).Add(x, big.NewFloat(dx))
+			}
+			// The orbit stops at the first point that escapes,
+			// after len-2 iterations, or else after iterations.
+			orbit := newOrbit(c(re, real(d)), c(im, imag(d)), iterations, 2)
+			want := len(orbit) - 2
+			if norm(orbit[len(orbit)-1]) <= 4 {
+				want = iterations
+			}
+			if got != want {
+				t.Errorf("%s + %v escaped after %d iterations, want %d", test.center, d, got, want)
+			}
+		}
+	}
+}
+
+func TestShade(t *testing.T) {
+	// At whole numbers of iterations, the smooth shading agrees
+	// with the bands of the original program.
+	for n := 0; n < 17; n++ {
+		if got, want := shade(float64(n)), (color.Gray{255 - contrast*uint8(n)}); got != want {
+			t.Errorf("shade(%d) = %v, want %v", n, got, want)
+		}
+	}
+	// Beyond black, it turns back toward white.
+	if got, want := shade(18), (color.Gray{contrast}); got != want {
+		t.Errorf("shade(18) = %v, want %v", got, want)
+	}
+}
+
+func TestMandelbrotSet(t *testing.T) {
+	// Without smoothing, the fractal is that of the original program.
+	zero := big.NewFloat(0)
+	colorAt := mandelbrotSet{escapeTime{iterations: 200}}.near(zero, zero, 4.0/1024)
+	for _, c := range []complex128{0, 1, -2.5, 0.3 + 0.5i, -0.75 + 0.1i} {
+		if got, want := colorAt(c), mandelbrot(c); got != want {
+			t.Errorf("color of %v = %v, want %v", c, got, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"math/big"
+	"math/cmplx"
+	"sort"
+	"strings"
+
+	"gopl.io/ch7/eval"
+)
+
+// settings choose a fractal and how to color it. They are given by the
+// command-line flags and, when serving, may be overridden by the URL
+// parameters of the same names.
+type settings struct {
+	Fractal    string `http:"fractal"`                   // name in families
+	C          string `http:"c"`                         // parameter of a Julia set, as x,y
+	Poly       string `http:"poly"`                      // polynomial in z for Newton's method
+	Expr       string `http:"expr"`                      // iteration formula in z and c
+	Iterations int    `http:"iter" min:"0" max:"100000"` // maximum number, or 0 for the default
+	Smooth     bool   `http:"smooth"`                    // shade continuously rather than in bands
+	Palette    string `http:"palette"`                   // name in palettes, or "" for greys
+}
+
+// A family is a kind of fractal, of which the settings choose one.
+type family struct {
+	doc  string
+	make func(s settings, p *palette) (fractal, error)
+}
+
+var families = map[string]family{
+	"mandelbrot": {"the Mandelbrot set, which may be zoomed into as deeply as desired",
+		func(s settings, p *palette) (fractal, error) {
+			return mandelbrotSet{escapeTime{s.Iterations, s.Smooth, p}}, nil
+		}},
+	"julia": {"the Julia set of the parameter c",
+		func(s settings, p *palette) (fractal, error) {
+			re, im, err := parsePoint(s.C, 53)
+			if err != nil {
+				return nil, fmt.Errorf("bad c: %v", err)
+			}
+			return juliaSet{escapeTime{s.Iterations, s.Smooth, p}, complex128Of(re, im)}, nil
+		}},
+	"ship": {"the Burning Ship fractal",
+		func(s settings, p *palette) (fractal, error) {
+			return burningShip{escapeTime{s.Iterations, s.Smooth, p}}, nil
+		}},
+	"newton": {"the basins of the roots of the polynomial poly under Newton's method",
+		func(s settings, p *palette) (fractal, error) {
+			return newNewton(s.Poly, s.Iterations, p)
+		}},
+	"expr": {"the fractal of the iteration formula expr in z and c",
+		func(s settings, p *palette) (fractal, error) {
+			f, err := parseFormula(s.Expr)
+			if err != nil {
+				return nil, &formulaError{"expr", s.Expr, err}
+			}
+			return plain(f), nil
+		}},
+	"acos": {"the complex arccosine", func(settings, *palette) (fractal, error) {
+		return plain(acos), nil
+	}},
+	"sqrt": {"the complex square root", func(settings, *palette) (fractal, error) {
+		return plain(sqrt), nil
+	}},
+}
+
+// familyNames returns the names of the families, sorted.
+func familyNames() []string {
+	var names []string
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// familyUsage returns the usage message of the -fractal flag.
+func familyUsage() string {
+	var buf strings.Builder
+	buf.WriteString("fractal to draw, one of")
+	for _, name := range familyNames() {
+		fmt.Fprintf(&buf, "\n  %s: %s", name, families[name].doc)
+	}
+	return buf.String()
+}
+
+// fractal returns the fractal chosen by s.
+func (s settings) fractal() (fractal, error) {
+	fam, ok := families[s.Fractal]
+	if !ok {
+		return nil, fmt.Errorf("unknown fractal %q, want one of %s",
+			s.Fractal, strings.Join(familyNames(), ", "))
+	}
+	var p *palette
+	if s.Palette != "" {
+		if p = palettes[s.Palette]; p == nil {
+			return nil, fmt.Errorf("unknown palette %q", s.Palette)
+		}
+	}
+	return fam.make(s, p)
+}
+
+// A formulaError is an error in the formula src given by the setting
+// name, which it shows marked at the place of each mistake.
+type formulaError struct {
+	name, src string
+	err       error
+}
+
+func (e *formulaError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "bad %s:\n", e.name)
+	eval.PrintError(&buf, e.src, e.err)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// A newtonMethod fractal colors each point by the number of iterations
+// of Newton's method for the roots of f, started from it, before it
+// comes within tolerance of one, as does the function newton for
+// z^4 - 1.
+type newtonMethod struct {
+	f, df      eval.Expr // f and its derivative, in z
+	iterations int
+	palette    *palette // or nil for the greys of the function newton
+}
+
+// newNewton returns the fractal of Newton's method for the polynomial
+// poly in z, with the given maximum number of iterations, or 37 if it
+// is 0.
+func newNewton(poly string, iterations int, p *palette) (fractal, error) {
+	f, err := eval.Validate(poly, nil, map[eval.Var]bool{"z": true})
+	if err != nil {
+		return nil, &formulaError{"poly", poly, err}
+	}
+	df, err := eval.Derive(f, "z")
+	if err != nil {
+		return nil, &formulaError{"poly", poly, err}
+	}
+	df = eval.Simplify(df)
+	if iterations == 0 {
+		iterations = 37
+	}
+	return newtonMethod{f, df, iterations, p}, nil
+}
+
+func (m newtonMethod) near(re, im *big.Float, pixel float64) func(d complex128) color.Color {
+	const tolerance = 1e-6
+	const contrast = 7
+	z0 := complex128Of(re, im)
+	return func(d complex128) color.Color {
+		env := eval.ComplexEnv{"z": z0 + d} // one for each call, which may be concurrent
+		fz := m.f.EvalComplex(env)
+		for i := 0; i < m.iterations; i++ {
+			// z' = z - f(z)/f'(z)
+			env["z"] -= fz / m.df.EvalComplex(env)
+			fz = m.f.EvalComplex(env)
+			if cmplx.Abs(fz) < tolerance {
+				if m.palette != nil {
+					return m.palette.at(float64(i))
+				}
+				return color.Gray{255 - contrast*uint8(i)}
+			}
+		}
+		return color.Black
+	}
+}
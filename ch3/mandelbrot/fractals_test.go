@@ -0,0 +1,100 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"image/color"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// defaults are the settings of the command-line flags by default.
+var defaults = settings{
+	Fractal: "mandelbrot",
+	C:       "-0.8,0.156",
+	Poly:    "z*z*z*z - 1",
+	Expr:    "z*z*z + c",
+	Smooth:  true,
+}
+
+// colorAt returns the function that colors the fractal chosen by s.
+func colorAt(t *testing.T, s settings) func(complex128) color.Color {
+	t.Helper()
+	f, err := s.fractal()
+	if err != nil {
+		t.Fatalf("%+v: %v", s, err)
+	}
+	zero := big.NewFloat(0)
+	return f.near(zero, zero, 4.0/1024)
+}
+
+func TestFamilies(t *testing.T) {
+	for _, name := range familyNames() {
+		for _, palette := range []string{"", "fire"} {
+			s := defaults
+			s.Fractal, s.Palette = name, palette
+			colorAt(t, s)(0.1 + 0.2i)
+		}
+	}
+
+	// The Julia set of 0 is the unit disk.
+	s := defaults
+	s.Fractal, s.C = "julia", "0,0"
+	julia := colorAt(t, s)
+	for _, z := range []complex128{0, 0.5i, -0.99} {
+		if julia(z) != color.Black {
+			t.Errorf("%v is not in the Julia set of 0", z)
+		}
+	}
+	for _, z := range []complex128{1.01, 2i, -1 - 1i} {
+		if julia(z) == color.Black {
+			t.Errorf("%v is in the Julia set of 0", z)
+		}
+	}
+
+	// On the positive real axis, the Burning Ship is the Mandelbrot set.
+	s.Fractal = "ship"
+	ship := colorAt(t, s)
+	s.Fractal = "mandelbrot"
+	mandelbrot := colorAt(t, s)
+	for _, c := range []complex128{0, 0.2, 0.25, 0.26, 0.5, 2} {
+		if got, want := ship(c), mandelbrot(c); got != want {
+			t.Errorf("ship(%v) = %v, want %v", c, got, want)
+		}
+	}
+
+	// Newton's method for the default polynomial is the function newton.
+	s.Fractal, s.Smooth = "newton", false
+	poly := colorAt(t, s)
+	for _, z := range []complex128{2, 0.5 + 0.5i, -1 + 3i, 0.1 - 0.7i, 1.7 + 1.7i} {
+		if got, want := poly(z), newton(z); got != want {
+			t.Errorf("newton(%v) = %v, want %v", z, got, want)
+		}
+	}
+	// z*z + 1 has roots ±i.
+	s.Poly = "z*z + 1"
+	poly = colorAt(t, s)
+	if got, want := poly(1i), (color.Gray{255}); got != want {
+		t.Errorf("color of root i is %v, want %v", got, want)
+	}
+}
+
+func TestSettingsErrors(t *testing.T) {
+	for _, test := range []struct {
+		s    settings
+		want string
+	}{
+		{settings{Fractal: "nope"}, `unknown fractal "nope", want one of acos, expr, `},
+		{settings{Fractal: "mandelbrot", Palette: "nope"}, `unknown palette "nope"`},
+		{settings{Fractal: "julia", C: "1"}, `bad c: bad point "1", want x,y`},
+		{settings{Fractal: "newton", Poly: "z + c"}, "bad poly:\n"},
+		{settings{Fractal: "expr", Expr: "z *"}, "bad expr:\n"},
+	} {
+		_, err := test.s.fractal()
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%+v: got %v, want %s...", test.s, err, test.want)
+		}
+	}
+}
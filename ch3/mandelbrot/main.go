@@ -5,47 +5,126 @@
 //!+
 
 // Mandelbrot emits a PNG image of the Mandelbrot fractal.
+//
+// The -center and -zoom flags choose the part of the complex plane to
+// show, as deep as desired: past the precision of float64, the orbits
+// are computed by perturbation of one in arbitrary precision. Points
+// are shaded by the fractional number of iterations before they
+// escape, or, with -smooth=false, in bands of whole iterations, and
+// -samples n averages n × n samples in each pixel.
+//
+// The -fractal flag chooses another fractal instead: the Julia set of
+// the point -c, the Burning Ship, the basins of Newton's method for
+// the roots of the polynomial -poly, or, with -expr, the fractal of
+// another iteration formula in z and c, such as z*z*z + c, or, if the
+// formula does not use z, the value of a function of c, such as
+// acos(c). These are computed in float64, and so cannot be zoomed into
+// so deeply. The -palette flag colors the points with a gradient,
+// either one of those built in or one read from a file in the format
+// described in palette.go.
+//
+// With the -http flag, it serves the fractal instead as a map that can
+// be panned and zoomed in a browser, made of the standard z/x/y tiles
+// at /tiles/z/x/y.png, which may also be fetched by other programs.
+// URL parameters named like the flags, such as ?fractal=julia&c=0,1,
+// choose another fractal.
 package main
 
 import (
+	"flag"
+	"fmt"
 	"image"
 	"image/color"
 	"image/png"
+	"log"
+	"math/big"
 	"math/cmplx"
 	"os"
+	"strings"
+
+	"gopl.io/ch7/eval"
+)
+
+var (
+	fractalName = flag.String("fractal", "mandelbrot", familyUsage())
+	juliaC      = flag.String("c", "-0.8,0.156", "parameter of the Julia set, as x,y")
+	poly        = flag.String("poly", "z*z*z*z - 1", "polynomial in z whose roots Newton's method finds")
+	expr        = flag.String("expr", "", "iteration formula in z and c, for -fractal=expr, which it implies")
+	paletteName = flag.String("palette", "", "palette: one of grey, fire, ocean, rainbow, or a file (default shades of grey)")
+	center      = flag.String("center", "0,0", "center of the image, as x,y in decimal to any number of digits")
+	zoom        = flag.Float64("zoom", 1, "magnification, at which 1 shows the square [-2, 2] × [-2, 2]")
+	size        = flag.Int("size", 1024, "width and height of the image in pixels")
+	samples     = flag.Int("samples", 1, "number of samples across each pixel, from 1 to 16")
+	iterations  = flag.Int("iter", 0, "maximum number of iterations, or 0 for the default of the fractal, more the deeper the zoom")
+	smooth      = flag.Bool("smooth", true, "shade points continuously rather than in bands")
+	httpAddr    = flag.String("http", "", "serve map tiles at this address, e.g. localhost:8000, instead of writing a PNG")
+	cacheSize   = flag.Int("cache", 4096, "number of tiles to keep in memory when serving")
 )
 
 // main 生成Mandelbrot分形图像并输出为PNG
 func main() {
-	// 【Go vs Java】多变量常量声明
-	// Java:  final double xmin = -2, ymin = -2, xmax = 2, ymax = 2;
-	// Go:    const (xmin, ymin, xmax, ymax = -2, -2, +2, +2)
-	const (
-		xmin, ymin, xmax, ymax = -2, -2, +2, +2
-		width, height          = 1024, 1024
-	)
+	flag.Parse()
+	if *samples < 1 || *samples > 16 || *iterations < 0 || !(*zoom > 0) || *size < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	s := settings{
+		Fractal:    *fractalName,
+		C:          *juliaC,
+		Poly:       *poly,
+		Expr:       *expr,
+		Iterations: *iterations,
+		Smooth:     *smooth,
+		Palette:    *paletteName,
+	}
+	// 【Go vs Java】判断命令行参数是否给出
+	// Java:  commons-cli 的 cmd.hasOption("fractal")
+	// Go:    flag.Visit 只访问命令行上实际给出的参数
+	fractalSet := false
+	flag.Visit(func(f *flag.Flag) { fractalSet = fractalSet || f.Name == "fractal" })
+	if *expr != "" && !fractalSet {
+		s.Fractal = "expr"
+	}
+	// A palette that is not built in is read from a file, and may then
+	// be chosen by the same name in URLs too.
+	if s.Palette != "" && palettes[s.Palette] == nil {
+		p, err := loadPalette(s.Palette)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mandelbrot: %v\n", err)
+			os.Exit(2)
+		}
+		palettes[s.Palette] = p
+	}
+
+	// 【Go vs Java】接口变量
+	// Java:  Fractal f = families.get(name).make(settings);
+	// Go:    f, err := s.fractal()，结构体不用声明 implements，有 near 方法就满足接口
+	f, err := s.fractal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mandelbrot: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *httpAddr != "" {
+		log.Fatal(serve(*httpAddr, s, *samples, *cacheSize))
+	}
+
+	// The image is the square of side 4/zoom around the center.
+	pixel := 4 / *zoom / float64(*size)
+	re, im, err := parsePoint(*center, precision(pixel))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mandelbrot: %v\n", err)
+		os.Exit(2)
+	}
 
 	// 【Go vs Java】创建图像
 	// Java:  BufferedImage img = new BufferedImage(width, height, TYPE_INT_ARGB);
 	// Go:    img := image.NewRGBA(image.Rect(0, 0, width, height))
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-
-	// 双层循环遍历每个像素
-	for py := 0; py < height; py++ {
-		y := float64(py)/height*(ymax-ymin) + ymin
-		for px := 0; px < width; px++ {
-			x := float64(px)/width*(xmax-xmin) + xmin
-
-			// 【Go vs Java】复数类型
-			// Java:  无内置复数类型，需要自定义类或使用Apache Commons Math
-			// Go:    complex128 是内置的复数类型（实部和虚部都是float64）
-			// 注意：complex(real, imag) 创建复数，还有complex64类型
-			z := complex(x, y)
-
-			// Image point (px, py) represents complex value z.
-			img.Set(px, py, mandelbrot(z))
-		}
-	}
+	img := image.NewRGBA(image.Rect(0, 0, *size, *size))
+
+	// As in the original program, y increases down the image.
+	render(img, f, view{re, im, pixel, pixel}, *samples)
 
 	// 【Go vs Java】编码PNG
 	// Java:  ImageIO.write(img, "PNG", System.out);
@@ -53,6 +132,26 @@ func main() {
 	png.Encode(os.Stdout, img) // NOTE: ignoring errors
 }
 
+// parsePoint 解析 "x,y" 形式的点，按给定的二进制位数精确保存
+// 【Go vs Java】任意精度浮点数
+// Java:  new BigDecimal("-0.743643887037158704752191506114774")
+// Go:    new(big.Float).SetPrec(prec).SetString(s)，精度以二进制位计
+func parsePoint(s string, prec uint) (re, im *big.Float, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("bad point %q, want x,y", s)
+	}
+	var xy [2]*big.Float
+	for i, part := range parts {
+		x, ok := new(big.Float).SetPrec(prec).SetString(strings.TrimSpace(part))
+		if !ok {
+			return nil, nil, fmt.Errorf("bad point %q, want x,y", s)
+		}
+		xy[i] = x
+	}
+	return xy[0], xy[1], nil
+}
+
 // mandelbrot 计算Mandelbrot集合的颜色
 func mandelbrot(z complex128) color.Color {
 	const iterations = 200
@@ -90,6 +189,65 @@ func mandelbrot(z complex128) color.Color {
 
 //!-
 
+// parseFormula 解析用户给出的公式，返回对应的着色函数：
+// 公式用到 z 时，像 mandelbrot 一样从 z = 0 开始迭代 z = f(z, c)，
+// 按逃逸所需的步数着色；否则像 acos、sqrt 一样按 f(c) 的值着色。
+func parseFormula(s string) (func(complex128) color.Color, error) {
+	vars := map[eval.Var]bool{"z": true, "c": true}
+	e, err := eval.Validate(s, nil, vars)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[eval.Var]bool)
+	e.Check(used)
+
+	// 【Go vs Java】闭包捕获变量
+	// Java:  lambda 只能捕获 effectively final 的变量
+	// Go:    闭包可以捕获外部变量；但着色函数会被多个 goroutine 并发调用，
+	//        所以每次调用都新建自己的 env，而不共用一个
+	if !used["z"] {
+		return func(c complex128) color.Color {
+			env := eval.ComplexEnv{"c": c}
+			return colorOf(e.EvalComplex(env), 192)
+		}, nil
+	}
+	return func(c complex128) color.Color {
+		const iterations = 200
+		const contrast = 15
+		env := eval.ComplexEnv{"c": c}
+		var v complex128
+		for n := uint8(0); n < iterations; n++ {
+			env["z"] = v
+			v = e.EvalComplex(env)
+			if cmplx.Abs(v) > 2 {
+				return color.Gray{255 - contrast*n}
+			}
+		}
+		return color.Black
+	}, nil
+}
+
+// colorOf 把复数值 v 映射为颜色，与 acos、sqrt 的着色方式相同
+func colorOf(v complex128, y uint8) color.Color {
+	blue := uint8(real(v)*128) + 127
+	red := uint8(imag(v)*128) + 127
+	return color.YCbCr{y, blue, red}
+}
+
+// loadPalette 读取文件 name 中的调色板，格式见 palette 的说明
+func loadPalette(name string) (*palette, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := parsePalette(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return p, nil
+}
+
 // Some other interesting functions:
 
 func acos(z complex128) color.Color {
@@ -0,0 +1,152 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A palette is a gradient of colors by number of iterations, which
+// repeats after the last of its stops.
+//
+// A palette is written as text, one stop to a line: a number of
+// iterations, from 0 at the first stop and increasing, then a color as
+// #rrggbb. Blank lines and those starting with # are ignored. The
+// colors between stops are interpolated linearly, so for the gradient
+// to repeat smoothly the last color should be the same as the first:
+//
+//	# black to red to yellow and back
+//	0	#000000
+//	10	#ff0000
+//	20	#ffff00
+//	40	#000000
+type palette struct {
+	stops []stop
+}
+
+type stop struct {
+	n     float64 // iterations
+	color color.RGBA
+}
+
+// palettes holds the palettes that can be chosen by name.
+var palettes = map[string]*palette{
+	// The shading of the original program, for every iteration
+	// instead of only the first 17.
+	"grey": mustParsePalette(`
+0	#ffffff
+17	#000000
+34	#ffffff`),
+	"fire": mustParsePalette(`
+0	#000000
+8	#800000
+16	#ff4000
+24	#ffc000
+32	#ffffe0
+48	#000000`),
+	"ocean": mustParsePalette(`
+0	#000764
+16	#206bcb
+42	#edffff
+64	#ffaa00
+86	#000200
+100	#000764`),
+	"rainbow": mustParsePalette(`
+0	#ff0000
+5	#ffff00
+10	#00ff00
+15	#00ffff
+20	#0000ff
+25	#ff00ff
+30	#ff0000`),
+}
+
+// parsePalette reads a palette in the form described at palette.
+func parsePalette(r io.Reader) (*palette, error) {
+	var p palette
+	in := bufio.NewScanner(r)
+	for line := 1; in.Scan(); line++ {
+		fields := strings.Fields(in.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want iterations and color", line)
+		}
+		n, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, fmt.Errorf("line %d: bad number of iterations %q", line, fields[0])
+		}
+		switch {
+		case len(p.stops) == 0 && n != 0:
+			return nil, fmt.Errorf("line %d: first stop is at %g, want 0", line, n)
+		case len(p.stops) > 0 && n <= p.stops[len(p.stops)-1].n:
+			return nil, fmt.Errorf("line %d: stop %g is not after the one before", line, n)
+		}
+		c, err := parseColor(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		p.stops = append(p.stops, stop{n, c})
+	}
+	if err := in.Err(); err != nil {
+		return nil, err
+	}
+	if len(p.stops) < 2 {
+		return nil, fmt.Errorf("palette has %d stops, want at least 2", len(p.stops))
+	}
+	return &p, nil
+}
+
+func mustParsePalette(s string) *palette {
+	p, err := parsePalette(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// parseColor parses a color written as #rrggbb.
+func parseColor(s string) (color.RGBA, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("bad color %q, want #rrggbb", s)
+	}
+	rgb, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("bad color %q, want #rrggbb", s)
+	}
+	return color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 0xff}, nil
+}
+
+// at returns the color for n iterations.
+func (p *palette) at(n float64) color.Color {
+	period := p.stops[len(p.stops)-1].n
+	n = math.Mod(n, period)
+	if n < 0 {
+		n += period
+	}
+	if n >= period { // rounded up from just below 0
+		n = 0
+	}
+	// Find the stops a and b on either side of n.
+	i := sort.Search(len(p.stops), func(i int) bool { return p.stops[i].n > n })
+	a, b := p.stops[i-1], p.stops[i]
+	t := (n - a.n) / (b.n - a.n)
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + t*(float64(y)-float64(x))))
+	}
+	return color.RGBA{
+		mix(a.color.R, b.color.R),
+		mix(a.color.G, b.color.G),
+		mix(a.color.B, b.color.B),
+		0xff,
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestPalette(t *testing.T) {
+	p, err := parsePalette(strings.NewReader(`
+# red to blue and back
+0	#ff0000
+
+10	#0000ff   
+20	#ff0000
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		n    float64
+		want color.Color
+	}{
+		{0, color.RGBA{255, 0, 0, 255}},
+		{5, color.RGBA{128, 0, 128, 255}},
+		{10, color.RGBA{0, 0, 255, 255}},
+		{17.5, color.RGBA{191, 0, 64, 255}},
+		{20, color.RGBA{255, 0, 0, 255}}, // repeats
+		{30, color.RGBA{0, 0, 255, 255}},
+	} {
+		if got := p.at(test.n); got != test.want {
+			t.Errorf("at(%g) = %v, want %v", test.n, got, test.want)
+		}
+	}
+
+	// The grey palette is the smooth shading of the original program.
+	for _, mu := range []float64{0, 0.5, 3.25, 16.9, 17, 20.2, 33.99, 100} {
+		r1, g1, b1, _ := palettes["grey"].at(mu).RGBA()
+		r2, g2, b2, _ := shade(mu).RGBA()
+		if r1>>8 != r2>>8 || g1>>8 != g2>>8 || b1>>8 != b2>>8 {
+			t.Errorf("grey at %g is %v, but shade is %v", mu, palettes["grey"].at(mu), shade(mu))
+		}
+	}
+}
+
+func TestParsePaletteErrors(t *testing.T) {
+	for _, test := range []struct{ input, want string }{
+		{"", "palette has 0 stops, want at least 2"},
+		{"0 #000000", "palette has 1 stops, want at least 2"},
+		{"1 #000000\n2 #ffffff", "line 1: first stop is at 1, want 0"},
+		{"0 #000000\n0 #ffffff", "line 2: stop 0 is not after the one before"},
+		{"0 #000000\nx #ffffff", `line 2: bad number of iterations "x"`},
+		{"0 #000000\nInf #ffffff", `line 2: bad number of iterations "Inf"`},
+		{"0 #000000\n1 red", `line 2: bad color "red", want #rrggbb`},
+		{"0 #000000\n1 #ffffzz", `line 2: bad color "#ffffzz", want #rrggbb`},
+		{"0 #000000\n1 #ffffff extra", "line 2: want iterations and color"},
+	} {
+		_, err := parsePalette(strings.NewReader(test.input))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("parsePalette(%q) = %v, want %s", test.input, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+)
+
+// A view maps the pixels of an image onto the complex plane: pixel
+// (px, py) of a w × h image is at re + (px - w/2)*dx + (im + (py - h/2)*dy)i.
+// The center is kept in arbitrary precision, for deep zooms.
+type view struct {
+	re, im *big.Float
+	dx, dy float64
+}
+
+// render sets each pixel of img to the color of its point in view v,
+// computing the rows in parallel on all CPUs. With samples > 1, each
+// pixel is the average of samples × samples points spread evenly
+// across it, which smooths the edges of the fractal.
+func render(img *image.RGBA, f fractal, v view, samples int) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	pixel := math.Max(math.Abs(v.dx), math.Abs(v.dy))
+	colorAt := f.near(v.re, v.im, pixel/float64(samples))
+
+	// The offsets of the samples within a pixel.
+	var offsets []float64
+	if samples == 1 {
+		offsets = []float64{0}
+	} else {
+		for i := 0; i < samples; i++ {
+			offsets = append(offsets, (float64(i)+0.5)/float64(samples)-0.5)
+		}
+	}
+
+	rows := make(chan int, h)
+	for py := 0; py < h; py++ {
+		rows <- py
+	}
+	close(rows)
+
+	// 【Go vs Java】等待一组 goroutine 结束
+	// Java:  ExecutorService pool = Executors.newFixedThreadPool(n); ... pool.awaitTermination(...)
+	// Go:    var wg sync.WaitGroup; wg.Add(1); go func() { defer wg.Done(); ... }(); wg.Wait()
+	// 注意：每个 goroutine 从 rows 通道取行，先算完的先取下一行，负载自然均衡
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for py := range rows {
+				for px := 0; px < w; px++ {
+					var r, g, b, a uint32
+					for _, oy := range offsets {
+						for _, ox := range offsets {
+							// 【Go vs Java】复数类型
+							// Java:  无内置复数类型，需要自定义类或使用Apache Commons Math
+							// Go:    complex128 是内置的复数类型（实部和虚部都是float64）
+							// 注意：complex(real, imag) 创建复数，还有complex64类型
+							d := complex((float64(px-w/2)+ox)*v.dx, (float64(py-h/2)+oy)*v.dy)
+							sr, sg, sb, sa := colorAt(d).RGBA()
+							r, g, b, a = r+sr, g+sg, b+sb, a+sa
+						}
+					}
+					n := uint32(len(offsets) * len(offsets))
+					c := color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)}
+
+					// 不同的 goroutine 写的是不同的像素，所以无需加锁
+					img.Set(bounds.Min.X+px, bounds.Min.Y+py, c)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
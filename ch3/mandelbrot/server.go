@@ -0,0 +1,161 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopl.io/ch12/params"
+)
+
+// The map covers the square [-2, 2] × [-2, 2] of the complex plane,
+// which is one tile at zoom level 0 and 2^z × 2^z tiles at level z,
+// numbered from the top left, as in web maps.
+const (
+	tileSize = 256 // pixels
+	maxZoom  = 400 // well within the range of float64 pixel sizes
+	extent   = 4.0 // side of the map at zoom level 0
+)
+
+// 【Go vs Java】把资源文件编进程序
+// Java:  getClass().getResourceAsStream("/index.html")，资源打包在 jar 里
+// Go:    //go:embed 指令在编译时把文件内容放进变量
+//
+//go:embed index.html
+var indexHTML string
+
+var index = template.Must(template.New("index").Parse(indexHTML))
+
+// A server serves the tiles of fractals, and a page for viewing them.
+type server struct {
+	defaults settings // unless overridden by URL parameters
+	samples  int      // across each pixel
+	cache    *tileCache
+}
+
+// serve serves fractals at addr, chosen by defaults unless the URL
+// parameters say otherwise, rendered with samples × samples samples in
+// each pixel, and keeping up to cacheSize tiles in memory. It returns
+// only on error.
+func serve(addr string, defaults settings, samples, cacheSize int) error {
+	s := &server{defaults: defaults, samples: samples}
+	s.cache = newTileCache(cacheSize, s.render)
+	log.Printf("serving on http://%s/", addr)
+	return http.ListenAndServe(addr, s)
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" && !strings.HasPrefix(req.URL.Path, "/tiles/") {
+		http.NotFound(w, req)
+		return
+	}
+	// The page passes its parameters on to the tiles.
+	set := s.defaults
+	if err := params.Unpack(req, &set); err != nil {
+		http.Error(w, "bad query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := set.fractal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case req.URL.Path == "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := index.Execute(w, struct{ TileSize, MaxZoom int }{tileSize, maxZoom}); err != nil {
+			log.Print(err)
+		}
+	case strings.HasPrefix(req.URL.Path, "/tiles/"):
+		t, err := parseTile(strings.TrimPrefix(req.URL.Path, "/tiles/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		t.settings = set
+		data, hit, err := s.cache.get(t, f)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if hit {
+			w.Header().Set("X-Cache", "hit")
+		} else {
+			w.Header().Set("X-Cache", "miss")
+		}
+		w.Header().Set("Content-Type", "image/png")
+		// Tiles change only if the server is restarted with other flags.
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(data)
+	}
+}
+
+// parseTile parses the path z/x/y.png of a tile, leaving its settings
+// to the caller.
+func parseTile(path string) (tile, error) {
+	bad := fmt.Errorf("bad tile path %q, want z/x/y.png", path)
+	parts := strings.Split(strings.TrimSuffix(path, ".png"), "/")
+	if len(parts) != 3 || !strings.HasSuffix(path, ".png") {
+		return tile{}, bad
+	}
+	z, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return tile{}, bad
+	}
+	if z < 0 || z > maxZoom {
+		return tile{}, fmt.Errorf("zoom level %d is not in [0, %d]", z, maxZoom)
+	}
+	// Below zoom level 63, x and y would fit in an int64, but not
+	// deeper.
+	n := new(big.Int).Lsh(big.NewInt(1), uint(z))
+	var xy [2]*big.Int
+	for i, part := range parts[1:] {
+		v, ok := new(big.Int).SetString(part, 10)
+		if !ok {
+			return tile{}, bad
+		}
+		if v.Sign() < 0 || v.Cmp(n) >= 0 {
+			return tile{}, fmt.Errorf("no tile %s/%s at zoom level %d", parts[1], parts[2], z)
+		}
+		xy[i] = v
+	}
+	return tile{z: z, x: xy[0].String(), y: xy[1].String()}, nil
+}
+
+// render returns the PNG image of tile t of fractal f.
+func (s *server) render(t tile, f fractal) []byte {
+	// The center of the tile is at
+	// -extent/2 + (x + 1/2)·side + (extent/2 - (y + 1/2)·side)i,
+	// where side = extent/2^z, computed exactly in binary.
+	prec := precision(extent / tileSize / math.Pow(2, float64(t.z)))
+	coord := func(s string, sign float64) *big.Float {
+		v, _ := new(big.Int).SetString(s, 10)
+		c := new(big.Float).SetPrec(prec).SetInt(v)
+		c.Add(c, big.NewFloat(0.5))
+		c.SetMantExp(c, -t.z).Mul(c, big.NewFloat(sign*extent))
+		return c.Add(c, big.NewFloat(-sign*extent/2))
+	}
+	re, im := coord(t.x, +1), coord(t.y, -1)
+	pixel := extent / tileSize / math.Pow(2, float64(t.z))
+
+	img := image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+	render(img, f, view{re, im, pixel, -pixel}, s.samples) // y decreases downward
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img) // cannot fail for an RGBA image and a bytes.Buffer
+	return buf.Bytes()
+}
@@ -0,0 +1,167 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseTile(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		want tile
+		ok   bool
+	}{
+		{"0/0/0.png", tile{z: 0, x: "0", y: "0"}, true},
+		{"3/7/5.png", tile{z: 3, x: "7", y: "5"}, true},
+		{"3/07/5.png", tile{z: 3, x: "7", y: "5"}, true},
+		{"100/1267650600228229401496703205375/0.png",
+			tile{z: 100, x: "1267650600228229401496703205375", y: "0"}, true}, // 2^100 - 1
+		{"100/1267650600228229401496703205376/0.png", tile{}, false},
+		{"3/8/0.png", tile{}, false},
+		{"3/0/-1.png", tile{}, false},
+		{"401/0/0.png", tile{}, false},
+		{"1/0/0", tile{}, false},
+		{"1/0.png", tile{}, false},
+		{"1/0/0/0.png", tile{}, false},
+		{"a/0/0.png", tile{}, false},
+		{"1/0x1/0.png", tile{}, false},
+	} {
+		got, err := parseTile(test.path)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseTile(%q) = %v, %v", test.path, got, err)
+		}
+	}
+}
+
+func TestTileCache(t *testing.T) {
+	var mu sync.Mutex
+	renders := make(map[tile]int)
+	c := newTileCache(2, func(t tile, _ fractal) []byte {
+		mu.Lock()
+		renders[t]++
+		mu.Unlock()
+		return []byte(t.x)
+	})
+
+	// Concurrent requests for one tile render it once.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, _, _ := c.get(tile{z: 1, x: "1", y: "0"}, nil); string(data) != "1" {
+				t.Errorf("got %v", data)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The least recently used tile is evicted.
+	c.get(tile{z: 1, x: "0", y: "0"}, nil)
+	c.get(tile{z: 1, x: "1", y: "0"}, nil)
+	c.get(tile{z: 2, x: "2", y: "0"}, nil) // evicts 1/0/0
+	for _, test := range []struct {
+		tile tile
+		hit  bool
+	}{{tile{z: 1, x: "1", y: "0"}, true}, {tile{z: 2, x: "2", y: "0"}, true}, {tile{z: 1, x: "0", y: "0"}, false}} {
+		if _, hit, _ := c.get(test.tile, nil); hit != test.hit {
+			t.Errorf("get(%v): hit = %t, want %t", test.tile, hit, test.hit)
+		}
+	}
+	if n := renders[tile{z: 1, x: "1", y: "0"}]; n != 1 {
+		t.Errorf("tile rendered %d times, want 1", n)
+	}
+}
+
+func TestTileCachePanic(t *testing.T) {
+	release := make(chan struct{})
+	c := newTileCache(2, func(t tile, _ fractal) []byte {
+		<-release
+		panic("boom")
+	})
+
+	// Callers waiting for a tile whose rendering panics are told so,
+	// rather than waiting forever.
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, _, err := c.get(tile{z: 0, x: "0", y: "0"}, nil)
+			errs <- err
+		}()
+	}
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err == nil {
+			t.Errorf("get succeeded despite panic")
+		}
+	}
+
+	// The tile is rendered afresh next time.
+	c.render = func(t tile, _ fractal) []byte { return []byte("ok") }
+	if data, hit, err := c.get(tile{z: 0, x: "0", y: "0"}, nil); string(data) != "ok" || hit || err != nil {
+		t.Errorf("get after panic = %q, %t, %v; want ok, false, nil", data, hit, err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := &server{defaults: settings{Fractal: "mandelbrot", Iterations: 200}, samples: 1}
+	s.cache = newTileCache(10, s.render)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+	page := get("/")
+	if words := strings.Join(strings.Fields(page.Body.String()), " "); page.Code != 200 ||
+		!strings.Contains(words, "maxZoom = 400") {
+		t.Errorf("GET /: %d\n%s", page.Code, page.Body)
+	}
+	for _, cache := range []string{"miss", "hit"} {
+		rec := get("/tiles/0/0/0.png")
+		if rec.Code != 200 || rec.Header().Get("X-Cache") != cache {
+			t.Fatalf("GET tile: %d, X-Cache %s, want 200, %s", rec.Code, rec.Header().Get("X-Cache"), cache)
+		}
+		img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != tileSize || b.Dy() != tileSize {
+			t.Errorf("tile is %v", b)
+		}
+		// The center of the map, 0+0i, is in the Mandelbrot set.
+		if r, g, b, _ := img.At(tileSize/2, tileSize/2).RGBA(); r|g|b != 0 {
+			t.Errorf("center of tile 0/0/0 is not black")
+		}
+	}
+	for _, path := range []string{"/tiles/1/2/0.png", "/tiles/x.png", "/other"} {
+		if rec := get(path); rec.Code != 404 {
+			t.Errorf("GET %s: %d, want 404", path, rec.Code)
+		}
+	}
+
+	// URL parameters choose other fractals, which are cached apart.
+	rec := get("/tiles/0/0/0.png?fractal=julia&c=0,0")
+	if rec.Code != 200 || rec.Header().Get("X-Cache") != "miss" {
+		t.Errorf("GET Julia tile: %d, X-Cache %s, want 200, miss", rec.Code, rec.Header().Get("X-Cache"))
+	}
+	for _, path := range []string{
+		"/?fractal=nope",
+		"/tiles/0/0/0.png?fractal=nope",
+		"/tiles/0/0/0.png?fractal=julia&c=1",
+		"/tiles/0/0/0.png?fractal=newton&poly=z+*",
+		"/tiles/0/0/0.png?palette=nope",
+		"/tiles/0/0/0.png?iter=-1",
+	} {
+		if rec := get(path); rec.Code != 400 {
+			t.Errorf("GET %s: %d, want 400", path, rec.Code)
+		}
+	}
+}
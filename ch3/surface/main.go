@@ -5,11 +5,22 @@
 //!+
 
 // Surface computes an SVG rendering of a 3-D surface function.
+// Cells are drawn from back to front, so that nearer cells hide those
+// behind them, and coloured by height, from blue valleys to red peaks.
+// Cells with a corner where the function is not finite are omitted.
+//
+// With the -format flag, it writes the mesh of the surface, in the
+// units of x, y and z, for other 3-D programs instead: in Wavefront
+// OBJ (obj), ASCII or binary STL (stl, stl-binary) or PLY (ply) format.
 package main
 
 import (
+	"flag"
 	"fmt"
 	"math"
+	"os"
+
+	"gopl.io/ch3/surface/mesh"
 )
 
 // 【Go vs Java】包级常量
@@ -31,44 +42,43 @@ const (
 // 注意：可以同时初始化多个变量
 var sin30, cos30 = math.Sin(angle), math.Cos(angle) // sin(30°), cos(30°)
 
+var format = flag.String("format", "svg", "output format: svg, obj, stl, stl-binary or ply")
+
 func main() {
-	fmt.Printf("<svg xmlns='http://www.w3.org/2000/svg' "+
-		"style='stroke: grey; fill: white; stroke-width: 0.7' "+
-		"width='%d' height='%d'>", width, height)
-	for i := 0; i < cells; i++ {
-		for j := 0; j < cells; j++ {
-			ax, ay := corner(i+1, j)
-			bx, by := corner(i, j)
-			cx, cy := corner(i, j+1)
-			dx, dy := corner(i+1, j+1)
-			fmt.Printf("<polygon points='%g,%g %g,%g %g,%g %g,%g'/>\n",
-				ax, ay, bx, by, cx, cy, dx, dy)
-		}
-	}
-	fmt.Println("</svg>")
-}
+	flag.Parse()
 
-// corner 计算网格角点的2D投影坐标
-// 【Go vs Java】多返回值
-// Java:  Point2D corner(int i, int j) { return new Point2D(sx, sy); }
-// Go:    func corner(i, j int) (float64, float64) { return sx, sy }
-// 注意：Go支持多返回值，不需要创建额外的对象
-func corner(i, j int) (float64, float64) {
-	// Find point (x,y) at corner of cell (i,j).
-	x := xyrange * (float64(i)/cells - 0.5)
-	y := xyrange * (float64(j)/cells - 0.5)
+	// 先把网格的角点和单元一次性算成网格（mesh），再按所选格式输出
+	// 【Go vs Java】函数作为参数
+	// Java:  Mesh.grid((x, y) -> f(x, y), ...)，需要函数式接口
+	// Go:    mesh.Grid(f, ...)，函数本身就是值
+	m := mesh.Grid(f, xyrange, cells, nil)
 
-	// Compute surface height z.
-	z := f(x, y)
+	var err error
+	if *format == "svg" {
+		err = m.WriteSVG(os.Stdout, width, height, project)
+	} else if out, ok := mesh.Formats[*format]; ok {
+		err = out.Write(m, os.Stdout)
+	} else {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "surface: %v\n", err)
+		os.Exit(1)
+	}
+}
 
-	// Project (x,y,z) isometrically onto 2-D SVG canvas (sx,sy).
-	sx := width/2 + (x-y)*cos30*xyscale
-	sy := height/2 + (x+y)*sin30*xyscale - z*zscale
+// project 把点(x,y,z)等轴投影到二维SVG画布上的(sx,sy)
+// 【Go vs Java】命名返回值
+// Java:  Point2D project(Vertex v) { ... return new Point2D(sx, sy); }
+// Go:    func project(v mesh.Vertex) (sx, sy, near float64)
+// 注意：命名的返回值也是文档，说明了每个返回值的含义
+func project(v mesh.Vertex) (sx, sy, near float64) {
+	sx = width/2 + (v.X-v.Y)*cos30*xyscale
+	sy = height/2 + (v.X+v.Y)*sin30*xyscale - v.Z*zscale
 
-	// 【Go vs Java】返回多个值
-	// Java:  return new Point2D(sx, sy);
-	// Go:    return sx, sy
-	return sx, sy
+	// A nearer point has a greater x+y, which is drawn lower on the canvas.
+	return sx, sy, v.X + v.Y
 }
 
 // f 计算3D表面函数值
@@ -0,0 +1,298 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Package mesh represents a surface z = f(x, y) as a mesh of vertices
+// and quadrilateral faces, and writes it as an SVG image or in the
+// Wavefront OBJ, STL or PLY file formats of 3-D modelling programs.
+package mesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// A Vertex is a point on the surface, in the units of x, y and z.
+type Vertex struct{ X, Y, Z float64 }
+
+// A Face is a cell of the grid, given by the indexes of its corners
+// in Mesh.Vertices, counterclockwise as seen from above.
+type Face [4]int
+
+// A Mesh is a set of faces, which share their corners.
+type Mesh struct {
+	Vertices []Vertex
+	Faces    []Face
+}
+
+// Grid returns the mesh of the surface z = f(x, y) over the square
+// -xyrange/2 ≤ x, y ≤ xyrange/2, divided into cells × cells faces.
+// If keep is not nil, only the cells (i,j) for which keep(i, j) is
+// true are included. Cells with a corner at which f is not finite,
+// such as sin(r)/r at r=0, are omitted.
+//
+// f is called once for each corner of the included cells.
+func Grid(f func(x, y float64) float64, xyrange float64, cells int,
+	keep func(i, j int) bool) *Mesh {
+	m := new(Mesh)
+	xy := func(i, j int) (float64, float64) {
+		x := xyrange * (float64(i)/float64(cells) - 0.5)
+		y := xyrange * (float64(j)/float64(cells) - 0.5)
+		return x, y
+	}
+
+	// The height at corner (i,j) is z[i*n+j], once known[i*n+j] is
+	// set; its vertex is m.Vertices[index[i*n+j]-1], once a face
+	// has used it.
+	n := cells + 1
+	z := make([]float64, n*n)
+	known := make([]bool, n*n)
+	index := make([]int, n*n)
+
+	// 【Go vs Java】闭包
+	// Java:  lambda 只能捕获 effectively final 的变量，不能给它们赋值
+	// Go:    闭包可以读写外层的 z 和 known
+	height := func(i, j int) float64 {
+		if k := i*n + j; !known[k] {
+			z[k] = f(xy(i, j))
+			known[k] = true
+		}
+		return z[i*n+j]
+	}
+
+	for i := 0; i < cells; i++ {
+		for j := 0; j < cells; j++ {
+			if keep != nil && !keep(i, j) {
+				continue
+			}
+			corners := [4][2]int{{i, j}, {i + 1, j}, {i + 1, j + 1}, {i, j + 1}}
+			finite := true
+			for _, c := range corners {
+				h := height(c[0], c[1])
+				finite = finite && !math.IsNaN(h) && !math.IsInf(h, 0)
+			}
+			if !finite {
+				continue
+			}
+			var face Face
+			for v, c := range corners {
+				k := c[0]*n + c[1]
+				if index[k] == 0 {
+					x, y := xy(c[0], c[1])
+					m.Vertices = append(m.Vertices, Vertex{x, y, z[k]})
+					index[k] = len(m.Vertices)
+				}
+				face[v] = index[k] - 1
+			}
+			m.Faces = append(m.Faces, face)
+		}
+	}
+	return m
+}
+
+// A Projection maps a point in space to the point (sx, sy) of the
+// canvas, and to how near it is to the viewer, in any units. Since
+// faces are ordered by the mean nearness of their corners, it should
+// be linear in x, y and z.
+type Projection func(v Vertex) (sx, sy, near float64)
+
+// WriteSVG writes an SVG image of the mesh, of the given size in
+// pixels, to w. Faces are drawn from back to front, so that nearer
+// faces hide those behind them, and colored by height, from blue at
+// the bottom to red at the top.
+func (m *Mesh) WriteSVG(w io.Writer, width, height int, project Projection) error {
+	type point struct{ sx, sy, near float64 }
+	points := make([]point, len(m.Vertices))
+	for i, v := range m.Vertices {
+		sx, sy, near := project(v)
+		points[i] = point{sx, sy, near}
+	}
+
+	type polygon struct {
+		face     Face
+		z, depth float64 // mean height and distance back from the viewer
+	}
+	polygons := make([]polygon, len(m.Faces))
+	zmin, zmax := math.Inf(+1), math.Inf(-1)
+	for i, face := range m.Faces {
+		p := polygon{face: face}
+		for _, k := range face {
+			p.z += m.Vertices[k].Z / 4
+			p.depth -= points[k].near / 4
+		}
+		polygons[i] = p
+		zmin = math.Min(zmin, p.z)
+		zmax = math.Max(zmax, p.z)
+	}
+	// 画家算法：按深度从远到近排序，近处的面后画，从而遮住远处的
+	sort.Slice(polygons, func(i, j int) bool {
+		return polygons[i].depth > polygons[j].depth
+	})
+
+	// 【Go vs Java】带缓冲的写入
+	// Java:  BufferedWriter 的每次 write 都可能抛出 IOException
+	// Go:    bufio.Writer 记住第一个错误，之后的写入什么也不做，最后由 Flush 返回
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns='http://www.w3.org/2000/svg' "+
+		"style='stroke: grey; fill: white; stroke-width: 0.7' "+
+		"width='%d' height='%d'>", width, height)
+	for _, p := range polygons {
+		a, b, c, d := points[p.face[0]], points[p.face[1]], points[p.face[2]], points[p.face[3]]
+		fmt.Fprintf(bw, "<polygon points='%g,%g %g,%g %g,%g %g,%g' fill='%s'/>\n",
+			a.sx, a.sy, b.sx, b.sy, c.sx, c.sy, d.sx, d.sy, color(p.z, zmin, zmax))
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// color returns the color for height z within [zmin, zmax],
+// from blue at the bottom to red at the top.
+func color(z, zmin, zmax float64) string {
+	t := 0.5
+	if zmax > zmin {
+		t = (z - zmin) / (zmax - zmin)
+	}
+	red := uint8(math.Round(255 * t))
+	return fmt.Sprintf("#%02x00%02x", red, 255-red)
+}
+
+// A Format is a file format in which a mesh may be written.
+type Format struct {
+	Ext         string // file name extension, e.g. ".obj"
+	ContentType string // MIME type
+	Write       func(m *Mesh, w io.Writer) error
+}
+
+// Formats holds the file formats by name.
+// 【Go vs Java】方法值
+// Java:  Mesh::writeOBJ 是 BiConsumer<Mesh, Writer>
+// Go:    (*Mesh).WriteOBJ 是 func(*Mesh, io.Writer) error，接收者成为第一个参数
+var Formats = map[string]Format{
+	"obj":        {".obj", "model/obj", (*Mesh).WriteOBJ},
+	"stl":        {".stl", "model/stl", (*Mesh).WriteSTL},
+	"stl-binary": {".stl", "model/stl", (*Mesh).WriteBinarySTL},
+	"ply":        {".ply", "application/x-ply", (*Mesh).WritePLY},
+}
+
+// WriteOBJ writes the mesh to w in the Wavefront OBJ format.
+func (m *Mesh) WriteOBJ(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range m.Vertices {
+		fmt.Fprintf(bw, "v %g %g %g\n", v.X, v.Y, v.Z)
+	}
+	for _, f := range m.Faces {
+		// OBJ numbers vertices from 1.
+		fmt.Fprintf(bw, "f %d %d %d %d\n", f[0]+1, f[1]+1, f[2]+1, f[3]+1)
+	}
+	return bw.Flush()
+}
+
+// WritePLY writes the mesh to w in the ASCII form of the PLY
+// (Stanford triangle) format.
+func (m *Mesh) WritePLY(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ply\nformat ascii 1.0\n")
+	fmt.Fprintf(bw, "element vertex %d\n", len(m.Vertices))
+	fmt.Fprintf(bw, "property double x\nproperty double y\nproperty double z\n")
+	fmt.Fprintf(bw, "element face %d\n", len(m.Faces))
+	fmt.Fprintf(bw, "property list uchar int vertex_indices\nend_header\n")
+	for _, v := range m.Vertices {
+		fmt.Fprintf(bw, "%g %g %g\n", v.X, v.Y, v.Z)
+	}
+	for _, f := range m.Faces {
+		fmt.Fprintf(bw, "4 %d %d %d %d\n", f[0], f[1], f[2], f[3])
+	}
+	return bw.Flush()
+}
+
+// triangles returns the triangles into which the faces are split,
+// each as its unit normal followed by its corners. STL describes a
+// solid by such triangles alone, with normals pointing out of the
+// solid, which for a surface is upward.
+func (m *Mesh) triangles() [][4][3]float64 {
+	var tris [][4][3]float64
+	for _, f := range m.Faces {
+		for _, t := range [2][3]int{{f[0], f[1], f[2]}, {f[0], f[2], f[3]}} {
+			a, b, c := m.Vertices[t[0]], m.Vertices[t[1]], m.Vertices[t[2]]
+			tris = append(tris, [4][3]float64{
+				normal(a, b, c),
+				{a.X, a.Y, a.Z},
+				{b.X, b.Y, b.Z},
+				{c.X, c.Y, c.Z},
+			})
+		}
+	}
+	return tris
+}
+
+// normal returns the unit normal of the triangle abc, whose corners
+// are counterclockwise around it, or zero if abc has no area.
+func normal(a, b, c Vertex) [3]float64 {
+	ux, uy, uz := b.X-a.X, b.Y-a.Y, b.Z-a.Z
+	vx, vy, vz := c.X-a.X, c.Y-a.Y, c.Z-a.Z
+	nx, ny, nz := uy*vz-uz*vy, uz*vx-ux*vz, ux*vy-uy*vx
+	length := math.Sqrt(nx*nx + ny*ny + nz*nz)
+	if length == 0 {
+		return [3]float64{}
+	}
+	return [3]float64{nx / length, ny / length, nz / length}
+}
+
+// WriteSTL writes the mesh to w in the ASCII form of the STL format.
+func (m *Mesh) WriteSTL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "solid surface")
+	for _, t := range m.triangles() {
+		fmt.Fprintf(bw, "facet normal %g %g %g\nouter loop\n", t[0][0], t[0][1], t[0][2])
+		for _, v := range t[1:] {
+			fmt.Fprintf(bw, "vertex %g %g %g\n", v[0], v[1], v[2])
+		}
+		fmt.Fprintln(bw, "endloop\nendfacet")
+	}
+	fmt.Fprintln(bw, "endsolid surface")
+	return bw.Flush()
+}
+
+// WriteBinarySTL writes the mesh to w in the binary form of the STL
+// format, which is smaller than the ASCII form but has only float32
+// precision.
+func (m *Mesh) WriteBinarySTL(w io.Writer) error {
+	tris := m.triangles()
+	if uint64(len(tris)) > math.MaxUint32 {
+		return fmt.Errorf("too many triangles for STL: %d", len(tris))
+	}
+
+	// 【Go vs Java】二进制编码
+	// Java:  ByteBuffer.allocate(50).order(ByteOrder.LITTLE_ENDIAN).putFloat(...)
+	// Go:    binary.Write 按字段顺序、无填充地写出结构体
+	var header struct {
+		Text  [80]byte // must not begin with "solid"
+		Count uint32
+	}
+	copy(header.Text[:], "binary STL of a surface")
+	header.Count = uint32(len(tris))
+	type triangle struct {
+		Normal, A, B, C [3]float32
+		Attributes      uint16
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	for _, t := range tris {
+		var out triangle
+		for i, p := range []*[3]float32{&out.Normal, &out.A, &out.B, &out.C} {
+			for j := range p {
+				p[j] = float32(t[i][j])
+			}
+		}
+		if err := binary.Write(bw, binary.LittleEndian, &out); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
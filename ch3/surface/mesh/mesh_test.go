@@ -0,0 +1,155 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package mesh_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"gopl.io/ch3/surface/mesh"
+)
+
+func TestGrid(t *testing.T) {
+	// 1/x has a pole along x=0, so of the 4×4 cells only those in the
+	// first and last columns remain, with the 20 corners they use.
+	calls := 0
+	m := mesh.Grid(func(x, y float64) float64 {
+		calls++
+		return 1 / x
+	}, 4, 4, nil)
+	if calls != 25 {
+		t.Errorf("f called %d times, want once for each of 25 corners", calls)
+	}
+	if len(m.Faces) != 8 || len(m.Vertices) != 20 {
+		t.Errorf("got %d faces and %d vertices, want 8 and 20", len(m.Faces), len(m.Vertices))
+	}
+
+	// Only the kept cells are computed.
+	calls = 0
+	m = mesh.Grid(func(x, y float64) float64 {
+		calls++
+		return x * y
+	}, 4, 4, func(i, j int) bool { return i == 1 && j == 2 })
+	if calls != 4 || len(m.Faces) != 1 {
+		t.Fatalf("got %d calls and %d faces, want 4 and 1", calls, len(m.Faces))
+	}
+	var corners []mesh.Vertex
+	for _, k := range m.Faces[0] {
+		corners = append(corners, m.Vertices[k])
+	}
+	want := []mesh.Vertex{{-1, 0, 0}, {0, 0, 0}, {0, 1, 0}, {-1, 1, -1}}
+	for i := range want {
+		if corners[i] != want[i] {
+			t.Errorf("corners = %v, want %v", corners, want)
+			break
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	// A single face of the plane z = x, which slopes up toward +x.
+	m := mesh.Grid(func(x, y float64) float64 { return x }, 2, 1, nil)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"obj", `
+v -1 -1 -1
+v 1 -1 1
+v 1 1 1
+v -1 1 -1
+f 1 2 3 4
+`},
+		{"ply", `
+ply
+format ascii 1.0
+element vertex 4
+property double x
+property double y
+property double z
+element face 1
+property list uchar int vertex_indices
+end_header
+-1 -1 -1
+1 -1 1
+1 1 1
+-1 1 -1
+4 0 1 2 3
+`},
+		{"stl", `
+solid surface
+facet normal -0.7071067811865475 0 0.7071067811865475
+outer loop
+vertex -1 -1 -1
+vertex 1 -1 1
+vertex 1 1 1
+endloop
+endfacet
+facet normal -0.7071067811865475 0 0.7071067811865475
+outer loop
+vertex -1 -1 -1
+vertex 1 1 1
+vertex -1 1 -1
+endloop
+endfacet
+endsolid surface
+`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := mesh.Formats[test.format].Write(m, &buf); err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		if got := buf.String(); got != test.want[1:] {
+			t.Errorf("%s: got\n%swant\n%s", test.format, got, test.want[1:])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteBinarySTL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 80+4+2*50 {
+		t.Fatalf("binary STL is %d bytes, want %d", buf.Len(), 80+4+2*50)
+	}
+	if strings.HasPrefix(buf.String(), "solid") {
+		t.Errorf("binary STL header begins with \"solid\"")
+	}
+	var count uint32
+	var tri struct {
+		Normal, A, B, C [3]float32
+		Attributes      uint16
+	}
+	buf.Next(80)
+	binary.Read(&buf, binary.LittleEndian, &count)
+	binary.Read(&buf, binary.LittleEndian, &tri)
+	s := float32(math.Sqrt(0.5))
+	if count != 2 || tri.Normal != [3]float32{-s, 0, s} || tri.C != [3]float32{1, 1, 1} {
+		t.Errorf("binary STL: %d triangles, first %v", count, tri)
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	// Two faces, seen from the side: the lower, nearer one is drawn last.
+	m := mesh.Grid(func(x, y float64) float64 { return -x }, 2, 2, func(i, j int) bool { return j == 0 })
+	var buf bytes.Buffer
+	err := m.WriteSVG(&buf, 100, 50, func(v mesh.Vertex) (sx, sy, near float64) {
+		return 50 + 10*v.Y, 25 - 10*v.Z, v.X
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<svg xmlns='http://www.w3.org/2000/svg' style='stroke: grey; fill: white; stroke-width: 0.7' width='100' height='50'>` +
+		`<polygon points='40,15 40,25 50,25 50,15' fill='#ff0000'/>
+<polygon points='40,25 40,35 50,35 50,25' fill='#0000ff'/>
+</svg>
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -4,21 +4,35 @@
 // See page 148.
 
 // Fetch saves the contents of a URL into a local file.
+//
+// It keeps the pages it fetches in a cache, and fetches them again only
+// once they are out of date, and then only if they have changed; see
+// the Cache of gopl.io/ch1/fetchall/fetch. The flag -nocache bypasses
+// the cache, and -clear clears it. It also copies files named by file
+// URLs, for use offline.
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path"
+	"path/filepath"
+
+	fetcher "gopl.io/ch1/fetchall/fetch"
 )
 
+// client fetches the URLs, through the cache.
+var client = http.DefaultClient
+
 //!+
 // Fetch downloads the URL and returns the
 // name and length of the local file.
 func fetch(url string) (filename string, n int64, err error) {
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return "", 0, err
 	}
@@ -28,6 +42,9 @@ func fetch(url string) (filename string, n int64, err error) {
 	if local == "/" {
 		local = "index.html"
 	}
+	if isSource(resp.Request.URL, local) {
+		return "", 0, fmt.Errorf("%s is the file being fetched", local)
+	}
 	f, err := os.Create(local)
 	if err != nil {
 		return "", 0, err
@@ -42,8 +59,31 @@ func fetch(url string) (filename string, n int64, err error) {
 
 //!-
 
+// isSource reports whether the local file is the one named by the file
+// URL u, which creating the local file would truncate before it is read.
+func isSource(u *neturl.URL, local string) bool {
+	if u.Scheme != "file" {
+		return false
+	}
+	src, err := os.Stat(filepath.FromSlash(u.Path))
+	if err != nil {
+		return false
+	}
+	dst, err := os.Stat(local)
+	return err == nil && os.SameFile(src, dst)
+}
+
 func main() {
-	for _, url := range os.Args[1:] {
+	var opts fetcher.CacheOptions
+	opts.AddFlags(flag.CommandLine)
+	flag.Parse()
+	var err error
+	if client, err = opts.Client(); err != nil {
+		fmt.Fprintf(os.Stderr, "fetch: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, url := range flag.Args() {
 		local, n, err := fetch(url)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "fetch %s: %v\n", url, err)
@@ -8,7 +8,14 @@ type Expr interface {
 	// Eval returns the value of this Expr in the environment env.
 	Eval(env Env) float64
 	// Check reports errors in this Expr and adds its Vars to the set.
+	// If there are several errors, it reports them all as an ErrorList.
 	Check(vars map[Var]bool) error
+	// EvalComplex returns the complex value of this Expr in the
+	// environment env.
+	EvalComplex(env ComplexEnv) complex128
+	// EvalInterval returns bounds on the value of this Expr when its
+	// variables range over the intervals of env.
+	EvalInterval(env IntervalEnv) Interval
 }
 
 //!+ast
@@ -19,22 +26,74 @@ type Var string
 // A literal is a numeric constant, e.g., 3.141.
 type literal float64
 
+// An imaginary is an imaginary constant, e.g., 2i.
+type imaginary float64
+
 // A unary represents a unary operator expression, e.g., -x.
 type unary struct {
-	op rune // one of '+', '-'
+	op rune // one of '+', '-', '!'
 	x  Expr
 }
 
 // A binary represents a binary operator expression, e.g., x+y.
 type binary struct {
-	op   rune // one of '+', '-', '*', '/'
+	op   rune // one of '+', '-', '*', '/', '<', '>', or a tok constant
 	x, y Expr
 }
 
 // A call represents a function call expression, e.g., sin(x).
 type call struct {
-	fn   string // one of "pow", "sin", "sqrt"
+	fn   string // name of the registered function, e.g., "sin"
 	args []Expr
 }
 
 //!-ast
+
+// The function of a call is the registered one named fn, looked up when
+// the call is evaluated, so that a call holds just its name and
+// arguments.
+
+// A funcCall represents a call whose function was settled when it was
+// parsed: one passed to ParseFuncs, which takes precedence over the
+// registered one of the same name, or, if the call cannot be made
+// because the function is unknown or the number of arguments is wrong,
+// whatever function there is, so that Check can report the problem
+// at pos.
+type funcCall struct {
+	call
+	f   *Func // the function, or nil if there is none
+	pos Pos   // position of fn in the input
+}
+
+// A conditional represents a conditional expression, e.g., x < 0 ? -x : x.
+type conditional struct {
+	cond, x, y Expr
+}
+
+// A block represents a sequence of statements separated by semicolons,
+// e.g., r = sqrt(x*x + y*y); sin(r) / r. Its value is that of the
+// last statement.
+type block struct {
+	stmts []*stmt
+}
+
+// A stmt is a statement of a block: the definition of a variable,
+// e.g., r = sqrt(x*x + y*y), or of a function, e.g., f(a, b) = a*b + 1,
+// or, if it is the last, just an expression.
+type stmt struct {
+	name     string // defined variable or function, or "" for an expression
+	function bool   // name is a function
+	params   []Var  // parameters of a function
+	x        Expr   // the value of a variable or the body of a function
+	pos      Pos    // position of the statement
+	uses     []use  // each use of a variable in x
+}
+
+// An apply represents a call of a function defined in a block, e.g., f(x, 2).
+type apply struct {
+	fn   string
+	args []Expr
+	def  *stmt // the definition of fn
+	pos  Pos   // position of fn in the input
+	body Expr  // the body of fn with the arguments in place of its parameters
+}
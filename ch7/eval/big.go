@@ -0,0 +1,582 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// A BigEnv maps variables to their values, for EvalBig.
+type BigEnv map[Var]*big.Float
+
+// A RatEnv maps variables to their values, for EvalRat.
+type RatEnv map[Var]*big.Rat
+
+// EvalBig evaluates an expression in binary floating point with a
+// mantissa of prec bits, so that it can be computed more accurately
+// than by Eval. Each operation is rounded to the nearest such number,
+// as are sqrt and hypot; pow is too when its exponent is an integer.
+// Functions that cannot be computed to that precision, such as sin,
+// are reported as errors, as are results that are not a number, such
+// as 0/0, and variables that are not in env.
+//
+// A literal number stands for the shortest decimal that rounds to its
+// float64 value, so 0.1 means exactly one tenth, but any digits after
+// the 17th are lost.
+func EvalBig(e Expr, env BigEnv, prec uint) (_ *big.Float, err error) {
+	if prec == 0 || prec > big.MaxPrec {
+		return nil, fmt.Errorf("invalid precision %d", prec)
+	}
+	defer catchBig(&err)
+	b := bigEval{prec}
+	return b.eval(e, env), nil
+}
+
+// EvalRat evaluates an expression exactly, as a rational number.
+// It reports an error if the expression is not rational arithmetic:
+// if it divides by zero, or calls a function whose result may not be
+// rational, such as sin. The functions abs, ceil, floor, max, min, mod,
+// round and trunc are allowed, as are pow with an integer exponent and
+// sqrt and hypot when their results are rational. Literal numbers are
+// as for EvalBig.
+func EvalRat(e Expr, env RatEnv) (_ *big.Rat, err error) {
+	defer catchBig(&err)
+	return evalRat(e, env), nil
+}
+
+// A bigError is an error reported by EvalBig or EvalRat,
+// which panic with it and recover.
+type bigError struct{ err error }
+
+func bigErrorf(format string, args ...interface{}) {
+	panic(bigError{fmt.Errorf(format, args...)})
+}
+
+func catchBig(err *error) {
+	switch x := recover().(type) {
+	case nil:
+		// no panic
+	case bigError:
+		*err = x.err
+	case big.ErrNaN:
+		// e.g., 0/0 or sqrt of a negative number
+		*err = fmt.Errorf("result is not a number: %v", x)
+	default:
+		panic(x)
+	}
+}
+
+// decimal returns the exact value of the shortest decimal that
+// rounds to x.
+func decimal(x float64) *big.Rat {
+	if math.IsInf(x, 0) || math.IsNaN(x) {
+		bigErrorf("%g is not a rational number", x)
+	}
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(x, 'g', -1, 64))
+	return r
+}
+
+// ---- EvalBig ----
+
+type bigEval struct {
+	prec uint
+}
+
+// new returns a new number, to be rounded to b.prec bits.
+func (b bigEval) new() *big.Float {
+	return new(big.Float).SetPrec(b.prec)
+}
+
+func (b bigEval) truth(t bool) *big.Float {
+	if t {
+		return b.new().SetInt64(1)
+	}
+	return b.new()
+}
+
+func (b bigEval) eval(e Expr, env BigEnv) *big.Float {
+	switch e := e.(type) {
+	case Var:
+		x, ok := env[e]
+		if !ok {
+			bigErrorf("undefined variable: %s", e)
+		}
+		return b.new().Set(x)
+
+	case literal:
+		if math.IsInf(float64(e), 0) {
+			return b.new().SetInf(e < 0)
+		}
+		return b.new().SetRat(decimal(float64(e)))
+
+	case imaginary:
+		bigErrorf("%s has no real value", Format(e))
+
+	case unary:
+		x := b.eval(e.x, env)
+		switch e.op {
+		case '+':
+			return x
+		case '-':
+			return x.Neg(x)
+		case '!':
+			return b.truth(x.Sign() == 0)
+		}
+
+	case binary:
+		switch e.op {
+		case tokAnd:
+			return b.truth(b.eval(e.x, env).Sign() != 0 && b.eval(e.y, env).Sign() != 0)
+		case tokOr:
+			return b.truth(b.eval(e.x, env).Sign() != 0 || b.eval(e.y, env).Sign() != 0)
+		}
+		x, y := b.eval(e.x, env), b.eval(e.y, env)
+		switch e.op {
+		case '+':
+			return b.new().Add(x, y)
+		case '-':
+			return b.new().Sub(x, y)
+		case '*':
+			return b.new().Mul(x, y)
+		case '/':
+			return b.new().Quo(x, y)
+		case '<':
+			return b.truth(x.Cmp(y) < 0)
+		case '>':
+			return b.truth(x.Cmp(y) > 0)
+		case tokLE:
+			return b.truth(x.Cmp(y) <= 0)
+		case tokGE:
+			return b.truth(x.Cmp(y) >= 0)
+		case tokEQ:
+			return b.truth(x.Cmp(y) == 0)
+		case tokNE:
+			return b.truth(x.Cmp(y) != 0)
+		}
+
+	case conditional:
+		if b.eval(e.cond, env).Sign() != 0 {
+			return b.eval(e.x, env)
+		}
+		return b.eval(e.y, env)
+
+	case call:
+		return b.evalCall(e, e.fun(), env)
+
+	case funcCall:
+		return b.evalCall(e.call, e.f, env)
+
+	case apply:
+		return b.eval(e.body, env)
+
+	case block:
+		local := make(BigEnv, len(env)+len(e.stmts))
+		for v, x := range env {
+			local[v] = x
+		}
+		result := b.new()
+		for _, s := range e.stmts {
+			if s.function {
+				result = b.new()
+				continue
+			}
+			result = b.eval(s.x, local)
+			if s.name != "" {
+				local[Var(s.name)] = result
+			}
+		}
+		return result
+	}
+	panic(fmt.Sprintf("unsupported Expr: %s", Format(e)))
+}
+
+// evalCall evaluates a call of f, which must be the function registered
+// by default under its name: any other, such as one passed to
+// ParseFuncs in its place, cannot be computed.
+func (b bigEval) evalCall(e call, f *Func, env BigEnv) *big.Float {
+	if !isBuiltin(e.fn, f) {
+		bigErrorf("%s cannot be computed to %d bits", e.fn, b.prec)
+	}
+	args := make([]*big.Float, len(e.args))
+	for i, arg := range e.args {
+		args[i] = b.eval(arg, env)
+	}
+	return b.call(e.fn, args)
+}
+
+func (b bigEval) call(fn string, args []*big.Float) *big.Float {
+	switch fn {
+	case "abs":
+		return args[0].Abs(args[0])
+	case "re", "conj":
+		return args[0]
+	case "im":
+		return b.new()
+	case "arg":
+		if args[0].Sign() >= 0 {
+			return b.new()
+		}
+	case "floor", "ceil", "round", "trunc":
+		if args[0].IsInf() {
+			return args[0]
+		}
+		r, _ := args[0].Rat(nil)
+		return b.new().SetRat(roundRat(fn, r))
+	case "max", "min":
+		x := args[0]
+		for _, y := range args[1:] {
+			if fn == "max" && y.Cmp(x) > 0 || fn == "min" && y.Cmp(x) < 0 {
+				x = y
+			}
+		}
+		return x
+	case "sqrt":
+		if args[0].IsInf() && args[0].Sign() > 0 {
+			return args[0]
+		}
+		return b.sqrt(bigRat(args[0]))
+	case "hypot":
+		if args[0].IsInf() || args[1].IsInf() {
+			return b.new().SetInf(false)
+		}
+		x, y := bigRat(args[0]), bigRat(args[1])
+		x.Mul(x, x)
+		y.Mul(y, y)
+		return b.sqrt(x.Add(x, y))
+	case "mod":
+		if args[0].IsInf() || args[1].Sign() == 0 {
+			bigErrorf("mod(%s, %s) is not a number", args[0].Text('g', 10), args[1].Text('g', 10))
+		}
+		if args[1].IsInf() {
+			return args[0]
+		}
+		return b.new().SetRat(modRat(bigRat(args[0]), bigRat(args[1])))
+	case "pow":
+		if n, ok := exponent(args[1]); ok {
+			return b.pow(args[0], n)
+		}
+	}
+	bigErrorf("%s cannot be computed to %d bits", fn, b.prec)
+	panic("unreachable")
+}
+
+// bigRat returns the exact value of the finite number x.
+func bigRat(x *big.Float) *big.Rat {
+	if x.IsInf() {
+		bigErrorf("%s is not a rational number", x.String())
+	}
+	r, _ := x.Rat(nil)
+	return r
+}
+
+// sqrt returns the square root of q, correctly rounded.
+func (b bigEval) sqrt(q *big.Rat) *big.Float {
+	if q.Sign() < 0 {
+		bigErrorf("sqrt of negative number %s", q.RatString())
+	}
+	if q.Sign() == 0 {
+		return b.new()
+	}
+	// Scale q by 4^k so that its square root, n, has at least prec+2
+	// bits in its integer part; then truncate n and, if any bits were
+	// lost, set its last bit so that n is known to be inexact.
+	// Rounding n to prec bits then rounds the root correctly.
+	num, den := q.Num(), q.Denom()
+	k := int(b.prec) + 3 - (num.BitLen()-den.BitLen())/2
+	num, den = new(big.Int).Set(num), new(big.Int).Set(den)
+	if k >= 0 {
+		num.Lsh(num, uint(2*k))
+	} else {
+		den.Lsh(den, uint(-2*k))
+	}
+	m, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	n := new(big.Int).Sqrt(m)
+	if rem.Sign() != 0 || new(big.Int).Mul(n, n).Cmp(m) != 0 {
+		n.Lsh(n, 1).SetBit(n, 0, 1)
+		k++
+	}
+	z := b.new().SetInt(n)
+	return z.SetMantExp(z, -k)
+}
+
+// exponent returns y as an int if it is one of reasonable size.
+func exponent(y *big.Float) (int, bool) {
+	if !y.IsInt() {
+		return 0, false
+	}
+	n, acc := y.Int64()
+	if acc != big.Exact || n > math.MaxInt32 || n < -math.MaxInt32 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// maxPowBits limits the size of the exact power computed by pow.
+const maxPowBits = 1 << 20
+
+// pow returns x raised to the integer power n, correctly rounded,
+// by computing it exactly and rounding once.
+func (b bigEval) pow(x *big.Float, n int) *big.Float {
+	if x.IsInf() || x.Sign() == 0 {
+		// Follow math.Pow for the special cases.
+		f, _ := x.Float64()
+		return b.new().SetFloat64(math.Pow(f, float64(n)))
+	}
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	bits := uint64(x.MinPrec()) * uint64(abs)
+	if bits > maxPowBits {
+		bigErrorf("pow with exponent %d cannot be computed to %d bits", n, b.prec)
+	}
+	// Repeated squaring is exact at this precision.
+	exact := new(big.Float).SetPrec(uint(bits) + 1).SetInt64(1)
+	sq := new(big.Float).SetPrec(uint(bits) + 1).Set(x)
+	for i := abs; i > 0; i >>= 1 {
+		if i&1 != 0 {
+			exact.Mul(exact, sq)
+		}
+		if i > 1 {
+			sq.Mul(sq, sq)
+		}
+	}
+	if n < 0 {
+		return b.new().Quo(big.NewFloat(1), exact)
+	}
+	return b.new().Set(exact)
+}
+
+// ---- EvalRat ----
+
+func ratTruth(t bool) *big.Rat {
+	if t {
+		return big.NewRat(1, 1)
+	}
+	return new(big.Rat)
+}
+
+func evalRat(e Expr, env RatEnv) *big.Rat {
+	switch e := e.(type) {
+	case Var:
+		x, ok := env[e]
+		if !ok {
+			bigErrorf("undefined variable: %s", e)
+		}
+		return new(big.Rat).Set(x)
+
+	case literal:
+		return decimal(float64(e))
+
+	case imaginary:
+		bigErrorf("%s has no real value", Format(e))
+
+	case unary:
+		x := evalRat(e.x, env)
+		switch e.op {
+		case '+':
+			return x
+		case '-':
+			return x.Neg(x)
+		case '!':
+			return ratTruth(x.Sign() == 0)
+		}
+
+	case binary:
+		switch e.op {
+		case tokAnd:
+			return ratTruth(evalRat(e.x, env).Sign() != 0 && evalRat(e.y, env).Sign() != 0)
+		case tokOr:
+			return ratTruth(evalRat(e.x, env).Sign() != 0 || evalRat(e.y, env).Sign() != 0)
+		}
+		x, y := evalRat(e.x, env), evalRat(e.y, env)
+		switch e.op {
+		case '+':
+			return x.Add(x, y)
+		case '-':
+			return x.Sub(x, y)
+		case '*':
+			return x.Mul(x, y)
+		case '/':
+			if y.Sign() == 0 {
+				bigErrorf("division by zero in %s", Format(e))
+			}
+			return x.Quo(x, y)
+		case '<':
+			return ratTruth(x.Cmp(y) < 0)
+		case '>':
+			return ratTruth(x.Cmp(y) > 0)
+		case tokLE:
+			return ratTruth(x.Cmp(y) <= 0)
+		case tokGE:
+			return ratTruth(x.Cmp(y) >= 0)
+		case tokEQ:
+			return ratTruth(x.Cmp(y) == 0)
+		case tokNE:
+			return ratTruth(x.Cmp(y) != 0)
+		}
+
+	case conditional:
+		if evalRat(e.cond, env).Sign() != 0 {
+			return evalRat(e.x, env)
+		}
+		return evalRat(e.y, env)
+
+	case call:
+		return evalRatCall(e, e.fun(), env)
+
+	case funcCall:
+		return evalRatCall(e.call, e.f, env)
+
+	case apply:
+		return evalRat(e.body, env)
+
+	case block:
+		local := make(RatEnv, len(env)+len(e.stmts))
+		for v, x := range env {
+			local[v] = x
+		}
+		result := new(big.Rat)
+		for _, s := range e.stmts {
+			if s.function {
+				result = new(big.Rat)
+				continue
+			}
+			result = evalRat(s.x, local)
+			if s.name != "" {
+				local[Var(s.name)] = result
+			}
+		}
+		return result
+	}
+	panic(fmt.Sprintf("unsupported Expr: %s", Format(e)))
+}
+
+// evalRatCall is like bigEval.evalCall for EvalRat.
+func evalRatCall(e call, f *Func, env RatEnv) *big.Rat {
+	if !isBuiltin(e.fn, f) {
+		bigErrorf("%s is not rational arithmetic", Format(e))
+	}
+	args := make([]*big.Rat, len(e.args))
+	for i, arg := range e.args {
+		args[i] = evalRat(arg, env)
+	}
+	return callRat(e, args)
+}
+
+func callRat(c call, args []*big.Rat) *big.Rat {
+	switch c.fn {
+	case "abs":
+		return args[0].Abs(args[0])
+	case "re", "conj":
+		return args[0]
+	case "im":
+		return new(big.Rat)
+	case "arg":
+		if args[0].Sign() >= 0 {
+			return new(big.Rat)
+		}
+	case "floor", "ceil", "round", "trunc":
+		return roundRat(c.fn, args[0])
+	case "max", "min":
+		x := args[0]
+		for _, y := range args[1:] {
+			if c.fn == "max" && y.Cmp(x) > 0 || c.fn == "min" && y.Cmp(x) < 0 {
+				x = y
+			}
+		}
+		return x
+	case "mod":
+		if args[1].Sign() == 0 {
+			bigErrorf("division by zero in %s", Format(c))
+		}
+		return modRat(args[0], args[1])
+	case "sqrt":
+		if r, ok := sqrtRat(args[0]); ok {
+			return r
+		}
+	case "hypot":
+		x, y := args[0], args[1]
+		x.Mul(x, x)
+		y.Mul(y, y)
+		if r, ok := sqrtRat(x.Add(x, y)); ok {
+			return r
+		}
+	case "pow":
+		x, y := args[0], args[1]
+		if !y.IsInt() || !y.Num().IsInt64() {
+			break
+		}
+		n := y.Num().Int64()
+		if x.Sign() == 0 && n < 0 {
+			bigErrorf("division by zero in %s", Format(c))
+		}
+		if n > maxPowBits || n < -maxPowBits ||
+			uint64(x.Num().BitLen()+x.Denom().BitLen())*uint64(abs64(n)) > maxPowBits {
+			bigErrorf("%s is too large to compute exactly", Format(c))
+		}
+		e := big.NewInt(abs64(n))
+		num := new(big.Int).Exp(x.Num(), e, nil)
+		den := new(big.Int).Exp(x.Denom(), e, nil)
+		if n < 0 {
+			num, den = den, num
+		}
+		return new(big.Rat).SetFrac(num, den)
+	}
+	bigErrorf("%s is not rational arithmetic", Format(c))
+	panic("unreachable")
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// roundRat rounds q to an integer as the function fn does:
+// floor, ceil, round (half away from zero) or trunc.
+func roundRat(fn string, q *big.Rat) *big.Rat {
+	num, den := q.Num(), q.Denom()
+	var z big.Int
+	switch fn {
+	case "floor":
+		z.Div(num, den) // Euclidean division, den > 0
+	case "ceil":
+		z.Neg(num)
+		z.Div(&z, den)
+		z.Neg(&z)
+	case "trunc":
+		z.Quo(num, den)
+	case "round":
+		// trunc(q + sign(q)/2) = trunc((2*num + sign*den) / (2*den))
+		twice := new(big.Int).Lsh(num, 1)
+		twice.Add(twice, new(big.Int).Mul(big.NewInt(int64(num.Sign())), den))
+		z.Quo(twice, new(big.Int).Lsh(den, 1))
+	}
+	return new(big.Rat).SetInt(&z)
+}
+
+// modRat returns x - y*trunc(x/y), like math.Mod.
+func modRat(x, y *big.Rat) *big.Rat {
+	q := roundRat("trunc", new(big.Rat).Quo(x, y))
+	q.Mul(q, y)
+	return q.Sub(x, q)
+}
+
+// sqrtRat returns the square root of q if it is rational.
+func sqrtRat(q *big.Rat) (*big.Rat, bool) {
+	if q.Sign() < 0 {
+		return nil, false
+	}
+	num := new(big.Int).Sqrt(q.Num())
+	den := new(big.Int).Sqrt(q.Denom())
+	if new(big.Int).Mul(num, num).Cmp(q.Num()) != 0 || new(big.Int).Mul(den, den).Cmp(q.Denom()) != 0 {
+		return nil, false
+	}
+	return new(big.Rat).SetFrac(num, den), true
+}
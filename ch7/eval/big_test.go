@@ -0,0 +1,157 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestEvalBig(t *testing.T) {
+	tests := []struct {
+		expr string
+		prec uint
+		want string // result to 40 digits, or error
+	}{
+		{"0.1 + 0.2 - 0.3", 200, "0"},
+		{"0.1 + 0.2 == 0.3", 53, "0"}, // as in float64
+		{"1 / 3", 100, "0.3333333333333333333333333333334648101509"},
+		{"sqrt(2)", 130, "1.414213562373095048801688724209698078569"},
+		{"hypot(x, 1)", 64, "2.236067977499789696414420059333849621908"},
+		{"pow(1.1, 100)", 100, "13780.61233982227018411833717248623179243"},
+		{"pow(x, -3)", 64, "0.125"},
+		{"pow(0, -1)", 64, "+Inf"},
+		{"1 / 0", 64, "+Inf"},
+		{"round(-2.5) + floor(-0.5) + ceil(0.5) + trunc(-1.7)", 64, "-4"},
+		{"mod(7.5, -2) + max(x, 3, 1) - min(abs(-x), 4)", 64, "2.5"},
+		{"r = 0.1 * x; f(a) = a * 3; f(r) - 0.6", 200, "0"},
+		{"x > 1 ? 1 / x : x", 64, "0.5"},
+		{"sin(x)", 64, "sin cannot be computed to 64 bits"},
+		{"pow(x, 0.5)", 64, "pow cannot be computed to 64 bits"},
+		{"pow(x, 1e9)", 64, "pow with exponent 1000000000 cannot be computed to 64 bits"},
+		{"0 / 0", 64, "result is not a number: division of zero by zero or infinity by infinity"},
+		{"sqrt(-x)", 64, "sqrt of negative number -2"},
+		{"y + 1", 64, "undefined variable: y"},
+		{"2i", 64, "2i has no real value"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		var got string
+		z, err := EvalBig(expr, BigEnv{"x": big.NewFloat(2)}, test.prec)
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = z.Text('g', 40)
+		}
+		if got != test.want {
+			t.Errorf("EvalBig(%s, %d) = %s, want %s", test.expr, test.prec, got, test.want)
+		}
+	}
+}
+
+// TestBigSqrt checks that sqrt and pow are correctly rounded.
+func TestBigSqrt(t *testing.T) {
+	sqrt, _ := Parse("sqrt(x)")
+	cube, _ := Parse("pow(x, 3)")
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		prec := uint(8 + rng.Intn(200)) // enough for the literal 3
+		x := new(big.Float).SetPrec(prec).SetFloat64(rng.ExpFloat64())
+		x.SetMantExp(x, rng.Intn(200)-100)
+
+		got, err := EvalBig(sqrt, BigEnv{"x": x}, prec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The square of the midpoint between got and each neighbor
+		// must be on the side of x toward that neighbor.
+		ulp := new(big.Float).SetMantExp(big.NewFloat(1), got.MantExp(nil)-int(prec))
+		midSquare := func(neighbor *big.Float) *big.Float {
+			mid := new(big.Float).SetPrec(prec+2).Add(got, neighbor)
+			mid.SetMantExp(mid, -1)
+			return mid.SetPrec(4*prec+8).Mul(mid, mid) // exact
+		}
+		below := midSquare(new(big.Float).SetPrec(prec+1).Sub(got, ulp))
+		above := midSquare(new(big.Float).SetPrec(prec+1).Add(got, ulp))
+		if below.Cmp(x) > 0 || above.Cmp(x) < 0 {
+			t.Errorf("sqrt(%s) at %d bits = %s, not correctly rounded",
+				x.Text('g', 50), prec, got.Text('g', 50))
+		}
+
+		got, err = EvalBig(cube, BigEnv{"x": x}, prec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := new(big.Float).SetPrec(3*prec).Mul(x, x)
+		want.Mul(want, x)
+		if want.SetPrec(prec); got.Cmp(want) != 0 {
+			t.Errorf("pow(%s, 3) at %d bits = %s, want %s",
+				x.Text('g', 50), prec, got.Text('g', 50), want.Text('g', 50))
+		}
+	}
+}
+
+func TestEvalRat(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string // result, or error
+	}{
+		{"0.1 + 0.2 - 0.3", "0"},
+		{"1 / 3 + x / 6", "2/3"},
+		{"pow(x, 10) / pow(3, -2)", "9216"},
+		{"pow(2 / 3, 3)", "8/27"},
+		{"sqrt(9 / 4) + hypot(3, 4)", "13/2"},
+		{"round(2.5) + round(-2.5) + floor(-1 / 3) + ceil(1 / 3) + trunc(-5 / 3)", "-1"},
+		{"mod(-7.5, 2) + abs(-x) + max(1, x, 1 / 2) * min(1 / 3, 3)", "7/6"},
+		{"1.5e-3 * 1e3", "3/2"},
+		{"x < 3 && !(x == 2.5) ? 1 / 7 : 0", "1/7"},
+		{"f(a, b) = a / b; r = f(x, 3); f(r, 2)", "1/3"},
+		{"sqrt(x)", "sqrt(x) is not rational arithmetic"},
+		{"exp(1)", "exp(1) is not rational arithmetic"},
+		{"pow(x, 0.5)", "pow(x, 0.5) is not rational arithmetic"},
+		{"x / (x - 2)", "division by zero in (x / (x - 2))"},
+		{"mod(x, 0)", "division by zero in mod(x, 0)"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		var got string
+		r, err := EvalRat(expr, RatEnv{"x": big.NewRat(2, 1)})
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = r.RatString()
+		}
+		if got != test.want {
+			t.Errorf("EvalRat(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestBigShadowed(t *testing.T) {
+	// A function passed to ParseFuncs in place of a built-in one
+	// is not mistaken for it.
+	sqrt := Funcs{"sqrt": {Arity: 1, Fn: func(args []float64) float64 { return args[0] + 1 }}}
+	expr, err := ParseFuncs("sqrt(4)", sqrt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expr.Eval(nil); got != 5 {
+		t.Errorf("Eval = %g, want 5", got)
+	}
+	if r, err := EvalRat(expr, nil); err == nil {
+		t.Errorf("EvalRat = %s, want error", r.RatString())
+	}
+	if x, err := EvalBig(expr, nil, 100); err == nil {
+		t.Errorf("EvalBig = %s, want error", x)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBlock(t *testing.T) {
+	tests := []struct {
+		input  string
+		env    Env
+		format string // expected output of Format
+		vars   string // expected free variables
+		want   string // expected result of Eval
+	}{
+		{"r = sqrt(x*x + y*y); sin(r) / r", Env{"x": 3, "y": 4},
+			"r = sqrt(((x * x) + (y * y))); (sin(r) / r)", "x y", "-0.191785"},
+		{"f(a, b) = a*b + 1; f(x, 2) + f(3, x)", Env{"x": 5},
+			"f(a, b) = ((a * b) + 1); (f(x, 2) + f(3, x))", "x", "27"},
+		{"k = 10; g(a) = a + k; g(1) * g(x);", Env{"x": 2},
+			"k = 10; g(a) = (a + k); (g(1) * g(x))", "x", "132"},
+		{"sq(a) = a*a; h(a) = sq(a) + sq(a + 1); h(x)", Env{"x": 2},
+			"sq(a) = (a * a); h(a) = (sq(a) + sq((a + 1))); h(x)", "x", "13"},
+		// Other variables in a function body are those
+		// where it is defined, not where it is called.
+		{"g(a) = a + x; f(x) = g(1) * x; f(3)", Env{"x": 100},
+			"g(a) = (a + x); f(x) = (g(1) * x); f(3)", "x", "303"},
+		// A sequence ending with a definition has its value.
+		{"a = 2; b = a * 3", nil, "a = 2; b = (a * 3)", "", "6"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", test.input, err)
+			continue
+		}
+		vars := make(map[Var]bool)
+		if err := expr.Check(vars); err != nil {
+			t.Errorf("Check(%s): %v", test.input, err)
+			continue
+		}
+		if got := Format(expr); got != test.format {
+			t.Errorf("Format(%s) = %s, want %s", test.input, got, test.format)
+		}
+		if got := varList(vars); got != test.vars {
+			t.Errorf("Check(%s) vars = %q, want %q", test.input, got, test.vars)
+		}
+		got := fmt.Sprintf("%.6g", expr.Eval(test.env))
+		if got != test.want {
+			t.Errorf("%s.Eval() in %v = %s, want %s", test.input, test.env, got, test.want)
+		}
+
+		// Simplify, Derive and Compile must agree with Eval.
+		simple := Simplify(expr)
+		if got := fmt.Sprintf("%.6g", simple.Eval(test.env)); got != test.want {
+			t.Errorf("Simplify(%s) = %s, Eval() = %s, want %s",
+				test.input, Format(simple), got, test.want)
+		}
+		prog, err := Compile(expr, []Var{"x", "y"})
+		if err != nil {
+			t.Errorf("Compile(%s): %v", test.input, err)
+			continue
+		}
+		if got := fmt.Sprintf("%.6g", prog.Eval(test.env["x"], test.env["y"])); got != test.want {
+			t.Errorf("%s: compiled program in %v = %s, want %s", test.input, test.env, got, test.want)
+		}
+		if !vars["x"] {
+			continue
+		}
+		d, err := Derive(expr, "x")
+		if err != nil {
+			t.Errorf("Derive(%s): %v", test.input, err)
+			continue
+		}
+		want := numericDerivative(expr, test.env, "x")
+		if got := d.Eval(test.env); math.Abs(got-want) > 1e-5*math.Max(1, math.Abs(want)) {
+			t.Errorf("Derive(%s) = %s; at %v got %g, want %g",
+				test.input, Format(d), test.env, got, want)
+		}
+	}
+}
+
+func TestBlockErrors(t *testing.T) {
+	for _, test := range []struct{ input, want string }{
+		{"y = r + 1; r = 2; y", "1:5: variable r used before definition"},
+		{"a = f(1); f(x) = x; a", "1:5: function f used before definition"},
+		{"f(x) = x * g(x); g(x) = 1; f(2)", "1:12: function g used before definition"},
+		{"r = 1; r = 2; r", "1:8: r redefined"},
+		{"f(a, a) = a; f(1, 2)", "1:1: duplicate parameter a of f"},
+		{"f(a) = a; f(1, 2)", "1:11: call to f has 2 args, want 1"},
+		{"x; y", "1:1: expression value is not used"},
+		{"f(1) = 2; 3", "1:1: parameter of f is not a name"},
+		{"x + 1 = 2", "1:7: cannot assign to (x + 1)"},
+		{"f(x) = x; f(a) = 2; f(1)", "1:11: f redefined"},
+	} {
+		expr, err := Parse(test.input)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		var got string
+		switch err := err.(type) {
+		case *Error:
+			got = fmt.Sprintf("%s: %s", err.Pos, err.Msg)
+		case ErrorList:
+			got = fmt.Sprintf("%s: %s", err[0].Pos, err[0].Msg)
+		default:
+			got = fmt.Sprint(err)
+		}
+		if got != test.want {
+			t.Errorf("%s: got %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestBlockSimplify(t *testing.T) {
+	for _, test := range []struct{ input, want string }{
+		{"a = 2 * 3; unused = x; a * x", "a = 6; (a * x)"},
+		{"f(t) = t * 1; g(t) = 0; f(x + 0)", "f(t) = t; f(x)"},
+		{"r = x * 1; r + 0", "r = x; r"},
+	} {
+		expr, err := Parse(test.input)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := Format(Simplify(expr)); got != test.want {
+			t.Errorf("Simplify(%s) = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func varList(vars map[Var]bool) string {
+	var list []string
+	for v := range vars {
+		list = append(list, string(v))
+	}
+	sort.Strings(list)
+	return strings.Join(list, " ")
+}
+
+func TestRun(t *testing.T) {
+	env := Env{}
+	funcs := Funcs{}
+	for _, test := range []struct{ input, want string }{
+		{"a = 2; b = a * 3", "6"},
+		{"a + b", "8"},
+		{"sq(x) = x * x; k = 10", "10"},
+		{"f(x) = sq(x) + k", "0"},
+		{"k = 1; f(a) + k", "15"}, // f uses k as it was when f was defined
+		{"b = sq(3)", "9"},
+	} {
+		expr, err := ParseFuncs(test.input, funcs)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if got := fmt.Sprintf("%.6g", Run(expr, env, funcs)); got != test.want {
+			t.Errorf("Run(%s) = %s, want %s", test.input, got, test.want)
+		}
+	}
+	if got, want := fmt.Sprint(env), "map[a:2 b:9 k:1]"; got != want {
+		t.Errorf("env = %s, want %s", got, want)
+	}
+}
+
+func TestApplyAllocs(t *testing.T) {
+	expr, err := Parse("f(a) = a*a + 1; f(x) * f(y)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := expr.(block).stmts[1].x // f(x) * f(y)
+	env := Env{"x": 1, "y": 2}
+	if n := testing.AllocsPerRun(100, func() { body.Eval(env) }); n != 0 {
+		t.Errorf("Eval of applications allocates %v times, want 0", n)
+	}
+}
@@ -19,40 +19,150 @@ func (literal) Check(vars map[Var]bool) error {
 	return nil
 }
 
+func (imaginary) Check(vars map[Var]bool) error {
+	return nil
+}
+
 func (u unary) Check(vars map[Var]bool) error {
-	if !strings.ContainsRune("+-", u.op) {
-		return fmt.Errorf("unexpected unary op %q", u.op)
+	if !strings.ContainsRune("+-!", u.op) {
+		return errorList(fmt.Errorf("unexpected unary op %q", u.op), u.x.Check(vars))
 	}
 	return u.x.Check(vars)
 }
 
 func (b binary) Check(vars map[Var]bool) error {
-	if !strings.ContainsRune("+-*/", b.op) {
-		return fmt.Errorf("unexpected binary op %q", b.op)
+	var err error
+	switch b.op {
+	case '+', '-', '*', '/', '<', '>', tokLE, tokGE, tokEQ, tokNE, tokAnd, tokOr:
+	default:
+		err = fmt.Errorf("unexpected binary op %q", b.op)
 	}
-	if err := b.x.Check(vars); err != nil {
-		return err
-	}
-	return b.y.Check(vars)
+	return errorList(err, b.x.Check(vars), b.y.Check(vars))
 }
 
 func (c call) Check(vars map[Var]bool) error {
-	arity, ok := numParams[c.fn]
-	if !ok {
-		return fmt.Errorf("unknown function %q", c.fn)
+	return c.checkWith(c.fun(), Pos{}, vars)
+}
+
+func (c funcCall) Check(vars map[Var]bool) error {
+	return c.checkWith(c.f, c.pos, vars)
+}
+
+// checkWith checks the call as a call of f, reporting any problem
+// with the call itself at pos.
+func (c call) checkWith(f *Func, pos Pos, vars map[Var]bool) error {
+	errs := []error{c.checkArity(f, pos)}
+	for _, arg := range c.args {
+		errs = append(errs, arg.Check(vars))
 	}
-	if len(c.args) != arity {
-		return fmt.Errorf("call to %s has %d args, want %d",
+	return errorList(errs...)
+}
+
+// checkArity reports whether f is a known function
+// that takes the arguments of c.
+func (c call) checkArity(f *Func, pos Pos) error {
+	var msg string
+	if f == nil {
+		msg = fmt.Sprintf("unknown function %q", c.fn)
+	} else if arity := f.Arity; arity < 0 {
+		if len(c.args) == 0 {
+			msg = fmt.Sprintf("call to %s has 0 args, want at least 1", c.fn)
+		}
+	} else if len(c.args) != arity {
+		msg = fmt.Sprintf("call to %s has %d args, want %d",
 			c.fn, len(c.args), arity)
 	}
-	for _, arg := range c.args {
-		if err := arg.Check(vars); err != nil {
-			return err
-		}
+	if msg == "" {
+		return nil
 	}
-	return nil
+	return &Error{pos, c.fn, msg}
 }
 
-var numParams = map[string]int{"pow": 2, "sin": 1, "sqrt": 1}
-
 //!-Check
+
+func (c conditional) Check(vars map[Var]bool) error {
+	return errorList(c.cond.Check(vars), c.x.Check(vars), c.y.Check(vars))
+}
+
+func (a apply) Check(vars map[Var]bool) error {
+	var errs []error
+	if len(a.args) != len(a.def.params) {
+		errs = append(errs, &Error{a.pos, a.fn, fmt.Sprintf(
+			"call to %s has %d args, want %d", a.fn, len(a.args), len(a.def.params))})
+	}
+	for _, arg := range a.args {
+		errs = append(errs, arg.Check(vars))
+	}
+	return errorList(errs...)
+}
+
+// Check checks each statement of the block in the scope of the
+// definitions that precede it. It reports a name that is defined twice,
+// or used before its definition, and adds the variables that are not
+// defined by the block to vars.
+func (b block) Check(vars map[Var]bool) error {
+	// Note where each name is defined so as to recognize
+	// uses that come before the definition.
+	varDefs := make(map[Var]int)
+	funcDefs := make(map[string]int)
+	for i := len(b.stmts) - 1; i >= 0; i-- {
+		if s := b.stmts[i]; s.function {
+			funcDefs[s.name] = i
+		} else if s.name != "" {
+			varDefs[Var(s.name)] = i
+		}
+	}
+
+	var errs []error
+	defined := make(map[Var]bool)      // variables defined so far
+	definedFn := make(map[string]bool) // functions defined so far
+	for i, s := range b.stmts {
+		local := make(map[Var]bool)
+		err := s.x.Check(local)
+		if list, ok := err.(ErrorList); ok {
+			// A call of an unknown function that is defined
+			// later is a use before definition.
+			for _, e := range list {
+				j, ok := funcDefs[e.Token]
+				if ok && j >= i && e.Msg == fmt.Sprintf("unknown function %q", e.Token) {
+					e.Msg = fmt.Sprintf("function %s used before definition", e.Token)
+				}
+			}
+		}
+		errs = append(errs, err)
+
+		params := make(map[Var]bool)
+		for _, p := range s.params {
+			if params[p] {
+				errs = append(errs, &Error{s.pos, s.name,
+					fmt.Sprintf("duplicate parameter %s of %s", p, s.name)})
+			}
+			params[p] = true
+		}
+		for v := range local {
+			switch j, ok := varDefs[v]; {
+			case params[v] || defined[v]:
+				// a parameter or an earlier variable
+			case ok && j >= i:
+				for _, u := range s.uses {
+					if u.v == v {
+						errs = append(errs, &Error{u.pos, string(v),
+							fmt.Sprintf("variable %s used before definition", v)})
+					}
+				}
+			default:
+				vars[v] = true
+			}
+		}
+
+		switch {
+		case s.function && definedFn[s.name], !s.function && defined[Var(s.name)]:
+			errs = append(errs, &Error{s.pos, s.name, fmt.Sprintf("%s redefined", s.name)})
+		case s.function:
+			definedFn[s.name] = true
+		case s.name != "":
+			defined[Var(s.name)] = true
+		}
+	}
+	return errorList(errs...)
+}
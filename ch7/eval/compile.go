@@ -0,0 +1,374 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// A Program is an expression compiled to instructions for a stack
+// machine. Variables are read from fixed slots instead of an Env,
+// making it much faster than Eval when the same expression is
+// evaluated many times.
+type Program struct {
+	vars   []Var
+	code   []instr
+	consts []float64
+	funcs  []*Func
+	nslots int // number of slots, including those for vars
+	depth  int // maximum stack depth
+}
+
+type opcode uint8
+
+const (
+	opConst     opcode = iota // push consts[arg]
+	opVar                     // push slots[arg]
+	opStore                   // pop x, store it in slots[arg]
+	opNeg                     // negate top of stack
+	opAdd                     // pop y, pop x, push x+y
+	opSub                     // pop y, pop x, push x-y
+	opMul                     // pop y, pop x, push x*y
+	opDiv                     // pop y, pop x, push x/y
+	opLT                      // pop y, pop x, push x<y
+	opGT                      // pop y, pop x, push x>y
+	opLE                      // pop y, pop x, push x<=y
+	opGE                      // pop y, pop x, push x>=y
+	opEQ                      // pop y, pop x, push x==y
+	opNE                      // pop y, pop x, push x!=y
+	opNot                     // replace top of stack x by !x
+	opTruth                   // replace top of stack x by x!=0
+	opJump                    // jump to code[arg]
+	opJumpFalse               // pop x, jump to code[arg] if x is zero
+	opCall                    // pop n args, push funcs[arg](args)
+)
+
+var binaryOps = map[rune]opcode{
+	'+':   opAdd,
+	'-':   opSub,
+	'*':   opMul,
+	'/':   opDiv,
+	'<':   opLT,
+	'>':   opGT,
+	tokLE: opLE,
+	tokGE: opGE,
+	tokEQ: opEQ,
+	tokNE: opNE,
+}
+
+type instr struct {
+	op  opcode
+	arg int
+	n   int // number of arguments to opCall
+}
+
+// Compile compiles e to a Program whose i'th slot holds the value of
+// vars[i]. It reports an error if e fails Check or uses a variable
+// that is not in vars.
+func Compile(e Expr, vars []Var) (*Program, error) {
+	used := make(map[Var]bool)
+	if err := e.Check(used); err != nil {
+		return nil, err
+	}
+	c := &compiler{
+		prog:   &Program{vars: vars},
+		slots:  make(map[Var]int),
+		consts: make(map[uint64]int),
+	}
+	for i, v := range vars {
+		if _, ok := c.slots[v]; !ok {
+			c.slots[v] = i
+		}
+	}
+	for v := range used {
+		if _, ok := c.slots[v]; !ok {
+			return nil, fmt.Errorf("undefined variable: %s", v)
+		}
+	}
+	c.prog.nslots = len(vars)
+	c.compile(e)
+	return c.prog, nil
+}
+
+// Vars returns the variables of the program, in slot order.
+func (p *Program) Vars() []Var { return p.vars }
+
+// Eval returns the value of the program when the variables have the
+// values vals, in slot order. Unlike VM.Run, it allocates a new stack
+// on each call.
+func (p *Program) Eval(vals ...float64) float64 {
+	var vm VM
+	return vm.Run(p, vals)
+}
+
+// A compiler holds the state of the compilation of one Program.
+type compiler struct {
+	prog   *Program
+	slots  map[Var]int    // slot of each variable
+	params map[Var]int    // slot of each parameter of the function being compiled
+	consts map[uint64]int // index of each constant, by its bits
+	sp     int            // current stack depth
+}
+
+func (c *compiler) emit(op opcode, arg, n int) {
+	c.prog.code = append(c.prog.code, instr{op, arg, n})
+	switch op {
+	case opConst, opVar:
+		c.sp++
+	case opStore, opAdd, opSub, opMul, opDiv, opLT, opGT, opLE, opGE, opEQ, opNE, opJumpFalse:
+		c.sp--
+	case opCall:
+		c.sp -= n - 1
+	}
+	if c.sp > c.prog.depth {
+		c.prog.depth = c.sp
+	}
+}
+
+// jump emits a jump instruction and returns its address,
+// to be patched by label once the destination is known.
+func (c *compiler) jump(op opcode) int {
+	c.emit(op, -1, 0)
+	return len(c.prog.code) - 1
+}
+
+// label sets the destination of the jump at addr to the next instruction.
+func (c *compiler) label(addr int) {
+	c.prog.code[addr].arg = len(c.prog.code)
+}
+
+// branches compiles x and y as alternatives, each of which pushes one
+// value; control reaches the code for y only by the jump at skip.
+func (c *compiler) branches(x, y func(), skip int) {
+	sp := c.sp
+	x()
+	end := c.jump(opJump)
+	c.label(skip)
+	c.sp = sp
+	y()
+	c.label(end)
+}
+
+func (c *compiler) compile(e Expr) {
+	switch e := e.(type) {
+	case Var:
+		if slot, ok := c.params[e]; ok {
+			c.emit(opVar, slot, 0)
+		} else {
+			c.emit(opVar, c.slots[e], 0)
+		}
+
+	case literal:
+		c.constant(float64(e))
+
+	case imaginary:
+		c.constant(math.NaN()) // as for Eval
+
+	case unary:
+		c.compile(e.x)
+		switch e.op {
+		case '-':
+			c.emit(opNeg, 0, 0)
+		case '!':
+			c.emit(opNot, 0, 0)
+		}
+
+	case binary:
+		switch e.op {
+		case tokAnd:
+			// x && y  =>  x ? y != 0 : 0
+			c.compile(e.x)
+			skip := c.jump(opJumpFalse)
+			c.branches(func() {
+				c.compile(e.y)
+				c.emit(opTruth, 0, 0)
+			}, func() {
+				c.constant(0)
+			}, skip)
+			return
+		case tokOr:
+			// x || y  =>  x ? 1 : y != 0
+			c.compile(e.x)
+			skip := c.jump(opJumpFalse)
+			c.branches(func() {
+				c.constant(1)
+			}, func() {
+				c.compile(e.y)
+				c.emit(opTruth, 0, 0)
+			}, skip)
+			return
+		}
+		c.compile(e.x)
+		c.compile(e.y)
+		c.emit(binaryOps[e.op], 0, 0)
+
+	case conditional:
+		c.compile(e.cond)
+		skip := c.jump(opJumpFalse)
+		c.branches(func() { c.compile(e.x) }, func() { c.compile(e.y) }, skip)
+
+	case call:
+		c.call(e, e.fun())
+
+	case funcCall:
+		c.call(e.call, e.f)
+
+	case apply:
+		// Store the arguments in new slots for the parameters,
+		// then compile the body of the function in their scope.
+		params := make(map[Var]int)
+		for i, arg := range e.args {
+			c.compile(arg)
+			params[e.def.params[i]] = c.store()
+		}
+		saved := c.params
+		c.params = params
+		c.compile(e.def.x)
+		c.params = saved
+
+	case block:
+		for i, s := range e.stmts {
+			last := i == len(e.stmts)-1
+			switch {
+			case s.function && last:
+				c.constant(0) // the value of the block
+			case s.function:
+				// compiled where it is applied
+			case s.name == "":
+				c.compile(s.x)
+			default:
+				c.compile(s.x)
+				slot := c.store()
+				c.slots[Var(s.name)] = slot
+				if last {
+					c.emit(opVar, slot, 0) // the value of the block
+				}
+			}
+		}
+
+	default:
+		panic(fmt.Sprintf("unknown Expr: %T", e))
+	}
+}
+
+// call emits code for a call of the function f.
+func (c *compiler) call(e call, f *Func) {
+	for _, arg := range e.args {
+		c.compile(arg)
+	}
+	c.emit(opCall, len(c.prog.funcs), len(e.args))
+	c.prog.funcs = append(c.prog.funcs, f)
+}
+
+// store emits code to pop a value into a new slot, and returns the slot.
+func (c *compiler) store() int {
+	slot := c.prog.nslots
+	c.prog.nslots++
+	c.emit(opStore, slot, 0)
+	return slot
+}
+
+// constant emits code to push x.
+func (c *compiler) constant(x float64) {
+	bits := math.Float64bits(x) // distinguishes -0 from 0
+	i, ok := c.consts[bits]
+	if !ok {
+		i = len(c.prog.consts)
+		c.prog.consts = append(c.prog.consts, x)
+		c.consts[bits] = i
+	}
+	c.emit(opConst, i, 0)
+}
+
+// A VM is a stack machine that runs Programs. Its stack is reused from
+// one call to the next, so Run does not allocate once the stack has
+// grown, but a VM must not be used by more than one goroutine at a time.
+// The zero value is ready to use.
+type VM struct {
+	stack []float64
+	slots []float64
+}
+
+// Run returns the value of p when the variables have the values vals,
+// in slot order. It panics if there are fewer values than variables.
+func (vm *VM) Run(p *Program, vals []float64) float64 {
+	if len(vals) < len(p.vars) {
+		panic(fmt.Sprintf("eval: program has %d variables, got %d values",
+			len(p.vars), len(vals)))
+	}
+	if len(vm.stack) < p.depth {
+		vm.stack = make([]float64, p.depth)
+	}
+	if len(vm.slots) < p.nslots {
+		vm.slots = make([]float64, p.nslots)
+	}
+	slots := vm.slots
+	copy(slots, vals[:len(p.vars)])
+	s := vm.stack
+	sp := 0
+	for pc := 0; pc < len(p.code); {
+		in := p.code[pc]
+		pc++
+		switch in.op {
+		case opConst:
+			s[sp] = p.consts[in.arg]
+			sp++
+		case opVar:
+			s[sp] = slots[in.arg]
+			sp++
+		case opStore:
+			sp--
+			slots[in.arg] = s[sp]
+		case opNeg:
+			s[sp-1] = -s[sp-1]
+		case opAdd:
+			sp--
+			s[sp-1] += s[sp]
+		case opSub:
+			sp--
+			s[sp-1] -= s[sp]
+		case opMul:
+			sp--
+			s[sp-1] *= s[sp]
+		case opDiv:
+			sp--
+			s[sp-1] /= s[sp]
+		case opLT:
+			sp--
+			s[sp-1] = truth(s[sp-1] < s[sp])
+		case opGT:
+			sp--
+			s[sp-1] = truth(s[sp-1] > s[sp])
+		case opLE:
+			sp--
+			s[sp-1] = truth(s[sp-1] <= s[sp])
+		case opGE:
+			sp--
+			s[sp-1] = truth(s[sp-1] >= s[sp])
+		case opEQ:
+			sp--
+			s[sp-1] = truth(s[sp-1] == s[sp])
+		case opNE:
+			sp--
+			s[sp-1] = truth(s[sp-1] != s[sp])
+		case opNot:
+			s[sp-1] = truth(s[sp-1] == 0)
+		case opTruth:
+			s[sp-1] = truth(s[sp-1] != 0)
+		case opJump:
+			pc = in.arg
+		case opJumpFalse:
+			sp--
+			if s[sp] == 0 {
+				pc = in.arg
+			}
+		case opCall:
+			sp -= in.n
+			s[sp] = p.funcs[in.arg].Fn(s[sp : sp+in.n])
+			sp++
+		}
+	}
+	return s[0]
+}
@@ -0,0 +1,109 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var compileTests = []string{
+	"3.5",
+	"x",
+	"-x + +y",
+	"5 / 9 * (F - 32)",
+	"sqrt(A / pi)",
+	"pow(x, 3) + pow(y, 3)",
+	"sin(r) / r",
+	"max(x, y, F, 2) - min(A, 1)",
+	"atan2(y, x) * hypot(x, y) / (1 + abs(x*y))",
+}
+
+func TestCompile(t *testing.T) {
+	vars := []Var{"x", "y", "r", "F", "A", "pi"}
+	rng := rand.New(rand.NewSource(1))
+	var vm VM
+	for _, s := range compileTests {
+		expr, err := Parse(s)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		prog, err := Compile(expr, vars)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", s, err)
+			continue
+		}
+		for i := 0; i < 10; i++ {
+			vals := make([]float64, len(vars))
+			env := Env{}
+			for j, v := range vars {
+				vals[j] = rng.NormFloat64() * 10
+				env[v] = vals[j]
+			}
+			want := expr.Eval(env)
+			got := vm.Run(prog, vals)
+			if got != want && !(math.IsNaN(got) && math.IsNaN(want)) {
+				t.Errorf("%s: in %v, Run = %g, Eval = %g", s, env, got, want)
+			}
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, test := range []struct{ expr, wantErr string }{
+		{"x + z", "undefined variable: z"},
+		{"cot(x)", `unknown function "cot"`},
+		{"sqrt(x, y)", "call to sqrt has 2 args, want 1"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		_, err = Compile(expr, []Var{"x", "y"})
+		if err == nil || err.Error() != test.wantErr {
+			t.Errorf("Compile(%s) = %v, want %s", test.expr, err, test.wantErr)
+		}
+	}
+}
+
+func TestRunAllocs(t *testing.T) {
+	expr, _ := Parse("sin(r) / r + pow(x, 2) * max(x, y)")
+	prog, err := Compile(expr, []Var{"x", "y", "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vm VM
+	vals := []float64{1, 2, 3}
+	if n := testing.AllocsPerRun(100, func() { vm.Run(prog, vals) }); n != 0 {
+		t.Errorf("Run allocates %v times per call, want 0", n)
+	}
+}
+
+const benchExpr = "sin(sqrt(x*x + y*y)) / sqrt(x*x + y*y) + pow(x, 2) / 100"
+
+func BenchmarkEval(b *testing.B) {
+	expr, _ := Parse(benchExpr)
+	env := Env{"x": 1, "y": 2}
+	for i := 0; i < b.N; i++ {
+		env["x"] = float64(i)
+		expr.Eval(env)
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	expr, _ := Parse(benchExpr)
+	prog, err := Compile(expr, []Var{"x", "y"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	var vm VM
+	vals := []float64{1, 2}
+	for i := 0; i < b.N; i++ {
+		vals[0] = float64(i)
+		vm.Run(prog, vals)
+	}
+}
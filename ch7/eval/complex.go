@@ -0,0 +1,142 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math/cmplx"
+)
+
+// A ComplexEnv maps variables to complex values, for EvalComplex.
+type ComplexEnv map[Var]complex128
+
+// The EvalComplex methods evaluate an expression over the complex
+// numbers. The arithmetic operators and functions with a complex
+// version (see Func) are those of complex128 and math/cmplx.
+// Ordered comparisons compare only the real parts, and, as for Eval,
+// comparisons and logical operators yield 1 for true and 0 for false;
+// any nonzero operand is considered true.
+
+func (v Var) EvalComplex(env ComplexEnv) complex128 {
+	return env[v]
+}
+
+func (l literal) EvalComplex(_ ComplexEnv) complex128 {
+	return complex(float64(l), 0)
+}
+
+func (i imaginary) EvalComplex(_ ComplexEnv) complex128 {
+	return complex(0, float64(i))
+}
+
+func (u unary) EvalComplex(env ComplexEnv) complex128 {
+	switch u.op {
+	case '+':
+		return +u.x.EvalComplex(env)
+	case '-':
+		// Subtract from zero so that, e.g., -4 has an imaginary part
+		// of +0, not -0, and sqrt(-4) is 2i, not -2i.
+		return 0 - u.x.EvalComplex(env)
+	case '!':
+		return ctruth(u.x.EvalComplex(env) == 0)
+	}
+	panic(fmt.Sprintf("unsupported unary operator: %q", u.op))
+}
+
+func (b binary) EvalComplex(env ComplexEnv) complex128 {
+	switch b.op {
+	case '+':
+		return b.x.EvalComplex(env) + b.y.EvalComplex(env)
+	case '-':
+		return b.x.EvalComplex(env) - b.y.EvalComplex(env)
+	case '*':
+		return b.x.EvalComplex(env) * b.y.EvalComplex(env)
+	case '/':
+		return b.x.EvalComplex(env) / b.y.EvalComplex(env)
+	case '<':
+		return ctruth(real(b.x.EvalComplex(env)) < real(b.y.EvalComplex(env)))
+	case '>':
+		return ctruth(real(b.x.EvalComplex(env)) > real(b.y.EvalComplex(env)))
+	case tokLE:
+		return ctruth(real(b.x.EvalComplex(env)) <= real(b.y.EvalComplex(env)))
+	case tokGE:
+		return ctruth(real(b.x.EvalComplex(env)) >= real(b.y.EvalComplex(env)))
+	case tokEQ:
+		return ctruth(b.x.EvalComplex(env) == b.y.EvalComplex(env))
+	case tokNE:
+		return ctruth(b.x.EvalComplex(env) != b.y.EvalComplex(env))
+	case tokAnd:
+		return ctruth(b.x.EvalComplex(env) != 0 && b.y.EvalComplex(env) != 0)
+	case tokOr:
+		return ctruth(b.x.EvalComplex(env) != 0 || b.y.EvalComplex(env) != 0)
+	}
+	panic(fmt.Sprintf("unsupported binary operator: %q", b.op))
+}
+
+func (c conditional) EvalComplex(env ComplexEnv) complex128 {
+	if c.cond.EvalComplex(env) != 0 {
+		return c.x.EvalComplex(env)
+	}
+	return c.y.EvalComplex(env)
+}
+
+// EvalComplex calls the complex version of the function, if any.
+// Otherwise it calls the real version if all the arguments are real,
+// and returns NaN if they are not.
+func (c call) EvalComplex(env ComplexEnv) complex128 {
+	return c.evalComplexWith(c.fun(), env)
+}
+
+func (c funcCall) EvalComplex(env ComplexEnv) complex128 {
+	return c.evalComplexWith(c.f, env)
+}
+
+func (c call) evalComplexWith(f *Func, env ComplexEnv) complex128 {
+	if f == nil {
+		panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+	}
+	args := make([]complex128, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.EvalComplex(env)
+	}
+	if f.Complex != nil {
+		return f.Complex(args)
+	}
+	reals := make([]float64, len(args))
+	for i, z := range args {
+		if imag(z) != 0 {
+			return cmplx.NaN()
+		}
+		reals[i] = real(z)
+	}
+	return complex(f.Fn(reals), 0)
+}
+
+func (a apply) EvalComplex(env ComplexEnv) complex128 {
+	return a.body.EvalComplex(env)
+}
+
+func (b block) EvalComplex(env ComplexEnv) complex128 {
+	local := make(ComplexEnv, len(env)+len(b.stmts))
+	for v, z := range env {
+		local[v] = z
+	}
+	var result complex128
+	for _, s := range b.stmts {
+		if s.function {
+			result = 0
+			continue
+		}
+		result = s.x.EvalComplex(local)
+		if s.name != "" {
+			local[Var(s.name)] = result
+		}
+	}
+	return result
+}
+
+// ctruth returns 1 if b is true and 0 otherwise.
+func ctruth(b bool) complex128 {
+	return complex(truth(b), 0)
+}
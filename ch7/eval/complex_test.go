@@ -0,0 +1,86 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestEvalComplex(t *testing.T) {
+	tests := []struct {
+		expr   string
+		env    ComplexEnv
+		format string // expected output of Format
+		want   string // expected result of EvalComplex
+	}{
+		{"2i", nil, "2i", "(0+2i)"},
+		{"1.5e3i * 2", nil, "(1500i * 2)", "(0+3000i)"},
+		{"1i * 1i", nil, "(1i * 1i)", "(-1+0i)"},
+		{"z*z + c", ComplexEnv{"z": 1 + 1i, "c": -1}, "((z * z) + c)", "(-1+2i)"},
+		{"sqrt(-4)", nil, "sqrt((-4))", "(0+2i)"},
+		{"exp(1i * pi)", ComplexEnv{"pi": math.Pi}, "exp((1i * pi))", "(-1+1.22465e-16i)"},
+		{"abs(3 + 4i)", nil, "abs((3 + 4i))", "(5+0i)"},
+		{"re(z) + im(z) + arg(1i)", ComplexEnv{"z": 2 - 5i}, "((re(z) + im(z)) + arg(1i))", "(-1.4292+0i)"},
+		{"conj(z)", ComplexEnv{"z": 2 - 5i}, "conj(z)", "(2+5i)"},
+		{"pow(1i, 2)", nil, "pow(1i, 2)", "(-1+1.22465e-16i)"},
+		{"log2(8) + exp2(1i)", nil, "(log2(8) + exp2(1i))", "(3.76924+0.638961i)"},
+		// Functions without a complex version take real arguments only.
+		{"max(re(z), 1)", ComplexEnv{"z": 2 - 5i}, "max(re(z), 1)", "(2+0i)"},
+		{"floor(z)", ComplexEnv{"z": 2 - 5i}, "floor(z)", "(NaN+NaNi)"},
+		// Ordered comparisons use the real parts.
+		{"z < 3 && z != 2", ComplexEnv{"z": 2 - 5i}, "((z < 3) && (z != 2))", "(1+0i)"},
+		{"abs(z) > 2 ? 1 : 0", ComplexEnv{"z": 2 - 5i}, "((abs(z) > 2) ? 1 : 0)", "(1+0i)"},
+		{"w = z*z; w + conj(w)", ComplexEnv{"z": 1i}, "w = (z * z); (w + conj(w))", "(-2+0i)"},
+		{"f(a) = a*a + c; f(f(0))", ComplexEnv{"c": 1i}, "f(a) = ((a * a) + c); f(f(0))", "(-1+1i)"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := Format(expr); got != test.format {
+			t.Errorf("Format(%s) = %s, want %s", test.expr, got, test.format)
+		}
+		got := fmt.Sprintf("%.6g", expr.EvalComplex(test.env))
+		if got != test.want {
+			t.Errorf("%s.EvalComplex() in %v = %s, want %s", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+func TestImaginary(t *testing.T) {
+	// An imaginary number has no real value.
+	expr, err := Parse("x + 2i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expr.Eval(Env{"x": 1}); !math.IsNaN(got) {
+		t.Errorf("Eval(x + 2i) = %g, want NaN", got)
+	}
+	if d, err := Derive(expr, "x"); err != nil {
+		t.Errorf("Derive(x + 2i): %v", err)
+	} else if got := Format(d); got != "(1 + 0)" {
+		t.Errorf("Derive(x + 2i) = %s, want (1 + 0)", got)
+	}
+
+	for _, test := range []struct{ input, want string }{
+		{"2 i", "unexpected identifier i"},
+		{"2i3", "unexpected number 3"},
+		{"x(2i)", `unknown function "x"`},
+	} {
+		expr, err := Parse(test.input)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got %v, want %s", test.input, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// Derive returns the derivative of e with respect to v.
+// The result is not simplified.
+//
+// Derive reports an error if e calls a function whose derivative is
+// unknown, such as one that is not registered by default.
+func Derive(e Expr, v Var) (_ Expr, err error) {
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case deriveError:
+			err = x.err
+		default:
+			panic(x)
+		}
+	}()
+	d := &deriver{v: v, locals: make(map[Var]Expr)}
+	return d.derive(e), nil
+}
+
+// A deriveError is an error reported by Derive,
+// which panics with it and recovers.
+type deriveError struct{ err error }
+
+// A deriver differentiates with respect to v. For each variable
+// defined by a block, locals holds the expression for its derivative.
+type deriver struct {
+	v      Var
+	locals map[Var]Expr
+}
+
+func (d *deriver) derive(e Expr) Expr {
+	switch e := e.(type) {
+	case Var:
+		if dx, ok := d.locals[e]; ok {
+			return dx
+		}
+		if e == d.v {
+			return literal(1)
+		}
+		return literal(0)
+
+	case literal, imaginary:
+		return literal(0)
+
+	case unary:
+		if e.op == '!' {
+			return literal(0) // piecewise constant
+		}
+		return unary{e.op, d.derive(e.x)}
+
+	case binary:
+		dx, dy := d.derive(e.x), d.derive(e.y)
+		switch e.op {
+		case '+', '-':
+			return binary{e.op, dx, dy}
+		case '*':
+			// (xy)' = x'y + xy'
+			return binary{'+', binary{'*', dx, e.y}, binary{'*', e.x, dy}}
+		case '/':
+			// (x/y)' = (x'y - xy') / y²
+			return binary{'/',
+				binary{'-', binary{'*', dx, e.y}, binary{'*', e.x, dy}},
+				binary{'*', e.y, e.y}}
+		case '<', '>', tokLE, tokGE, tokEQ, tokNE, tokAnd, tokOr:
+			return literal(0) // piecewise constant
+		}
+		panic(fmt.Sprintf("unsupported binary operator: %q", e.op))
+
+	case conditional:
+		return conditional{e.cond, d.derive(e.x), d.derive(e.y)}
+
+	case call:
+		return d.deriveCall(e, e.fun())
+
+	case funcCall:
+		return d.deriveCall(e.call, e.f)
+
+	case apply:
+		return d.derive(e.body)
+
+	case block:
+		// Define the derivative of each variable after the variable
+		// itself, so that later statements can refer to both.
+		names := make(map[Var]bool)
+		e.Check(names) // the errors don't matter here
+		for _, s := range e.stmts {
+			names[Var(s.name)] = true
+			for _, p := range s.params {
+				names[p] = true
+			}
+		}
+		var stmts []*stmt
+		for _, s := range e.stmts {
+			switch {
+			case s.function:
+				stmts = append(stmts, s)
+			case s.name == "":
+				stmts = append(stmts, &stmt{x: d.derive(s.x), pos: s.pos})
+			case !d.dependsOn(s.x):
+				stmts = append(stmts, s)
+				d.locals[Var(s.name)] = literal(0)
+			default:
+				name := "d" + s.name + "_d" + string(d.v)
+				for names[Var(name)] {
+					name += "_"
+				}
+				names[Var(name)] = true
+				stmts = append(stmts, s, &stmt{name: name, x: d.derive(s.x), pos: s.pos})
+				d.locals[Var(s.name)] = Var(name)
+			}
+		}
+		return block{stmts}
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+// deriveCall differentiates a call of f.
+func (d *deriver) deriveCall(e call, f *Func) Expr {
+	partials, ok := derivatives[e.fn]
+	if !ok || !isBuiltin(e.fn, f) {
+		panic(deriveError{fmt.Errorf("no derivative for function %s", e.fn)})
+	}
+	if partials == nil {
+		return d.derivePow(e)
+	}
+	// Chain rule: sum the partial derivatives of the
+	// function, each times the derivative of its argument.
+	var sum Expr
+	for i, p := range partials(e.args) {
+		term := binary{'*', p, d.derive(e.args[i])}
+		if sum == nil {
+			sum = term
+		} else {
+			sum = binary{'+', sum, term}
+		}
+	}
+	return sum
+}
+
+// derivePow applies the power rule to pow(x, y), avoiding the
+// logarithm of x unless the exponent actually depends on v.
+func (d *deriver) derivePow(e call) Expr {
+	x, y := e.args[0], e.args[1]
+	switch {
+	case !d.dependsOn(y):
+		// pow(x, y)' = y pow(x, y-1) x'
+		return binary{'*',
+			binary{'*', y, mkcall("pow", x, binary{'-', y, literal(1)})},
+			d.derive(x)}
+	case !d.dependsOn(x):
+		// pow(x, y)' = pow(x, y) log(x) y'
+		return binary{'*', binary{'*', e, mkcall("log", x)}, d.derive(y)}
+	default:
+		// pow(x, y)' = pow(x, y) (y' log(x) + y x' / x)
+		return binary{'*', e, binary{'+',
+			binary{'*', d.derive(y), mkcall("log", x)},
+			binary{'/', binary{'*', y, d.derive(x)}, x}}}
+	}
+}
+
+// dependsOn reports whether e depends on v,
+// directly or through a variable defined in terms of v.
+func (d *deriver) dependsOn(e Expr) bool {
+	switch e := e.(type) {
+	case Var:
+		if dx, ok := d.locals[e]; ok {
+			return dx != literal(0)
+		}
+		return e == d.v
+	case literal, imaginary:
+		return false
+	case unary:
+		return d.dependsOn(e.x)
+	case binary:
+		return d.dependsOn(e.x) || d.dependsOn(e.y)
+	case conditional:
+		return d.dependsOn(e.cond) || d.dependsOn(e.x) || d.dependsOn(e.y)
+	case call:
+		for _, arg := range e.args {
+			if d.dependsOn(arg) {
+				return true
+			}
+		}
+		return false
+	case funcCall:
+		return d.dependsOn(e.call)
+	case apply:
+		return d.dependsOn(e.body)
+	case block:
+		return true // conservatively
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+// newApply returns an application of the function defined by def.
+// The body with the arguments in place of the parameters is built
+// once, here, rather than each time the application is evaluated.
+func newApply(fn string, args []Expr, def *stmt, pos Pos) apply {
+	a := apply{fn: fn, args: args, def: def, pos: pos}
+	m := make(map[Var]Expr)
+	for i, p := range def.params {
+		if i < len(args) { // Check reports a mismatch
+			m[p] = args[i]
+		}
+	}
+	a.body = subst(def.x, m)
+	return a
+}
+
+// subst returns e with each variable in m replaced by its expression.
+// Blocks are not substituted.
+func subst(e Expr, m map[Var]Expr) Expr {
+	switch e := e.(type) {
+	case Var:
+		if x, ok := m[e]; ok {
+			return x
+		}
+		return e
+	case literal, imaginary:
+		return e
+	case unary:
+		return unary{e.op, subst(e.x, m)}
+	case binary:
+		return binary{e.op, subst(e.x, m), subst(e.y, m)}
+	case conditional:
+		return conditional{subst(e.cond, m), subst(e.x, m), subst(e.y, m)}
+	case call:
+		return call{e.fn, substAll(e.args, m)}
+	case funcCall:
+		return funcCall{call{e.fn, substAll(e.args, m)}, e.f, e.pos}
+	case apply:
+		return newApply(e.fn, substAll(e.args, m), e.def, e.pos)
+	}
+	panic(fmt.Sprintf("cannot substitute in %T", e))
+}
+
+func substAll(args []Expr, m map[Var]Expr) []Expr {
+	res := make([]Expr, len(args))
+	for i, arg := range args {
+		res[i] = subst(arg, m)
+	}
+	return res
+}
+
+// derivatives maps the name of each registered function to a function
+// that returns its partial derivatives with respect to each argument.
+// The entry for pow is nil because derivePow handles it specially.
+var derivatives = map[string]func(args []Expr) []Expr{
+	"pow":   nil,
+	"abs":   d1(func(x Expr) Expr { return binary{'/', x, mkcall("abs", x)} }),
+	"acos":  d1(func(x Expr) Expr { return unary{'-', recip(mkcall("sqrt", oneMinusSq(x)))} }),
+	"acosh": d1(func(x Expr) Expr { return recip(mkcall("sqrt", binary{'-', sq(x), literal(1)})) }),
+	"arg":   d1(func(x Expr) Expr { return literal(0) }),
+	"asin":  d1(func(x Expr) Expr { return recip(mkcall("sqrt", oneMinusSq(x))) }),
+	"asinh": d1(func(x Expr) Expr { return recip(mkcall("sqrt", binary{'+', sq(x), literal(1)})) }),
+	"atan":  d1(func(x Expr) Expr { return recip(binary{'+', literal(1), sq(x)}) }),
+	"atanh": d1(func(x Expr) Expr { return recip(oneMinusSq(x)) }),
+	"cbrt":  d1(func(x Expr) Expr { return recip(binary{'*', literal(3), sq(mkcall("cbrt", x))}) }),
+	"ceil":  d1(func(x Expr) Expr { return literal(0) }),
+	"conj":  d1(func(x Expr) Expr { return literal(1) }),
+	"cos":   d1(func(x Expr) Expr { return unary{'-', mkcall("sin", x)} }),
+	"cosh":  d1(func(x Expr) Expr { return mkcall("sinh", x) }),
+	"exp":   d1(func(x Expr) Expr { return mkcall("exp", x) }),
+	"exp2":  d1(func(x Expr) Expr { return binary{'*', mkcall("exp2", x), literal(math.Ln2)} }),
+	"floor": d1(func(x Expr) Expr { return literal(0) }),
+	"im":    d1(func(x Expr) Expr { return literal(0) }),
+	"log":   d1(func(x Expr) Expr { return recip(x) }),
+	"log10": d1(func(x Expr) Expr { return recip(binary{'*', x, literal(math.Ln10)}) }),
+	"log2":  d1(func(x Expr) Expr { return recip(binary{'*', x, literal(math.Ln2)}) }),
+	"max":   func(args []Expr) []Expr { return selectors(args, '>', tokGE) },
+	"min":   func(args []Expr) []Expr { return selectors(args, '<', tokLE) },
+	"re":    d1(func(x Expr) Expr { return literal(1) }),
+	"round": d1(func(x Expr) Expr { return literal(0) }),
+	"sin":   d1(func(x Expr) Expr { return mkcall("cos", x) }),
+	"sinh":  d1(func(x Expr) Expr { return mkcall("cosh", x) }),
+	"sqrt":  d1(func(x Expr) Expr { return recip(binary{'*', literal(2), mkcall("sqrt", x)}) }),
+	"tan":   d1(func(x Expr) Expr { return recip(sq(mkcall("cos", x))) }),
+	"tanh":  d1(func(x Expr) Expr { return oneMinusSq(mkcall("tanh", x)) }),
+	"trunc": d1(func(x Expr) Expr { return literal(0) }),
+	"atan2": func(args []Expr) []Expr {
+		y, x := args[0], args[1]
+		r2 := binary{'+', sq(x), sq(y)}
+		return []Expr{binary{'/', x, r2}, unary{'-', binary{'/', y, r2}}}
+	},
+	"hypot": func(args []Expr) []Expr {
+		x, y := args[0], args[1]
+		h := mkcall("hypot", x, y)
+		return []Expr{binary{'/', x, h}, binary{'/', y, h}}
+	},
+	"mod": func(args []Expr) []Expr {
+		x, y := args[0], args[1]
+		return []Expr{literal(1), unary{'-', mkcall("trunc", binary{'/', x, y})}}
+	},
+}
+
+// selectors returns the partial derivatives of min or max: the i'th is
+// 1 if args[i] is the first argument to be selected by the comparisons
+// lt and le, and 0 otherwise.
+func selectors(args []Expr, lt, le rune) []Expr {
+	partials := make([]Expr, len(args))
+	for i := range args {
+		var sel Expr
+		for j := range args {
+			var cmp Expr
+			switch {
+			case j < i:
+				cmp = binary{lt, args[i], args[j]}
+			case j > i:
+				cmp = binary{le, args[i], args[j]}
+			default:
+				continue
+			}
+			if sel == nil {
+				sel = cmp
+			} else {
+				sel = binary{tokAnd, sel, cmp}
+			}
+		}
+		if sel == nil {
+			sel = literal(1) // min or max of one argument
+		}
+		partials[i] = sel
+	}
+	return partials
+}
+
+func d1(f func(x Expr) Expr) func(args []Expr) []Expr {
+	return func(args []Expr) []Expr { return []Expr{f(args[0])} }
+}
+
+func sq(x Expr) Expr         { return binary{'*', x, x} }
+func recip(x Expr) Expr      { return binary{'/', literal(1), x} }
+func oneMinusSq(x Expr) Expr { return binary{'-', literal(1), sq(x)} }
@@ -0,0 +1,89 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDerive(t *testing.T) {
+	// Each derivative is compared against a central difference
+	// at a few points where the expression is smooth.
+	exprs := []string{
+		"3",
+		"y",
+		"x",
+		"-x + 2*x - y",
+		"x * x * x",
+		"1 / x",
+		"x / (1 + y*x)",
+		"pow(x, 3)",
+		"pow(2, x)",
+		"pow(x, x)",
+		"pow(x, y)",
+		"sin(x) * cos(y*x)",
+		"tan(x) + sqrt(x) + cbrt(x)",
+		"exp(2*x) + exp2(x) + log(x) + log10(x) + log2(x)",
+		"asin(x/4) + acos(x/4) + atan(x)",
+		"sinh(x) + cosh(x) + tanh(x) + asinh(x) + acosh(x+1) + atanh(x/4)",
+		"abs(x - 5)",
+		"atan2(x, y) + hypot(y, x)",
+		"mod(7, x) + floor(x) + ceil(x) + round(x) + trunc(x)",
+		"sin(sqrt(x*x + y*y)) / sqrt(x*x + y*y)",
+	}
+	points := []Env{
+		{"x": 0.3, "y": 1.7},
+		{"x": 1.9, "y": 0.4},
+		{"x": 2.6, "y": -1.1},
+	}
+	for _, s := range exprs {
+		expr, err := Parse(s)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		d, err := Derive(expr, "x")
+		if err != nil {
+			t.Errorf("Derive(%s): %v", s, err)
+			continue
+		}
+		if err := d.Check(map[Var]bool{}); err != nil {
+			t.Errorf("Derive(%s) = %s: %v", s, Format(d), err)
+			continue
+		}
+		for _, env := range points {
+			got := d.Eval(env)
+			want := numericDerivative(expr, env, "x")
+			if math.Abs(got-want) > 1e-5*math.Max(1, math.Abs(want)) {
+				t.Errorf("Derive(%s) = %s; at %v got %g, want %g",
+					s, Format(d), env, got, want)
+			}
+		}
+	}
+}
+
+func TestDeriveUnknown(t *testing.T) {
+	expr, err := ParseFuncs("f(x)", Funcs{"f": Lookup("sin")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Derive(expr, "x"); err == nil {
+		t.Errorf("Derive(f(x)) succeeded, want error")
+	}
+}
+
+func numericDerivative(e Expr, env Env, v Var) float64 {
+	const h = 1e-6
+	at := func(x float64) float64 {
+		env2 := Env{}
+		for k, val := range env {
+			env2[k] = val
+		}
+		env2[v] = x
+		return e.Eval(env2)
+	}
+	x := env[v]
+	return (at(x+h) - at(x-h)) / (2 * h)
+}
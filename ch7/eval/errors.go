@@ -0,0 +1,132 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Pos is a position in the input of Parse.
+// The zero Pos is not a valid position.
+type Pos struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number, starting at 1 (character count per line)
+}
+
+// IsValid reports whether the position is valid.
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// An Error describes a problem with an expression, such as a syntax
+// error or a call to an unknown function. Its Error method returns
+// just the message; Pos and Token locate the problem in the input.
+type Error struct {
+	Pos   Pos    // position of the offending token, if known
+	Token string // text of the offending token, or "" at end of input
+	Msg   string
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+// An ErrorList is a list of errors, ordered by position.
+// Check and Validate report all the problems they find as an ErrorList.
+type ErrorList []*Error
+
+func (list ErrorList) Error() string {
+	switch len(list) {
+	case 0:
+		return "no errors"
+	case 1:
+		return list[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", list[0], len(list)-1)
+}
+
+// errorList combines errs, any of which may be nil, *Error or ErrorList,
+// into a sorted ErrorList, or returns nil if there are no errors.
+func errorList(errs ...error) error {
+	var list ErrorList
+	for _, err := range errs {
+		switch err := err.(type) {
+		case nil:
+		case *Error:
+			list = append(list, err)
+		case ErrorList:
+			list = append(list, err...)
+		default:
+			list = append(list, &Error{Msg: err.Error()})
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Pos.Offset < list[j].Pos.Offset
+	})
+	return list
+}
+
+// PrintError prints err, an error returned by Parse, Check or Validate
+// for the given input, to w. Each error with a known position is shown
+// with its line of input and a caret marking the offending token:
+//
+//	1:9: unknown function "cot"
+//	  x + 1 / cot(x)
+//	          ^~~
+//
+// Other errors are printed on a line of their own.
+func PrintError(w io.Writer, input string, err error) {
+	var list ErrorList
+	switch err := err.(type) {
+	case *Error:
+		list = ErrorList{err}
+	case ErrorList:
+		list = err
+	default:
+		fmt.Fprintln(w, err)
+		return
+	}
+	lines := strings.Split(input, "\n")
+	for _, e := range list {
+		if !e.Pos.IsValid() || e.Pos.Line > len(lines) {
+			fmt.Fprintln(w, e.Msg)
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s\n", e.Pos, e.Msg)
+		line := lines[e.Pos.Line-1]
+		fmt.Fprintf(w, "  %s\n", line)
+
+		// Indent the caret like the text before the token,
+		// copying tabs so that it lines up however they are shown.
+		var marker strings.Builder
+		col := 1
+		for _, r := range line {
+			if col >= e.Pos.Column {
+				break
+			}
+			if r == '\t' {
+				marker.WriteByte('\t')
+			} else {
+				marker.WriteByte(' ')
+			}
+			col++
+		}
+		marker.WriteByte('^')
+		for n := utf8.RuneCountInString(e.Token); n > 1; n-- {
+			marker.WriteByte('~')
+		}
+		fmt.Fprintf(w, "  %s\n", marker.String())
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorPos(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		pos   string
+		token string
+		msg   string
+	}{
+		{"x % 2", "1:3", "%", "unexpected '%'"},
+		{"x +\n  y $", "2:5", "$", "unexpected '$'"},
+		{"sqrt(x", "1:7", "", "got end of file, want ')'"},
+		{"x && && y", "1:6", "&&", "unexpected '&&'"},
+		{"if(x, y)", "1:1", "if", "call to if has 2 args, want 3"},
+		{"été + 1 +", "1:10", "", "unexpected end of file"},
+	} {
+		_, err := Parse(test.input)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Parse(%q) = %v, want *Error", test.input, err)
+			continue
+		}
+		if got := fmt.Sprintf("%s %q %s", e.Pos, e.Token, e.Msg); got !=
+			fmt.Sprintf("%s %q %s", test.pos, test.token, test.msg) {
+			t.Errorf("Parse(%q): got %s", test.input, got)
+		}
+	}
+}
+
+func TestCheckAllErrors(t *testing.T) {
+	expr, err := Parse("cot(x) + sqrt(1, 2) * min() - f(sin(y, y))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = expr.Check(map[Var]bool{})
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Check returned %v, want ErrorList", err)
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, fmt.Sprintf("%s: %s", e.Pos, e.Msg))
+	}
+	want := []string{
+		`1:1: unknown function "cot"`,
+		`1:10: call to sqrt has 2 args, want 1`,
+		`1:23: call to min has 0 args, want at least 1`,
+		`1:31: unknown function "f"`,
+		`1:33: call to sin has 2 args, want 1`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Check errors:\n%s\nwant:\n%s",
+			strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if want := `unknown function "cot" (and 4 more errors)`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	vars := map[Var]bool{"x": true, "y": true}
+	if _, err := Validate("x * sin(y)", nil, vars); err != nil {
+		t.Errorf("Validate: unexpected error %v", err)
+	}
+
+	input := "x + z\n\t* cot(x) / zz(z)"
+	_, err := Validate(input, nil, vars)
+	if err == nil {
+		t.Fatal("Validate: unexpected success")
+	}
+	var buf bytes.Buffer
+	PrintError(&buf, input, err)
+	want := `1:5: undefined variable: z
+  x + z
+      ^
+2:4: unknown function "cot"
+  	* cot(x) / zz(z)
+  	  ^~~
+2:13: unknown function "zz"
+  	* cot(x) / zz(z)
+  	           ^~
+2:16: undefined variable: z
+  	* cot(x) / zz(z)
+  	              ^
+`
+	if buf.String() != want {
+		t.Errorf("PrintError:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -29,6 +29,12 @@ func (l literal) Eval(_ Env) float64 {
 
 //!-Eval1
 
+// Eval returns NaN, since an imaginary number has no real value.
+// Use EvalComplex to evaluate expressions with imaginary numbers.
+func (imaginary) Eval(_ Env) float64 {
+	return math.NaN()
+}
+
 //!+Eval2
 
 func (u unary) Eval(env Env) float64 {
@@ -37,6 +43,8 @@ func (u unary) Eval(env Env) float64 {
 		return +u.x.Eval(env)
 	case '-':
 		return -u.x.Eval(env)
+	case '!':
+		return truth(u.x.Eval(env) == 0)
 	}
 	panic(fmt.Sprintf("unsupported unary operator: %q", u.op))
 }
@@ -51,20 +59,125 @@ func (b binary) Eval(env Env) float64 {
 		return b.x.Eval(env) * b.y.Eval(env)
 	case '/':
 		return b.x.Eval(env) / b.y.Eval(env)
+	case '<':
+		return truth(b.x.Eval(env) < b.y.Eval(env))
+	case '>':
+		return truth(b.x.Eval(env) > b.y.Eval(env))
+	case tokLE:
+		return truth(b.x.Eval(env) <= b.y.Eval(env))
+	case tokGE:
+		return truth(b.x.Eval(env) >= b.y.Eval(env))
+	case tokEQ:
+		return truth(b.x.Eval(env) == b.y.Eval(env))
+	case tokNE:
+		return truth(b.x.Eval(env) != b.y.Eval(env))
+	case tokAnd:
+		return truth(b.x.Eval(env) != 0 && b.y.Eval(env) != 0)
+	case tokOr:
+		return truth(b.x.Eval(env) != 0 || b.y.Eval(env) != 0)
 	}
 	panic(fmt.Sprintf("unsupported binary operator: %q", b.op))
 }
 
 func (c call) Eval(env Env) float64 {
-	switch c.fn {
-	case "pow":
-		return math.Pow(c.args[0].Eval(env), c.args[1].Eval(env))
-	case "sin":
-		return math.Sin(c.args[0].Eval(env))
-	case "sqrt":
-		return math.Sqrt(c.args[0].Eval(env))
-	}
-	panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+	return c.evalWith(c.fun(), env)
 }
 
 //!-Eval2
+
+func (c funcCall) Eval(env Env) float64 {
+	return c.evalWith(c.f, env)
+}
+
+// evalWith evaluates the call as a call of f.
+func (c call) evalWith(f *Func, env Env) float64 {
+	if f == nil {
+		panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+	}
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.Eval(env)
+	}
+	return f.Fn(args)
+}
+
+func (c conditional) Eval(env Env) float64 {
+	if c.cond.Eval(env) != 0 {
+		return c.x.Eval(env)
+	}
+	return c.y.Eval(env)
+}
+
+// truth returns 1 if b is true and 0 otherwise.
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Eval evaluates the body of the function with the arguments in place
+// of its parameters. Other variables in the body have the values they
+// have where the function is defined, not where it is called.
+func (a apply) Eval(env Env) float64 {
+	return a.body.Eval(env)
+}
+
+func (b block) Eval(env Env) float64 {
+	local := make(Env, len(env)+len(b.stmts))
+	for v, x := range env {
+		local[v] = x
+	}
+	return b.run(local, nil)
+}
+
+// Run evaluates e in env, like Eval, except that if e is a sequence of
+// statements, the variables it defines remain in env afterwards, and
+// the functions it defines are added to funcs, if it is not nil, so
+// that expressions parsed later by ParseFuncs may call them.
+func Run(e Expr, env Env, funcs Funcs) float64 {
+	if b, ok := e.(block); ok {
+		return b.run(env, funcs)
+	}
+	return e.Eval(env)
+}
+
+// run evaluates the statements of the block in env, adding the
+// variables they define, and the functions to funcs if not nil.
+// A block ending with the definition of a function has the value 0.
+func (b block) run(env Env, funcs Funcs) float64 {
+	var result float64
+	for _, s := range b.stmts {
+		if s.function {
+			if funcs != nil {
+				funcs[s.name] = s.closure(env)
+			}
+			result = 0
+			continue
+		}
+		result = s.x.Eval(env)
+		if s.name != "" {
+			env[Var(s.name)] = result
+		}
+	}
+	return result
+}
+
+// closure returns a Func that applies the function defined by s.
+// Its other variables have the values they have in env now.
+func (s *stmt) closure(env Env) *Func {
+	captured := make(Env, len(env))
+	for v, x := range env {
+		captured[v] = x
+	}
+	return &Func{Arity: len(s.params), Fn: func(args []float64) float64 {
+		local := make(Env, len(captured)+len(args))
+		for v, x := range captured {
+			local[v] = x
+		}
+		for i, p := range s.params {
+			local[p] = args[i]
+		}
+		return s.x.Eval(local)
+	}}
+}
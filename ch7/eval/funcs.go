@@ -0,0 +1,186 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+	"sync/atomic"
+)
+
+// A Func is a function that may be called from an expression.
+type Func struct {
+	Arity int                          // number of arguments, or -1 if variadic
+	Fn    func(args []float64) float64 // computes the result; must not retain args
+
+	// Complex, if not nil, computes the result for complex arguments,
+	// for EvalComplex. Without it, the function can be applied only
+	// to real arguments, and yields NaN for any others.
+	Complex func(args []complex128) complex128
+
+	// Interval, if not nil, bounds the result for arguments in the
+	// given intervals, for EvalInterval. Without it, the result is
+	// bounded only for arguments that are single numbers.
+	Interval func(args []Interval) Interval
+}
+
+// Funcs maps function names to their implementations.
+type Funcs map[string]*Func
+
+var inf = math.Inf(+1)
+
+// builtins holds the functions registered by default. The exact
+// evaluators and Derive know their mathematics by name, so they apply
+// only to calls of these very functions.
+var builtins = Funcs{
+	"abs":   fn1(math.Abs, cabs, absInterval),
+	"acos":  fn1(math.Acos, cmplx.Acos, decreasing(math.Acos, -1, 1, ulps)),
+	"acosh": fn1(math.Acosh, cmplx.Acosh, increasing(math.Acosh, 1, inf, ulps)),
+	"arg":   fn1(arg, carg, argInterval),
+	"asin":  fn1(math.Asin, cmplx.Asin, increasing(math.Asin, -1, 1, ulps)),
+	"asinh": fn1(math.Asinh, cmplx.Asinh, increasing(math.Asinh, -inf, inf, ulps)),
+	"atan":  fn1(math.Atan, cmplx.Atan, increasing(math.Atan, -inf, inf, ulps)),
+	"atan2": fn2(math.Atan2, nil, atan2Interval),
+	"atanh": fn1(math.Atanh, cmplx.Atanh, increasing(math.Atanh, -1, 1, ulps)),
+	"cbrt":  fn1(math.Cbrt, nil, increasing(math.Cbrt, -inf, inf, ulps)),
+	"ceil":  fn1(math.Ceil, nil, increasing(math.Ceil, -inf, inf, 0)),
+	"conj":  fn1(func(x float64) float64 { return x }, cmplx.Conj, identity),
+	"cos":   fn1(math.Cos, cmplx.Cos, sinusoid(math.Cos, 0)),
+	"cosh":  fn1(math.Cosh, cmplx.Cosh, even(math.Cosh)),
+	"exp":   fn1(math.Exp, cmplx.Exp, increasing(math.Exp, -inf, inf, ulps)),
+	"exp2":  fn1(math.Exp2, cexp2, increasing(math.Exp2, -inf, inf, ulps)),
+	"floor": fn1(math.Floor, nil, increasing(math.Floor, -inf, inf, 0)),
+	"hypot": fn2(math.Hypot, nil, hypotInterval),
+	"im":    fn1(func(float64) float64 { return 0 }, cimag, zero),
+	"log":   fn1(math.Log, cmplx.Log, increasing(math.Log, 0, inf, ulps)),
+	"log10": fn1(math.Log10, cmplx.Log10, increasing(math.Log10, 0, inf, ulps)),
+	"log2":  fn1(math.Log2, clog2, increasing(math.Log2, 0, inf, ulps)),
+	"max":   {Arity: -1, Fn: maxOf, Interval: maxInterval},
+	"min":   {Arity: -1, Fn: minOf, Interval: minInterval},
+	"mod":   fn2(math.Mod, nil, modInterval),
+	"pow":   fn2(math.Pow, cmplx.Pow, powInterval),
+	"re":    fn1(func(x float64) float64 { return x }, creal, identity),
+	"round": fn1(math.Round, nil, increasing(math.Round, -inf, inf, 0)),
+	"sin":   fn1(math.Sin, cmplx.Sin, sinusoid(math.Sin, math.Pi/2)),
+	"sinh":  fn1(math.Sinh, cmplx.Sinh, increasing(math.Sinh, -inf, inf, ulps)),
+	"sqrt":  fn1(math.Sqrt, cmplx.Sqrt, sqrtInterval),
+	"tan":   fn1(math.Tan, cmplx.Tan, tanInterval),
+	"tanh":  fn1(math.Tanh, cmplx.Tanh, increasing(math.Tanh, -inf, inf, ulps)),
+	"trunc": fn1(math.Trunc, nil, increasing(math.Trunc, -inf, inf, 0)),
+}
+
+// registry holds the registered functions. Calls look them up each time
+// they are evaluated, so the map is never changed once stored, but
+// replaced by a copy, and lookups need no lock.
+var registry struct {
+	sync.Mutex              // held by writers
+	funcs      atomic.Value // Funcs
+}
+
+func init() { registry.funcs.Store(builtins) }
+
+// Register makes a function available under the given name to all
+// expressions evaluated afterwards, replacing any previous function of
+// that name. (A call parsed when it could not be made, for want of
+// such a function, remains an error.) An arity of -1 denotes a
+// variadic function, which must be called with at least one argument.
+func Register(name string, arity int, fn func(args []float64) float64) {
+	registry.Lock()
+	defer registry.Unlock()
+	old := registry.funcs.Load().(Funcs)
+	funcs := make(Funcs, len(old)+1)
+	for k, f := range old {
+		funcs[k] = f
+	}
+	funcs[name] = &Func{Arity: arity, Fn: fn}
+	registry.funcs.Store(funcs)
+}
+
+// Lookup returns the registered function of the given name, or nil.
+func Lookup(name string) *Func {
+	return registry.funcs.Load().(Funcs)[name]
+}
+
+// isBuiltin reports whether f is the function registered by default
+// under the given name.
+func isBuiltin(name string, f *Func) bool {
+	return f != nil && f == builtins[name]
+}
+
+// mkcall returns a call of the registered function name.
+func mkcall(name string, args ...Expr) call {
+	return call{name, args}
+}
+
+// fun returns the function that c calls, or nil if there is none.
+func (c call) fun() *Func { return Lookup(c.fn) }
+
+// newCall returns a call of the function fn, as found in funcs, with
+// the given arguments and position: a plain call if it calls a
+// registered function properly, and otherwise a funcCall.
+func newCall(fn string, args []Expr, funcs Funcs, pos Pos) Expr {
+	c := call{fn, args}
+	f, local := funcs[fn]
+	if !local {
+		f = Lookup(fn)
+	}
+	if local || !arityOK(f, len(args)) {
+		return funcCall{c, f, pos}
+	}
+	return c
+}
+
+// arityOK reports whether f may be called with n arguments.
+func arityOK(f *Func, n int) bool {
+	return f != nil && (f.Arity == n || f.Arity < 0 && n > 0)
+}
+
+// fn1 returns a Func of one argument with real version f, complex
+// version cf, which may be nil, and interval version iv.
+func fn1(f func(float64) float64, cf func(complex128) complex128, iv func([]Interval) Interval) *Func {
+	fn := &Func{Arity: 1, Fn: func(args []float64) float64 { return f(args[0]) }, Interval: iv}
+	if cf != nil {
+		fn.Complex = func(args []complex128) complex128 { return cf(args[0]) }
+	}
+	return fn
+}
+
+// fn2 is like fn1 for functions of two arguments.
+func fn2(f func(float64, float64) float64, cf func(complex128, complex128) complex128, iv func([]Interval) Interval) *Func {
+	fn := &Func{Arity: 2, Fn: func(args []float64) float64 { return f(args[0], args[1]) }, Interval: iv}
+	if cf != nil {
+		fn.Complex = func(args []complex128) complex128 { return cf(args[0], args[1]) }
+	}
+	return fn
+}
+
+func maxOf(args []float64) float64 {
+	m := args[0]
+	for _, x := range args[1:] {
+		m = math.Max(m, x)
+	}
+	return m
+}
+
+func minOf(args []float64) float64 {
+	m := args[0]
+	for _, x := range args[1:] {
+		m = math.Min(m, x)
+	}
+	return m
+}
+
+// arg returns the argument (phase) of the real number x: 0 or π.
+func arg(x float64) float64 { return math.Atan2(0, x) }
+
+// Complex versions of functions whose math/cmplx counterparts, if any,
+// have a different type.
+
+func cabs(z complex128) complex128  { return complex(cmplx.Abs(z), 0) }
+func carg(z complex128) complex128  { return complex(cmplx.Phase(z), 0) }
+func creal(z complex128) complex128 { return complex(real(z), 0) }
+func cimag(z complex128) complex128 { return complex(imag(z), 0) }
+func cexp2(z complex128) complex128 { return cmplx.Exp(z * math.Ln2) }
+func clog2(z complex128) complex128 { return cmplx.Log(z) / math.Ln2 }
@@ -0,0 +1,68 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestFuncs(t *testing.T) {
+	Register("sq", 1, func(args []float64) float64 { return args[0] * args[0] })
+	funcs := Funcs{
+		"lerp": {Arity: 3, Fn: func(args []float64) float64 {
+			return args[0] + (args[1]-args[0])*args[2]
+		}},
+		"sin": {Arity: 1, Fn: func(args []float64) float64 { return 42 }},
+	}
+	tests := []struct {
+		expr  string
+		funcs Funcs
+		env   Env
+		want  string // expected error from Parse/Check or result from Eval
+	}{
+		{"cos(x)", nil, Env{"x": math.Pi}, "-1"},
+		{"atan2(1, 1) * 4", nil, nil, "3.14159"},
+		{"hypot(3, 4)", nil, nil, "5"},
+		{"floor(x) + ceil(x)", nil, Env{"x": 2.5}, "5"},
+		{"log(exp(2))", nil, nil, "2"},
+		{"abs(-x)", nil, Env{"x": 7}, "7"},
+		{"max(1, x, 3)", nil, Env{"x": 9}, "9"},
+		{"min(4)", nil, nil, "4"},
+		{"min()", nil, nil, "call to min has 0 args, want at least 1"},
+		{"sq(x + 1)", nil, Env{"x": 2}, "9"},
+		{"lerp(0, 10, x)", funcs, Env{"x": 0.25}, "2.5"},
+		{"lerp(0, 10, x)", nil, nil, `unknown function "lerp"`},
+		{"sin(x)", funcs, nil, "42"},
+		{"lerp(1, 2)", funcs, nil, "call to lerp has 2 args, want 3"},
+	}
+	for _, test := range tests {
+		expr, err := ParseFuncs(test.expr, test.funcs)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			if err.Error() != test.want {
+				t.Errorf("%s: got %q, want %q", test.expr, err, test.want)
+			}
+			continue
+		}
+		got := fmt.Sprintf("%.6g", expr.Eval(test.env))
+		if got != test.want {
+			t.Errorf("%s.Eval() in %v = %q, want %q",
+				test.expr, test.env, got, test.want)
+		}
+	}
+
+	// A registered function is looked up when the call is evaluated.
+	expr, err := Parse("sq(3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Register("sq", 1, func(args []float64) float64 { return -args[0] * args[0] })
+	if got := expr.Eval(nil); got != -9 {
+		t.Errorf("sq(3) after Register = %g, want -9", got)
+	}
+}
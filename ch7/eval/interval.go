@@ -0,0 +1,601 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// An Interval is a closed interval [Lo, Hi] of real numbers, either
+// of whose bounds may be infinite. An Interval with Lo > Hi, or with
+// a NaN bound, is empty.
+type Interval struct {
+	Lo, Hi float64
+}
+
+// An IntervalEnv maps variables to the ranges of their values,
+// for EvalInterval.
+type IntervalEnv map[Var]Interval
+
+var (
+	empty  = Interval{math.Inf(+1), math.Inf(-1)}
+	entire = Interval{math.Inf(-1), math.Inf(+1)}
+)
+
+func point(x float64) Interval { return Interval{x, x} }
+
+// IsEmpty reports whether x contains no numbers.
+func (x Interval) IsEmpty() bool { return !(x.Lo <= x.Hi) }
+
+// Contains reports whether v is in x.
+func (x Interval) Contains(v float64) bool { return x.Lo <= v && v <= x.Hi }
+
+// Hull returns the smallest interval containing both x and y.
+func (x Interval) Hull(y Interval) Interval {
+	switch {
+	case x.IsEmpty():
+		return y
+	case y.IsEmpty():
+		return x
+	}
+	return Interval{math.Min(x.Lo, y.Lo), math.Max(x.Hi, y.Hi)}
+}
+
+func (x Interval) String() string {
+	if x.IsEmpty() {
+		return "[empty]"
+	}
+	return fmt.Sprintf("[%g, %g]", x.Lo, x.Hi)
+}
+
+// The EvalInterval methods bound the values of an expression when its
+// variables range over the intervals of env: for every choice of values
+// in those intervals, the real value of the expression lies within the
+// result. Points where the expression has no real value, for instance
+// because it divides by zero or takes the square root of a negative
+// number, are disregarded, so the result is empty if there are no
+// others. Bounds are rounded outward, so they hold despite the rounding
+// errors of floating point; they are often wider than necessary, since
+// each occurrence of a variable is treated independently.
+
+func (v Var) EvalInterval(env IntervalEnv) Interval {
+	return env[v]
+}
+
+func (l literal) EvalInterval(_ IntervalEnv) Interval {
+	return point(float64(l))
+}
+
+func (imaginary) EvalInterval(_ IntervalEnv) Interval {
+	return empty
+}
+
+func (u unary) EvalInterval(env IntervalEnv) Interval {
+	x := u.x.EvalInterval(env)
+	if x.IsEmpty() {
+		return empty
+	}
+	switch u.op {
+	case '+':
+		return x
+	case '-':
+		return Interval{-x.Hi, -x.Lo}
+	case '!':
+		return boolean(x.Contains(0), !isZero(x))
+	}
+	panic(fmt.Sprintf("unsupported unary operator: %q", u.op))
+}
+
+func (b binary) EvalInterval(env IntervalEnv) Interval {
+	x := b.x.EvalInterval(env)
+	// && and || do not evaluate y if x decides the result.
+	switch {
+	case b.op == tokAnd && isZero(x):
+		return point(0)
+	case b.op == tokOr && !x.IsEmpty() && !x.Contains(0):
+		return point(1)
+	}
+	y := b.y.EvalInterval(env)
+	if x.IsEmpty() || y.IsEmpty() {
+		return empty
+	}
+	switch b.op {
+	case '+':
+		return Interval{addDown(x.Lo, y.Lo), addUp(x.Hi, y.Hi)}
+	case '-':
+		return Interval{addDown(x.Lo, -y.Hi), addUp(x.Hi, -y.Lo)}
+	case '*':
+		return mul(x, y)
+	case '/':
+		return div(x, y)
+	case '<':
+		return boolean(x.Lo < y.Hi, x.Hi >= y.Lo)
+	case '>':
+		return boolean(x.Hi > y.Lo, x.Lo <= y.Hi)
+	case tokLE:
+		return boolean(x.Lo <= y.Hi, x.Hi > y.Lo)
+	case tokGE:
+		return boolean(x.Hi >= y.Lo, x.Lo < y.Hi)
+	case tokEQ, tokNE:
+		overlap := x.Lo <= y.Hi && y.Lo <= x.Hi
+		same := x.Lo == x.Hi && x == y
+		if b.op == tokEQ {
+			return boolean(overlap, !same)
+		}
+		return boolean(!same, overlap)
+	case tokAnd:
+		return boolean(!isZero(x) && !isZero(y), x.Contains(0) || y.Contains(0))
+	case tokOr:
+		return boolean(!isZero(x) || !isZero(y), x.Contains(0) && y.Contains(0))
+	}
+	panic(fmt.Sprintf("unsupported binary operator: %q", b.op))
+}
+
+func (c conditional) EvalInterval(env IntervalEnv) Interval {
+	cond := c.cond.EvalInterval(env)
+	switch {
+	case cond.IsEmpty():
+		return empty
+	case isZero(cond):
+		return c.y.EvalInterval(env)
+	case !cond.Contains(0):
+		return c.x.EvalInterval(env)
+	}
+	return c.x.EvalInterval(env).Hull(c.y.EvalInterval(env))
+}
+
+// EvalInterval uses the interval version of the function, if any.
+// Otherwise the result is bounded only if every argument is a single
+// number, and even then only to within the accuracy of the function.
+func (c call) EvalInterval(env IntervalEnv) Interval {
+	return c.evalIntervalWith(c.fun(), env)
+}
+
+func (c funcCall) EvalInterval(env IntervalEnv) Interval {
+	return c.evalIntervalWith(c.f, env)
+}
+
+func (c call) evalIntervalWith(f *Func, env IntervalEnv) Interval {
+	if f == nil {
+		panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+	}
+	args := make([]Interval, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.EvalInterval(env)
+		if args[i].IsEmpty() {
+			return empty
+		}
+	}
+	if f.Interval != nil {
+		return f.Interval(args)
+	}
+	vals := make([]float64, len(args))
+	for i, arg := range args {
+		if arg.Lo != arg.Hi {
+			return entire
+		}
+		vals[i] = arg.Lo
+	}
+	v := f.Fn(vals)
+	if math.IsNaN(v) {
+		return empty
+	}
+	return widen(point(v), 4)
+}
+
+func (a apply) EvalInterval(env IntervalEnv) Interval {
+	return a.body.EvalInterval(env)
+}
+
+func (b block) EvalInterval(env IntervalEnv) Interval {
+	local := make(IntervalEnv, len(env)+len(b.stmts))
+	for v, x := range env {
+		local[v] = x
+	}
+	var result Interval
+	for _, s := range b.stmts {
+		if s.function {
+			result = point(0)
+			continue
+		}
+		result = s.x.EvalInterval(local)
+		if s.name != "" {
+			local[Var(s.name)] = result
+		}
+	}
+	return result
+}
+
+// isZero reports whether x contains only zero.
+func isZero(x Interval) bool { return x.Lo == 0 && x.Hi == 0 }
+
+// boolean returns the range of a condition that may be true or false.
+func boolean(canBeTrue, canBeFalse bool) Interval {
+	switch {
+	case canBeTrue && canBeFalse:
+		return Interval{0, 1}
+	case canBeTrue:
+		return point(1)
+	case canBeFalse:
+		return point(0)
+	}
+	return empty
+}
+
+// ---- rounding ----
+
+// The arithmetic operations round each bound outward using the sign of
+// its rounding error, which is computed exactly by an error-free
+// transformation. A bound is thus widened only if it is inexact, and
+// then by a single unit in the last place.
+
+func down(x float64) float64 { return math.Nextafter(x, math.Inf(-1)) }
+func up(x float64) float64   { return math.Nextafter(x, math.Inf(+1)) }
+
+// roundDown returns a lower bound on the exact result of an operation
+// that was rounded to x with error e, i.e., whose exact result is x+e.
+// A NaN error denotes an unknown one.
+func roundDown(x, e float64) float64 {
+	if e < 0 || math.IsNaN(e) {
+		return down(x)
+	}
+	return x
+}
+
+// roundUp is like roundDown for an upper bound.
+func roundUp(x, e float64) float64 {
+	if e > 0 || math.IsNaN(e) {
+		return up(x)
+	}
+	return x
+}
+
+// widen returns x widened by n units in the last place at each end,
+// for results of functions that are not correctly rounded. The
+// functions of package math return +0 only for nonnegative results,
+// and -0 only for nonpositive ones, so such bounds are kept.
+func widen(x Interval, n int) Interval {
+	for ; n > 0; n-- {
+		if x.Lo != 0 || math.Signbit(x.Lo) {
+			x.Lo = down(x.Lo)
+		}
+		if x.Hi != 0 || !math.Signbit(x.Hi) {
+			x.Hi = up(x.Hi)
+		}
+	}
+	return x
+}
+
+// twoSum returns a+b and its rounding error (Knuth's TwoSum).
+func twoSum(a, b float64) (s, e float64) {
+	s = a + b
+	bb := s - a
+	return s, (a - (s - bb)) + (b - bb)
+}
+
+// minNormalProduct is the smallest magnitude of a product whose
+// rounding error is representable.
+const minNormalProduct = 0x1p-969
+
+// twoProduct returns a*b and its rounding error, which is NaN if unknown.
+func twoProduct(a, b float64) (p, e float64) {
+	if a == 0 || b == 0 {
+		return 0, 0 // even if the other is infinite
+	}
+	p = a * b
+	if math.Abs(p) < minNormalProduct {
+		return p, math.NaN()
+	}
+	return p, math.FMA(a, b, -p)
+}
+
+// twoQuotient returns a/b and the sign of its rounding error,
+// which is NaN if unknown.
+func twoQuotient(a, b float64) (q, e float64) {
+	q = a / b
+	switch {
+	case a == 0, math.IsInf(a, 0), math.IsInf(b, 0), math.IsNaN(q):
+		return q, 0 // exact, or NaN
+	case math.IsInf(q, 0), math.Abs(q) < minNormalProduct, math.Abs(a) < minNormalProduct:
+		return q, math.NaN() // overflow or underflow
+	}
+	// The exact quotient is q + r/b, with the remainder r computed exactly.
+	r := math.FMA(-q, b, a)
+	return q, r * math.Copysign(1, b)
+}
+
+// twoSqrt returns the square root of a ≥ 0 and the sign of its
+// rounding error, which is NaN if unknown.
+func twoSqrt(a float64) (r, e float64) {
+	r = math.Sqrt(a)
+	switch {
+	case a == 0, math.IsInf(a, 0):
+		return r, 0
+	case a < minNormalProduct:
+		return r, math.NaN() // r*r - a may not be representable
+	}
+	// The exact root is r + e for some e of the sign opposite to r*r - a.
+	return r, -math.FMA(r, r, -a)
+}
+
+func addDown(a, b float64) float64 { return roundDown(twoSum(a, b)) }
+func addUp(a, b float64) float64   { return roundUp(twoSum(a, b)) }
+func mulDown(a, b float64) float64 { return roundDown(twoProduct(a, b)) }
+func mulUp(a, b float64) float64   { return roundUp(twoProduct(a, b)) }
+func divDown(a, b float64) float64 { return roundDown(twoQuotient(a, b)) }
+func divUp(a, b float64) float64   { return roundUp(twoQuotient(a, b)) }
+
+// corners returns the interval bounding op over the corners of the
+// box x × y, using opDown and opUp for its lower and upper bounds.
+// A NaN at a corner makes that side of the interval unbounded.
+func corners(x, y Interval, opDown, opUp func(a, b float64) float64) Interval {
+	lo, hi := math.Inf(+1), math.Inf(-1)
+	for _, a := range [2]float64{x.Lo, x.Hi} {
+		for _, b := range [2]float64{y.Lo, y.Hi} {
+			l, h := opDown(a, b), opUp(a, b)
+			if math.IsNaN(l) {
+				l, h = math.Inf(-1), math.Inf(+1)
+			}
+			lo, hi = math.Min(lo, l), math.Max(hi, h)
+		}
+	}
+	return Interval{lo, hi}
+}
+
+func mul(x, y Interval) Interval {
+	return corners(x, y, mulDown, mulUp)
+}
+
+// div returns the quotient of x and y, which are not empty. Where y
+// contains zero the quotient may be unbounded, and if y is zero it is
+// empty, since the quotient has no real value there.
+func div(x, y Interval) Interval {
+	switch {
+	case isZero(y):
+		return empty
+	case isZero(x):
+		return point(0)
+	case y.Lo > 0 || y.Hi < 0:
+		return corners(x, y, divDown, divUp)
+	case y.Lo < 0 && y.Hi > 0, x.Lo < 0 && x.Hi > 0:
+		// The quotient is the union of two unbounded intervals,
+		// (-∞, a] ∪ [b, +∞), or all of the numbers, whose hull is entire.
+		return entire
+	}
+	// y is [0, y.Hi] or [y.Lo, 0], and x is nonnegative or nonpositive.
+	// As y approaches zero the quotient tends to ±∞.
+	if (y.Lo == 0) == (x.Lo >= 0) {
+		// x ≥ 0 and y ≥ 0, or x ≤ 0 and y ≤ 0: positive quotients.
+		if x.Lo >= 0 {
+			return Interval{divDown(x.Lo, y.Hi), math.Inf(+1)}
+		}
+		return Interval{divDown(x.Hi, y.Lo), math.Inf(+1)}
+	}
+	if x.Lo >= 0 {
+		return Interval{math.Inf(-1), divUp(x.Lo, y.Lo)}
+	}
+	return Interval{math.Inf(-1), divUp(x.Hi, y.Hi)}
+}
+
+// ---- functions ----
+
+// The interval versions of the registered functions. Most functions of
+// package math are not correctly rounded, so their results are widened
+// by a few units in the last place.
+
+const ulps = 2
+
+// increasing returns the interval version of the nondecreasing
+// function f, whose domain is [lo, hi] and whose results are within
+// n units in the last place.
+func increasing(f func(float64) float64, lo, hi float64, n int) func([]Interval) Interval {
+	return func(args []Interval) Interval {
+		x := Interval{math.Max(args[0].Lo, lo), math.Min(args[0].Hi, hi)}
+		if x.IsEmpty() {
+			return empty
+		}
+		return widen(Interval{f(x.Lo), f(x.Hi)}, n)
+	}
+}
+
+// decreasing is like increasing for a nonincreasing function.
+func decreasing(f func(float64) float64, lo, hi float64, n int) func([]Interval) Interval {
+	return func(args []Interval) Interval {
+		x := Interval{math.Max(args[0].Lo, lo), math.Min(args[0].Hi, hi)}
+		if x.IsEmpty() {
+			return empty
+		}
+		return widen(Interval{f(x.Hi), f(x.Lo)}, n)
+	}
+}
+
+// magnitude returns the range of |v| for v in x.
+func magnitude(x Interval) Interval {
+	switch {
+	case x.Lo >= 0:
+		return x
+	case x.Hi <= 0:
+		return Interval{-x.Hi, -x.Lo}
+	}
+	return Interval{0, math.Max(-x.Lo, x.Hi)}
+}
+
+// even returns the interval version of an even function f
+// that is nondecreasing for nonnegative arguments.
+func even(f func(float64) float64) func([]Interval) Interval {
+	return func(args []Interval) Interval {
+		m := magnitude(args[0])
+		return widen(Interval{f(m.Lo), f(m.Hi)}, ulps)
+	}
+}
+
+func absInterval(args []Interval) Interval { return magnitude(args[0]) }
+
+// sqrtInterval is correctly rounded, so a bound is widened only if its
+// root is inexact.
+func sqrtInterval(args []Interval) Interval {
+	x := Interval{math.Max(args[0].Lo, 0), args[0].Hi}
+	if x.IsEmpty() {
+		return empty
+	}
+	return Interval{roundDown(twoSqrt(x.Lo)), roundUp(twoSqrt(x.Hi))}
+}
+
+// mayContain reports whether x may contain a number p + k*period for
+// some integer k. It errs on the side of reporting that it does.
+func mayContain(x Interval, p, period float64) bool {
+	slack := 1e-9 * math.Max(1, math.Max(math.Abs(x.Lo), math.Abs(x.Hi)))
+	return math.Floor((x.Hi-p)/period+slack) >= math.Ceil((x.Lo-p)/period-slack)
+}
+
+// sinusoid returns the interval version of sin, if peak is π/2,
+// or cos, if peak is 0.
+func sinusoid(f func(float64) float64, peak float64) func([]Interval) Interval {
+	return func(args []Interval) Interval {
+		x := args[0]
+		if !(x.Hi-x.Lo < 2*math.Pi) { // also if x is unbounded
+			return Interval{-1, 1}
+		}
+		a, b := f(x.Lo), f(x.Hi)
+		y := widen(Interval{math.Min(a, b), math.Max(a, b)}, ulps)
+		if mayContain(x, peak, 2*math.Pi) {
+			y.Hi = 1
+		}
+		if mayContain(x, peak+math.Pi, 2*math.Pi) {
+			y.Lo = -1
+		}
+		return Interval{math.Max(y.Lo, -1), math.Min(y.Hi, 1)}
+	}
+}
+
+func tanInterval(args []Interval) Interval {
+	x := args[0]
+	if !(x.Hi-x.Lo < math.Pi) || mayContain(x, math.Pi/2, math.Pi) {
+		return entire // a pole
+	}
+	return widen(Interval{math.Tan(x.Lo), math.Tan(x.Hi)}, ulps)
+}
+
+func argInterval(args []Interval) Interval {
+	switch x := args[0]; {
+	case x.Lo >= 0:
+		return point(0)
+	case x.Hi < 0:
+		return point(math.Pi)
+	}
+	return Interval{0, math.Pi}
+}
+
+// atan2Interval bounds atan2(y, x). Away from the origin and the
+// branch cut along the negative x axis, atan2 is monotonic in each
+// argument, so its extrema are at the corners.
+func atan2Interval(args []Interval) Interval {
+	y, x := args[0], args[1]
+	if x.Lo > 0 || y.Lo > 0 || y.Hi < 0 {
+		return widen(corners(y, x, math.Atan2, math.Atan2), ulps)
+	}
+	return widen(Interval{-math.Pi, math.Pi}, 1)
+}
+
+func hypotInterval(args []Interval) Interval {
+	x, y := magnitude(args[0]), magnitude(args[1])
+	return widen(Interval{math.Hypot(x.Lo, y.Lo), math.Hypot(x.Hi, y.Hi)}, ulps)
+}
+
+func maxInterval(args []Interval) Interval {
+	r := args[0]
+	for _, x := range args[1:] {
+		r = Interval{math.Max(r.Lo, x.Lo), math.Max(r.Hi, x.Hi)}
+	}
+	return r
+}
+
+func minInterval(args []Interval) Interval {
+	r := args[0]
+	for _, x := range args[1:] {
+		r = Interval{math.Min(r.Lo, x.Lo), math.Min(r.Hi, x.Hi)}
+	}
+	return r
+}
+
+// modInterval bounds math.Mod(x, y), which has the sign of x and is
+// smaller in magnitude than both x and y.
+func modInterval(args []Interval) Interval {
+	x, y := args[0], magnitude(args[1])
+	if isZero(y) {
+		return empty
+	}
+	m := math.Min(magnitude(x).Hi, y.Hi)
+	switch {
+	case x.Lo >= 0:
+		return Interval{0, m}
+	case x.Hi <= 0:
+		return Interval{-m, 0}
+	}
+	return Interval{-m, m}
+}
+
+// maxPowInts is the most integers in y for which powInterval bounds
+// pow(x, y) for negative x power by power.
+const maxPowInts = 64
+
+// powInterval bounds pow(x, y). For negative x, pow has a real value
+// only if y is an integer, so the result for the negative part of x is
+// the hull of its powers by the integers in y, and for the nonnegative
+// part, pow is monotonic in each argument, with its extrema at the
+// corners.
+func powInterval(args []Interval) Interval {
+	x, y := args[0], args[1]
+	if y.Lo == y.Hi && y.Lo == math.Trunc(y.Lo) && !math.IsInf(y.Lo, 0) {
+		return intPow(x, y.Lo)
+	}
+	r := empty
+	if neg := (Interval{x.Lo, math.Min(x.Hi, 0)}); !neg.IsEmpty() && !y.IsEmpty() {
+		lo, hi := math.Ceil(y.Lo), math.Floor(y.Hi)
+		if hi-lo >= maxPowInts {
+			return entire
+		}
+		for n := lo; n <= hi; n++ {
+			r = r.Hull(intPow(neg, n))
+		}
+	}
+	if pos := (Interval{math.Max(x.Lo, 0), x.Hi}); !pos.IsEmpty() {
+		r = r.Hull(widen(corners(pos, y, math.Pow, math.Pow), ulps))
+	}
+	return r
+}
+
+// intPow bounds pow(x, n) for an integer n. Positive powers, which are
+// monotonic in |x| if n is even and in x if it is odd, are computed
+// by repeated squaring, so they are exact if representable.
+func intPow(x Interval, n float64) Interval {
+	switch {
+	case n == 0:
+		return point(1)
+	case n < 0:
+		return div(point(1), intPow(x, -n))
+	case math.Mod(n, 2) == 0:
+		x = magnitude(x)
+	}
+	return Interval{powPoint(x.Lo, n).Lo, powPoint(x.Hi, n).Hi}
+}
+
+// powPoint bounds a to the positive integer power n.
+func powPoint(a, n float64) Interval {
+	r, sq := point(1), point(a)
+	for {
+		if math.Mod(n, 2) == 1 {
+			r = mul(r, sq)
+		}
+		n = math.Floor(n / 2)
+		if n == 0 {
+			return r
+		}
+		sq = mul(sq, sq)
+	}
+}
+
+func identity(args []Interval) Interval { return args[0] }
+func zero(args []Interval) Interval     { return point(0) }
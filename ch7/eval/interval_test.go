@@ -0,0 +1,143 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEvalInterval(t *testing.T) {
+	tests := []struct {
+		expr string
+		env  IntervalEnv
+		want string
+	}{
+		{"x + y", IntervalEnv{"x": {1, 2}, "y": {10, 20}}, "[11, 22]"},
+		{"x - y", IntervalEnv{"x": {1, 2}, "y": {10, 20}}, "[-19, -8]"},
+		{"x * y", IntervalEnv{"x": {-1, 2}, "y": {-3, 4}}, "[-6, 8]"},
+		{"x * x", IntervalEnv{"x": {-1, 2}}, "[-2, 4]"}, // occurrences are independent
+		{"pow(x, 2)", IntervalEnv{"x": {-1, 2}}, "[0, 4]"},
+		{"pow(x, 3)", IntervalEnv{"x": {-1, 2}}, "[-1, 8]"},
+		{"pow(x, -1)", IntervalEnv{"x": {2, 4}}, "[0.25, 0.5]"},
+		{"pow(x, 0.5)", IntervalEnv{"x": {-4, 4}}, "[0, 2.000000000000001]"},
+		{"pow(x, y)", IntervalEnv{"x": {-2, -2}, "y": {1.5, 2.5}}, "[4, 4]"},
+		{"pow(x, y)", IntervalEnv{"x": {-2, 1}, "y": {0.5, 3}}, "[-8, 4]"},
+		{"pow(x, y)", IntervalEnv{"x": {-2, -1}, "y": {0.2, 0.8}}, "[empty]"},
+		{"pow(x, y)", IntervalEnv{"x": {-2, -1}, "y": {0, 1000}}, "[-Inf, +Inf]"},
+		{"0.1 + 0.2", nil, "[0.3, 0.30000000000000004]"},
+		{"1 / 3", nil, "[0.3333333333333333, 0.33333333333333337]"},
+
+		// Division by intervals containing zero.
+		{"1 / x", IntervalEnv{"x": {2, 4}}, "[0.25, 0.5]"},
+		{"1 / x", IntervalEnv{"x": {0, 4}}, "[0.25, +Inf]"},
+		{"1 / x", IntervalEnv{"x": {-4, 0}}, "[-Inf, -0.25]"},
+		{"-1 / x", IntervalEnv{"x": {0, 4}}, "[-Inf, -0.25]"},
+		{"x / y", IntervalEnv{"x": {-2, -1}, "y": {-4, 0}}, "[0.25, +Inf]"},
+		{"1 / x", IntervalEnv{"x": {-1, 1}}, "[-Inf, +Inf]"},
+		{"x / y", IntervalEnv{"x": {-1, 1}, "y": {1, 2}}, "[-1, 1]"},
+		{"x / y", IntervalEnv{"x": {-1, 1}, "y": {0, 2}}, "[-Inf, +Inf]"},
+		{"0 / x", IntervalEnv{"x": {-1, 1}}, "[0, 0]"},
+		{"x / 0", IntervalEnv{"x": {1, 2}}, "[empty]"},
+
+		// Domains and extrema of functions.
+		{"sqrt(x)", IntervalEnv{"x": {-1, 4}}, "[0, 2]"},
+		{"sqrt(x)", IntervalEnv{"x": {-4, -1}}, "[empty]"},
+		{"sqrt(x) + 1", IntervalEnv{"x": {-4, -1}}, "[empty]"},
+		{"sqrt(x)", IntervalEnv{"x": {3, 3}}, "[1.7320508075688772, 1.7320508075688774]"},
+		{"log(x) < -1", IntervalEnv{"x": {0, 0.25}}, "[1, 1]"},
+		{"abs(x)", IntervalEnv{"x": {-3, 2}}, "[0, 3]"},
+		{"sin(x)", IntervalEnv{"x": {0, 3}}, "[0, 1]"},
+		{"cos(x)", IntervalEnv{"x": {-1, 4}}, "[-1, 1]"},
+		{"cos(x)", IntervalEnv{"x": {1e300, math.Inf(1)}}, "[-1, 1]"},
+		{"tan(x)", IntervalEnv{"x": {1, 2}}, "[-Inf, +Inf]"},
+		{"max(x, y)", IntervalEnv{"x": {-1, 1}, "y": {0, 2}}, "[0, 2]"},
+		{"atan2(y, x)", IntervalEnv{"x": {-1, 1}, "y": {-1, 1}}, "[-3.1415926535897936, 3.1415926535897936]"},
+		{"floor(x)", IntervalEnv{"x": {-0.5, 2.5}}, "[-1, 2]"},
+
+		// Conditions may be true, false, or either.
+		{"x < 1", IntervalEnv{"x": {-1, 0}}, "[1, 1]"},
+		{"x < 1", IntervalEnv{"x": {0, 2}}, "[0, 1]"},
+		{"x == y", IntervalEnv{"x": {0, 1}, "y": {2, 3}}, "[0, 0]"},
+		{"!x", IntervalEnv{"x": {1, 2}}, "[0, 0]"},
+		{"x > 0 ? x : -x", IntervalEnv{"x": {1, 2}}, "[1, 2]"},
+		{"x > 0 ? x : 10", IntervalEnv{"x": {-1, 2}}, "[-1, 10]"},
+		{"0 && 1 / 0", nil, "[0, 0]"},
+		{"r = sqrt(x*x + y*y); r", IntervalEnv{"x": {3, 3}, "y": {4, 4}}, "[5, 5]"},
+		{"f(a) = a*a; f(x) + 1", IntervalEnv{"x": {1, 2}}, "[2, 5]"},
+		{"2i", nil, "[empty]"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := expr.EvalInterval(test.env).String(); got != test.want {
+			t.Errorf("%s.EvalInterval(%v) = %s, want %s", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+// TestIntervalSound checks that the bounds computed by EvalInterval
+// contain the values computed by Eval at random points of each box.
+func TestIntervalSound(t *testing.T) {
+	exprs := []string{
+		"x + y * 3.1 - x / y",
+		"(x - 0.1) * (y + 0.7) / (x - y)",
+		"sin(x) * cos(y) + tan(x / 4)",
+		"sqrt(x*x + y*y) / (1 + abs(x))",
+		"pow(x, y) + pow(y, 3) + pow(x, -2)",
+		"exp(x) - log(y) + log10(abs(x)) + log2(y*y)",
+		"asin(x / 10) + acos(y / 10) + atan(x * y) + atan2(y, x)",
+		"sinh(x / 3) + cosh(y / 3) + tanh(x) + asinh(y) + acosh(x) + atanh(y / 10)",
+		"cbrt(x) + exp2(y / 2) + hypot(x, y) + mod(x, y)",
+		"floor(x) + ceil(y) + round(x * y) + trunc(x - y)",
+		"max(x, y, -1) - min(x, 2 * y)",
+		"x < y ? x : y - (x >= 1 && y != 2 || !x)",
+		"re(x) + im(y) + conj(x) + arg(y)",
+		"r = x*x - y; f(a) = a / (r + 1); f(x) * f(y)",
+	}
+	rng := rand.New(rand.NewSource(1))
+	randBox := func() Interval {
+		a, b := rng.NormFloat64()*4, rng.NormFloat64()*4
+		if rng.Intn(4) == 0 {
+			b = a + rng.Float64()*1e-3
+		}
+		return Interval{math.Min(a, b), math.Max(a, b)}
+	}
+	for _, input := range exprs {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 500; i++ {
+			ienv := IntervalEnv{"x": randBox(), "y": randBox()}
+			bounds := expr.EvalInterval(ienv)
+			for j := 0; j < 20; j++ {
+				env := Env{}
+				for v, x := range ienv {
+					switch j {
+					case 0:
+						env[v] = x.Lo
+					case 1:
+						env[v] = x.Hi
+					default:
+						env[v] = x.Lo + rng.Float64()*(x.Hi-x.Lo)
+					}
+				}
+				z := expr.Eval(env)
+				if math.IsNaN(z) || math.IsInf(z, 0) {
+					continue // not a real value
+				}
+				if !bounds.Contains(z) {
+					t.Errorf("%s: at %v, value %g is outside %v.EvalInterval(%v) = %v",
+						input, env, z, input, ienv, bounds)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLogic(t *testing.T) {
+	tests := []struct {
+		expr   string
+		env    Env
+		format string // expected output of Format
+		want   string // expected result of Eval
+	}{
+		{"x < 1", Env{"x": 0}, "(x < 1)", "1"},
+		{"x >= 1", Env{"x": 0}, "(x >= 1)", "0"},
+		{"x <= 1 == y > 2", Env{"x": 0, "y": 3}, "((x <= 1) == (y > 2))", "1"},
+		{"x != y", Env{"x": 2, "y": 2}, "(x != y)", "0"},
+		{"1 + 2 < 2 * 2", nil, "((1 + 2) < (2 * 2))", "1"},
+		{"x > 0 && y > 0 || z", Env{"x": 1, "y": -1, "z": 0}, "(((x > 0) && (y > 0)) || z)", "0"},
+		{"x || y && z", Env{"x": 5}, "(x || (y && z))", "1"},
+		{"!x", Env{"x": 3}, "(!x)", "0"},
+		{"!!x", Env{"x": 3}, "(!(!x))", "1"},
+		{"-x < 0 ? 1 : 2", Env{"x": 3}, "(((-x) < 0) ? 1 : 2)", "1"},
+		{"a ? b : c ? d : e", Env{"c": 1, "d": 4, "e": 5}, "(a ? b : (c ? d : e))", "4"},
+		{"if(x < 0, -x, x)", Env{"x": -7}, "((x < 0) ? (-x) : x)", "7"},
+		{"price * (qty >= 100 ? 0.9 : 1)", Env{"price": 10, "qty": 200}, "(price * ((qty >= 100) ? 0.9 : 1))", "9"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := Format(expr); got != test.format {
+			t.Errorf("Format(%s) = %s, want %s", test.expr, got, test.format)
+		}
+		// Format's output must parse back to the same expression.
+		again, err := Parse(Format(expr))
+		if err != nil {
+			t.Errorf("%s: can't parse %s: %v", test.expr, Format(expr), err)
+		} else if Format(again) != Format(expr) {
+			t.Errorf("%s: Format does not round-trip: %s", test.expr, Format(again))
+		}
+		got := fmt.Sprintf("%.6g", expr.Eval(test.env))
+		if got != test.want {
+			t.Errorf("%s.Eval() in %v = %s, want %s", test.expr, test.env, got, test.want)
+		}
+		// The compiled program must agree.
+		var vars []Var
+		for v := range map[Var]bool{"a": true, "b": true, "c": true, "d": true, "e": true,
+			"x": true, "y": true, "z": true, "price": true, "qty": true} {
+			vars = append(vars, v)
+		}
+		prog, err := Compile(expr, vars)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", test.expr, err)
+			continue
+		}
+		vals := make([]float64, len(vars))
+		for i, v := range vars {
+			vals[i] = test.env[v]
+		}
+		if got := fmt.Sprintf("%.6g", prog.Eval(vals...)); got != test.want {
+			t.Errorf("%s: compiled program in %v = %s, want %s", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+func TestLogicErrors(t *testing.T) {
+	for _, test := range []struct{ expr, wantErr string }{
+		{"x ? y", "got end of file, want ':'"},
+		{"if(x, y)", "call to if has 2 args, want 3"},
+		{"x && && y", "unexpected '&&'"},
+		{"x = = 1", "unexpected '='"},
+	} {
+		_, err := Parse(test.expr)
+		if err == nil || err.Error() != test.wantErr {
+			t.Errorf("Parse(%s) = %v, want %s", test.expr, err, test.wantErr)
+		}
+	}
+}
+
+func TestLogicSimplifyDerive(t *testing.T) {
+	for _, test := range []struct {
+		expr, simple, deriv string
+	}{
+		{"1 < 2 ? x : y", "x", "1"},
+		{"0 && x", "0", "0"},
+		{"x > 1 || 1", "1", "0"},
+		{"1 && x > 1", "(x > 1)", "0"},
+		{"1 && x", "(x != 0)", "0"},
+		{"x < 0 ? -x : x", "((x < 0) ? (-x) : x)", "((x < 0) ? -1 : 1)"},
+		{"c ? x + 0 : 0 + x", "x", "1"},
+		{"max(x, 2*x)", "max(x, (2 * x))", "((x >= (2 * x)) + (2 * ((2 * x) > x)))"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := Format(Simplify(expr)); got != test.simple {
+			t.Errorf("Simplify(%s) = %s, want %s", test.expr, got, test.simple)
+		}
+		d, err := Derive(expr, "x")
+		if err != nil {
+			t.Errorf("Derive(%s): %v", test.expr, err)
+			continue
+		}
+		if got := Format(Simplify(d)); got != test.deriv {
+			t.Errorf("Simplify(Derive(%s)) = %s, want %s", test.expr, got, test.deriv)
+		}
+	}
+}
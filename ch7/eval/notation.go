@@ -0,0 +1,1029 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Notation writes expressions in some written form.
+type Notation interface {
+	Write(w io.Writer, e Expr) error
+}
+
+// The built-in notations.
+var (
+	// Parens is the notation of Format, e.g., ((x * y) + 1).
+	Parens Notation = parens{}
+
+	// Infix uses only the parentheses needed for Parse to read the
+	// expression back, e.g., x * y + 1.
+	Infix Notation = infix{}
+
+	// LaTeX writes a formula for LaTeX's math mode,
+	// e.g., \frac{\sin{r}}{r}.
+	LaTeX Notation = latex{}
+
+	// MathML writes a <math> element of Presentation MathML,
+	// for display in a web page.
+	MathML Notation = mathml{}
+)
+
+// Notations maps the name of each built-in notation to it.
+// The Go notation is a GoFunc with the default name and parameters.
+var Notations = map[string]Notation{
+	"parens": Parens,
+	"infix":  Infix,
+	"latex":  LaTeX,
+	"mathml": MathML,
+	"go":     GoFunc{},
+}
+
+// FormatAs returns the expression written in notation n.
+func FormatAs(e Expr, n Notation) (string, error) {
+	var buf bytes.Buffer
+	if err := n.Write(&buf, e); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+type parens struct{}
+
+func (parens) Write(w io.Writer, e Expr) error {
+	_, err := io.WriteString(w, Format(e))
+	return err
+}
+
+// ---- precedence ----
+
+// Each operand is parenthesized if its precedence is too low for its
+// place. Binary operators have the precedence of the parser, from 1
+// for || to 6 for * and /, and the precedences below complete them.
+const (
+	precCond  = 0 // x ? y : z, and a block
+	precUnary = 7 // -x, and a negative number
+	precAtom  = 8 // a number, variable or call
+)
+
+func prec(e Expr) int {
+	switch e := e.(type) {
+	case binary:
+		return precedence(e.op)
+	case unary:
+		return precUnary
+	case conditional, block:
+		return precCond
+	case literal:
+		if math.Signbit(float64(e)) {
+			return precUnary
+		}
+	}
+	return precAtom
+}
+
+// needParens reports whether x, an operand of e, must be parenthesized.
+// The right operand of a binary operator is the one marked right.
+// If fractions is set, quotients are written as fractions, which need
+// no parentheses either around or within them.
+func needParens(e, x Expr, right, fractions bool) bool {
+	if fractions && (isQuotient(e) || isQuotient(x)) {
+		return false
+	}
+	switch e := e.(type) {
+	case binary:
+		if right {
+			return prec(x) <= precedence(e.op)
+		}
+		return prec(x) < precedence(e.op)
+	case unary:
+		return prec(x) < precUnary
+	case conditional:
+		return prec(x) == precCond // only the condition is an operand
+	}
+	return false
+}
+
+func isQuotient(e Expr) bool {
+	b, ok := e.(binary)
+	return ok && b.op == '/'
+}
+
+// ---- infix ----
+
+type infix struct{}
+
+func (infix) Write(w io.Writer, e Expr) error {
+	var buf bytes.Buffer
+	writeInfix(&buf, e)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeInfix(buf *bytes.Buffer, e Expr) {
+	operand := func(x Expr, right bool) {
+		if needParens(e, x, right, false) {
+			buf.WriteByte('(')
+			writeInfix(buf, x)
+			buf.WriteByte(')')
+		} else {
+			writeInfix(buf, x)
+		}
+	}
+	switch e := e.(type) {
+	case literal, imaginary, Var:
+		write(buf, e)
+
+	case unary:
+		buf.WriteRune(e.op)
+		operand(e.x, false)
+
+	case binary:
+		operand(e.x, false)
+		fmt.Fprintf(buf, " %s ", opString(e.op))
+		operand(e.y, true)
+
+	case conditional:
+		operand(e.cond, false)
+		buf.WriteString(" ? ")
+		writeInfix(buf, e.x)
+		buf.WriteString(" : ")
+		writeInfix(buf, e.y)
+
+	case call:
+		writeCall(buf, e.fn, e.args, writeInfix)
+
+	case funcCall:
+		writeCall(buf, e.fn, e.args, writeInfix)
+
+	case apply:
+		writeCall(buf, e.fn, e.args, writeInfix)
+
+	case block:
+		writeBlock(buf, e, writeInfix)
+
+	default:
+		panic(fmt.Sprintf("unknown Expr: %T", e))
+	}
+}
+
+// ---- LaTeX and MathML ----
+
+// mathNames maps function names to their names in mathematics.
+var mathNames = map[string]string{
+	"asin": "arcsin",
+	"acos": "arccos",
+	"atan": "arctan",
+	"log":  "ln",
+	"re":   "Re",
+	"im":   "Im",
+}
+
+// latexOperators are the functions for which LaTeX has a command,
+// such as \sin, under their names in mathematics.
+var latexOperators = map[string]bool{
+	"arccos": true, "arcsin": true, "arctan": true, "arg": true,
+	"cos": true, "cosh": true, "exp": true, "ln": true, "max": true,
+	"min": true, "sin": true, "sinh": true, "tan": true, "tanh": true,
+}
+
+// greek maps the names of Greek letters to the letters.
+var greek = map[string]rune{
+	"alpha": 'α', "beta": 'β', "gamma": 'γ', "delta": 'δ', "epsilon": 'ε',
+	"zeta": 'ζ', "eta": 'η', "theta": 'θ', "iota": 'ι', "kappa": 'κ',
+	"lambda": 'λ', "mu": 'μ', "nu": 'ν', "xi": 'ξ', "pi": 'π', "rho": 'ρ',
+	"sigma": 'σ', "tau": 'τ', "upsilon": 'υ', "phi": 'φ', "chi": 'χ',
+	"psi": 'ψ', "omega": 'ω',
+	"Gamma": 'Γ', "Delta": 'Δ', "Theta": 'Θ', "Lambda": 'Λ', "Xi": 'Ξ',
+	"Pi": 'Π', "Sigma": 'Σ', "Phi": 'Φ', "Psi": 'Ψ', "Omega": 'Ω',
+}
+
+// mantissa splits the shortest decimal form of x into its digits
+// and its power of ten, e.g., "1.5" and "-7" for 1.5e-07.
+// The exponent is empty for numbers formatted without one.
+func mantissa(x float64) (digits, exp string) {
+	s := strconv.FormatFloat(x, 'g', -1, 64)
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		exp = strings.TrimPrefix(s[i+1:], "+")
+		if strings.HasPrefix(exp, "-0") {
+			exp = "-" + exp[2:]
+		} else {
+			exp = strings.TrimPrefix(exp, "0")
+		}
+		return s[:i], exp
+	}
+	return s, ""
+}
+
+type latex struct{}
+
+func (latex) Write(w io.Writer, e Expr) error {
+	var buf bytes.Buffer
+	writeLaTeX(&buf, e)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var latexOps = map[rune]string{
+	'*':    `\cdot`,
+	tokLE:  `\le`,
+	tokGE:  `\ge`,
+	tokEQ:  `=`,
+	tokNE:  `\ne`,
+	tokAnd: `\land`,
+	tokOr:  `\lor`,
+}
+
+func writeLaTeX(buf *bytes.Buffer, e Expr) {
+	operand := func(x Expr, right bool) {
+		if needParens(e, x, right, true) {
+			buf.WriteString(`\left(`)
+			writeLaTeX(buf, x)
+			buf.WriteString(`\right)`)
+		} else {
+			writeLaTeX(buf, x)
+		}
+	}
+	group := func(x Expr) {
+		buf.WriteByte('{')
+		writeLaTeX(buf, x)
+		buf.WriteByte('}')
+	}
+	switch e := e.(type) {
+	case literal:
+		writeLaTeXNumber(buf, float64(e))
+
+	case imaginary:
+		writeLaTeXNumber(buf, float64(e))
+		buf.WriteString(`i`)
+
+	case Var:
+		buf.WriteString(latexName(string(e)))
+
+	case unary:
+		if e.op == '!' {
+			buf.WriteString(`\lnot `)
+		} else {
+			buf.WriteRune(e.op)
+		}
+		operand(e.x, false)
+
+	case binary:
+		if e.op == '/' {
+			buf.WriteString(`\frac`)
+			group(e.x)
+			group(e.y)
+			break
+		}
+		operand(e.x, false)
+		op, ok := latexOps[e.op]
+		if !ok {
+			op = opString(e.op)
+		}
+		fmt.Fprintf(buf, " %s ", op)
+		operand(e.y, true)
+
+	case conditional:
+		buf.WriteString(`\begin{cases} `)
+		writeLaTeX(buf, e.x)
+		buf.WriteString(` & \text{if } `)
+		writeLaTeX(buf, e.cond)
+		buf.WriteString(` \\ `)
+		writeLaTeX(buf, e.y)
+		buf.WriteString(` & \text{otherwise} \end{cases}`)
+
+	case call:
+		writeLaTeXCall(buf, e.fn, e.args)
+
+	case funcCall:
+		writeLaTeXCall(buf, e.fn, e.args)
+
+	case apply:
+		writeLaTeXCall(buf, e.fn, e.args)
+
+	case block:
+		for i, s := range e.stmts {
+			if i > 0 {
+				buf.WriteString(`;\quad `)
+			}
+			if s.function {
+				params := make([]Expr, len(s.params))
+				for i, p := range s.params {
+					params[i] = p
+				}
+				writeLaTeXCall(buf, s.name, params)
+				buf.WriteString(" = ")
+			} else if s.name != "" {
+				fmt.Fprintf(buf, "%s = ", latexName(s.name))
+			}
+			writeLaTeX(buf, s.x)
+		}
+
+	default:
+		panic(fmt.Sprintf("unknown Expr: %T", e))
+	}
+}
+
+func writeLaTeXNumber(buf *bytes.Buffer, x float64) {
+	switch {
+	case math.IsInf(x, +1):
+		buf.WriteString(`\infty`)
+	case math.IsInf(x, -1):
+		buf.WriteString(`-\infty`)
+	case math.IsNaN(x):
+		buf.WriteString(`\mathrm{NaN}`)
+	default:
+		digits, exp := mantissa(x)
+		buf.WriteString(digits)
+		if exp != "" {
+			fmt.Fprintf(buf, ` \times 10^{%s}`, exp)
+		}
+	}
+}
+
+func writeLaTeXCall(buf *bytes.Buffer, fn string, args []Expr) {
+	arg := func(i int) {
+		writeLaTeX(buf, args[i])
+	}
+	if len(args) == 1 {
+		switch fn {
+		case "sqrt":
+			buf.WriteString(`\sqrt{`)
+			arg(0)
+			buf.WriteString(`}`)
+			return
+		case "cbrt":
+			buf.WriteString(`\sqrt[3]{`)
+			arg(0)
+			buf.WriteString(`}`)
+			return
+		case "abs":
+			buf.WriteString(`\left|`)
+			arg(0)
+			buf.WriteString(`\right|`)
+			return
+		case "floor":
+			buf.WriteString(`\left\lfloor `)
+			arg(0)
+			buf.WriteString(` \right\rfloor`)
+			return
+		case "ceil":
+			buf.WriteString(`\left\lceil `)
+			arg(0)
+			buf.WriteString(` \right\rceil`)
+			return
+		case "conj":
+			buf.WriteString(`\overline{`)
+			arg(0)
+			buf.WriteString(`}`)
+			return
+		case "exp2":
+			buf.WriteString(`2^{`)
+			arg(0)
+			buf.WriteString(`}`)
+			return
+		}
+	}
+	if fn == "pow" && len(args) == 2 {
+		writeLaTeXBase(buf, args[0])
+		buf.WriteString(`^{`)
+		arg(1)
+		buf.WriteString(`}`)
+		return
+	}
+
+	name := fn
+	if n, ok := mathNames[fn]; ok {
+		name = n
+	}
+	switch {
+	case latexOperators[name]:
+		buf.WriteString(`\` + name)
+	case fn == "log10" || fn == "log2":
+		buf.WriteString(`\log_{` + fn[3:] + `}`)
+	case len(fn) == 1:
+		buf.WriteString(fn)
+	default:
+		buf.WriteString(`\operatorname{` + latexEscape(name) + `}`)
+	}
+	buf.WriteString(`\left(`)
+	for i := range args {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		arg(i)
+	}
+	buf.WriteString(`\right)`)
+}
+
+// writeLaTeXBase writes the base of a power, parenthesized unless it
+// is a name or a number that needs no sign or exponent.
+func writeLaTeXBase(buf *bytes.Buffer, x Expr) {
+	if isSimpleBase(x) {
+		writeLaTeX(buf, x)
+		return
+	}
+	buf.WriteString(`\left(`)
+	writeLaTeX(buf, x)
+	buf.WriteString(`\right)`)
+}
+
+func isSimpleBase(x Expr) bool {
+	switch x := x.(type) {
+	case Var:
+		return true
+	case literal:
+		_, exp := mantissa(float64(x))
+		return x >= 0 && exp == ""
+	}
+	return false
+}
+
+// latexName returns the LaTeX for a variable: a single letter as is,
+// a Greek letter by its command, and any other name upright.
+func latexName(name string) string {
+	if _, ok := greek[name]; ok {
+		return `\` + name
+	}
+	if len([]rune(name)) == 1 {
+		return latexEscape(name)
+	}
+	return `\mathrm{` + latexEscape(name) + `}`
+}
+
+func latexEscape(s string) string {
+	return strings.ReplaceAll(s, "_", `\_`)
+}
+
+type mathml struct{}
+
+func (mathml) Write(w io.Writer, e Expr) error {
+	var buf bytes.Buffer
+	buf.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML">`)
+	writeMathML(&buf, e)
+	buf.WriteString(`</math>`)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var mathMLOps = map[rune]string{
+	'-':    "&#x2212;",
+	'*':    "&#x22C5;",
+	'<':    "&lt;",
+	'>':    "&gt;",
+	'!':    "&#xAC;",
+	tokLE:  "&#x2264;",
+	tokGE:  "&#x2265;",
+	tokEQ:  "=",
+	tokNE:  "&#x2260;",
+	tokAnd: "&#x2227;",
+	tokOr:  "&#x2228;",
+}
+
+func mathMLOp(op rune) string {
+	if s, ok := mathMLOps[op]; ok {
+		return s
+	}
+	return opString(op)
+}
+
+// writeMathML writes e as a single element.
+func writeMathML(buf *bytes.Buffer, e Expr) {
+	operand := func(x Expr, right bool) {
+		if needParens(e, x, right, true) {
+			buf.WriteString("<mrow><mo>(</mo>")
+			writeMathML(buf, x)
+			buf.WriteString("<mo>)</mo></mrow>")
+		} else {
+			writeMathML(buf, x)
+		}
+	}
+	switch e := e.(type) {
+	case literal:
+		writeMathMLNumber(buf, float64(e), "")
+
+	case imaginary:
+		writeMathMLNumber(buf, float64(e), "<mi>i</mi>")
+
+	case Var:
+		fmt.Fprintf(buf, "<mi>%s</mi>", mathMLName(string(e)))
+
+	case unary:
+		fmt.Fprintf(buf, "<mrow><mo>%s</mo>", mathMLOp(e.op))
+		operand(e.x, false)
+		buf.WriteString("</mrow>")
+
+	case binary:
+		if e.op == '/' {
+			buf.WriteString("<mfrac>")
+			writeMathML(buf, e.x)
+			writeMathML(buf, e.y)
+			buf.WriteString("</mfrac>")
+			break
+		}
+		buf.WriteString("<mrow>")
+		operand(e.x, false)
+		fmt.Fprintf(buf, "<mo>%s</mo>", mathMLOp(e.op))
+		operand(e.y, true)
+		buf.WriteString("</mrow>")
+
+	case conditional:
+		buf.WriteString(`<mrow><mo>{</mo><mtable columnalign="left"><mtr><mtd>`)
+		writeMathML(buf, e.x)
+		buf.WriteString("</mtd><mtd><mtext>if&#xA0;</mtext>")
+		writeMathML(buf, e.cond)
+		buf.WriteString("</mtd></mtr><mtr><mtd>")
+		writeMathML(buf, e.y)
+		buf.WriteString("</mtd><mtd><mtext>otherwise</mtext></mtd></mtr></mtable></mrow>")
+
+	case call:
+		writeMathMLCall(buf, e.fn, e.args)
+
+	case funcCall:
+		writeMathMLCall(buf, e.fn, e.args)
+
+	case apply:
+		writeMathMLCall(buf, e.fn, e.args)
+
+	case block:
+		buf.WriteString("<mrow>")
+		for i, s := range e.stmts {
+			if i > 0 {
+				buf.WriteString(`<mo separator="true">;</mo><mspace width="1em"/>`)
+			}
+			if s.function {
+				params := make([]Expr, len(s.params))
+				for i, p := range s.params {
+					params[i] = p
+				}
+				writeMathMLCall(buf, s.name, params)
+				buf.WriteString("<mo>=</mo>")
+			} else if s.name != "" {
+				fmt.Fprintf(buf, "<mi>%s</mi><mo>=</mo>", mathMLName(s.name))
+			}
+			writeMathML(buf, s.x)
+		}
+		buf.WriteString("</mrow>")
+
+	default:
+		panic(fmt.Sprintf("unknown Expr: %T", e))
+	}
+}
+
+// writeMathMLNumber writes x followed by suffix, which is empty or
+// a single element.
+func writeMathMLNumber(buf *bytes.Buffer, x float64, suffix string) {
+	var s string
+	switch {
+	case math.IsInf(x, 0):
+		s = "<mi>&#x221E;</mi>"
+	case math.IsNaN(x):
+		s = "<mi>NaN</mi>"
+	default:
+		digits, exp := mantissa(math.Abs(x))
+		s = "<mn>" + digits + "</mn>"
+		if exp != "" {
+			s += "<mo>&#xD7;</mo><msup><mn>10</mn><mn>" +
+				strings.Replace(exp, "-", "&#x2212;", 1) + "</mn></msup>"
+		}
+	}
+	if math.Signbit(x) {
+		s = "<mo>&#x2212;</mo>" + s
+	}
+	if s += suffix; strings.Count(s, "</") > 1 {
+		s = "<mrow>" + s + "</mrow>"
+	}
+	buf.WriteString(s)
+}
+
+func writeMathMLCall(buf *bytes.Buffer, fn string, args []Expr) {
+	wrap := func(open, close string) {
+		buf.WriteString(open)
+		writeMathML(buf, args[0])
+		buf.WriteString(close)
+	}
+	if len(args) == 1 {
+		switch fn {
+		case "sqrt":
+			wrap("<msqrt>", "</msqrt>")
+			return
+		case "cbrt":
+			wrap("<mroot>", "<mn>3</mn></mroot>")
+			return
+		case "abs":
+			wrap("<mrow><mo>|</mo>", "<mo>|</mo></mrow>")
+			return
+		case "floor":
+			wrap("<mrow><mo>&#x230A;</mo>", "<mo>&#x230B;</mo></mrow>")
+			return
+		case "ceil":
+			wrap("<mrow><mo>&#x2308;</mo>", "<mo>&#x2309;</mo></mrow>")
+			return
+		case "conj":
+			wrap("<mover>", "<mo>&#xAF;</mo></mover>")
+			return
+		case "exp2":
+			wrap("<msup><mn>2</mn>", "</msup>")
+			return
+		}
+	}
+	if fn == "pow" && len(args) == 2 {
+		buf.WriteString("<msup>")
+		if isSimpleBase(args[0]) {
+			writeMathML(buf, args[0])
+		} else {
+			buf.WriteString("<mrow><mo>(</mo>")
+			writeMathML(buf, args[0])
+			buf.WriteString("<mo>)</mo></mrow>")
+		}
+		writeMathML(buf, args[1])
+		buf.WriteString("</msup>")
+		return
+	}
+
+	buf.WriteString("<mrow>")
+	switch fn {
+	case "log10", "log2":
+		fmt.Fprintf(buf, "<msub><mi>log</mi><mn>%s</mn></msub>", fn[3:])
+	default:
+		name := fn
+		if n, ok := mathNames[fn]; ok {
+			name = n
+		}
+		fmt.Fprintf(buf, "<mi>%s</mi>", html.EscapeString(name))
+	}
+	buf.WriteString("<mo>&#x2061;</mo><mrow><mo>(</mo>")
+	for i, arg := range args {
+		if i > 0 {
+			buf.WriteString(`<mo separator="true">,</mo>`)
+		}
+		writeMathML(buf, arg)
+	}
+	buf.WriteString("<mo>)</mo></mrow></mrow>")
+}
+
+func mathMLName(name string) string {
+	if r, ok := greek[name]; ok {
+		return string(r)
+	}
+	return html.EscapeString(name)
+}
+
+// ---- Go ----
+
+// GoFunc is a Notation that writes an expression as the declaration
+// of a Go function that computes it, formatted by gofmt, such as
+//
+//	func f(x, y float64) float64 {
+//		r := math.Hypot(x, y)
+//		return math.Sin(r) / r
+//	}
+//
+// The function refers to package math, which the enclosing file must
+// import. A call of a function that is not built in, such as one added
+// by Register, becomes a call of a Go function of the same name.
+// Variables that are not valid Go names, such as "func", are renamed.
+type GoFunc struct {
+	Name   string // name of the function; "f" if empty
+	Params []Var  // parameters; if nil, the expression's variables in order
+}
+
+func (g GoFunc) Write(w io.Writer, e Expr) error {
+	free := make(map[Var]bool)
+	if err := e.Check(free); err != nil {
+		return err
+	}
+	params := g.Params
+	if params == nil {
+		for v := range free {
+			params = append(params, v)
+		}
+		sort.Slice(params, func(i, j int) bool { return params[i] < params[j] })
+	}
+	gen := goGen{names: make(map[Var]string), funcs: make(map[string]string), used: make(map[string]bool)}
+	for _, p := range params {
+		gen.declare(p, true)
+	}
+	for v := range free {
+		if _, ok := gen.names[v]; !ok {
+			return fmt.Errorf("undefined variable: %s", v)
+		}
+	}
+
+	name := g.Name
+	if name == "" {
+		name = "f"
+	}
+	var body bytes.Buffer
+	gen.block(&body, e)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "func %s(%s) float64 {\n", name, gen.params(params))
+	if gen.b2f {
+		buf.WriteString("b2f := func(b bool) float64 {\nif b {\nreturn 1\n}\nreturn 0\n}\n")
+	}
+	buf.Write(body.Bytes())
+	buf.WriteString("}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting Go source: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+var goMinMax = map[string]string{"max": "Max", "min": "Min"}
+
+// goMath maps the functions that package math provides to their names.
+var goMath = map[string]string{
+	"abs": "Abs", "acos": "Acos", "acosh": "Acosh", "asin": "Asin",
+	"asinh": "Asinh", "atan": "Atan", "atan2": "Atan2", "atanh": "Atanh",
+	"cbrt": "Cbrt", "ceil": "Ceil", "cos": "Cos", "cosh": "Cosh",
+	"exp": "Exp", "exp2": "Exp2", "floor": "Floor", "hypot": "Hypot",
+	"log": "Log", "log10": "Log10", "log2": "Log2", "mod": "Mod",
+	"pow": "Pow", "round": "Round", "sin": "Sin", "sinh": "Sinh",
+	"sqrt": "Sqrt", "tan": "Tan", "tanh": "Tanh", "trunc": "Trunc",
+}
+
+// Precedences of Go's operators, and of its operands.
+const (
+	goOr      = 1
+	goAnd     = 2
+	goCompare = 3
+	goAdd     = 4
+	goMul     = 5
+	goUnary   = 6
+	goPrimary = 7
+)
+
+// A goExpr is a Go expression and the precedence of its operator.
+type goExpr struct {
+	src  string
+	prec int
+}
+
+// goGen generates the Go source for an expression.
+type goGen struct {
+	names map[Var]string    // Go name of each variable in scope
+	funcs map[string]string // Go name of each function defined so far
+	used  map[string]bool   // Go names declared so far
+	b2f   bool              // a bool is converted to float64
+}
+
+// declare gives v a Go name distinct from Go's keywords and predeclared
+// types and the names that the generated code uses itself. A local
+// variable's name must also differ from those declared before it; a
+// parameter of a local function may shadow them.
+func (g *goGen) declare(v Var, local bool) string {
+	name := g.goName(string(v), local)
+	g.names[v] = name
+	return name
+}
+
+// declareFunc is like declare for a function defined by the expression.
+// Functions and variables have separate names in an expression, but
+// not in Go, so a function gets a name distinct from the variables'.
+func (g *goGen) declareFunc(fn string) string {
+	name := g.goName(fn, true)
+	g.funcs[fn] = name
+	return name
+}
+
+func (g *goGen) goName(name string, local bool) string {
+	for local && g.used[name] || token.IsKeyword(name) || name == "_" ||
+		name == "math" || name == "b2f" || name == "float64" || name == "bool" {
+		name += "_"
+	}
+	g.used[name] = g.used[name] || local
+	return name
+}
+
+func (g *goGen) params(params []Var) string {
+	if len(params) == 0 {
+		return ""
+	}
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = g.names[p]
+	}
+	return strings.Join(names, ", ") + " float64"
+}
+
+// block writes the statements of a function body that returns e.
+func (g *goGen) block(buf *bytes.Buffer, e Expr) {
+	b, ok := e.(block)
+	if !ok {
+		fmt.Fprintf(buf, "return %s\n", g.value(e).src)
+		return
+	}
+	for i, s := range b.stmts {
+		last := i == len(b.stmts)-1
+		switch {
+		case s.function:
+			// Parameters shadow the variables of the same name.
+			saved := make(map[Var]string)
+			for _, p := range s.params {
+				saved[p] = g.names[p]
+			}
+			name := g.declareFunc(s.name)
+			var ps []string
+			for _, p := range s.params {
+				ps = append(ps, g.declare(p, false))
+			}
+			body := g.value(s.x).src
+			for p, name := range saved {
+				if name == "" {
+					delete(g.names, p)
+				} else {
+					g.names[p] = name
+				}
+			}
+			sig := ""
+			if len(ps) > 0 {
+				sig = strings.Join(ps, ", ") + " float64"
+			}
+			fmt.Fprintf(buf, "%s := func(%s) float64 {\nreturn %s\n}\n", name, sig, body)
+			if !g.usedLater(b.stmts[i+1:], s.name, true) {
+				fmt.Fprintf(buf, "_ = %s\n", name)
+			}
+			if last {
+				buf.WriteString("return 0\n")
+			}
+		case s.name != "":
+			x := g.value(s.x).src
+			name := g.declare(Var(s.name), true)
+			fmt.Fprintf(buf, "%s := %s\n", name, x)
+			if last {
+				fmt.Fprintf(buf, "return %s\n", name)
+			} else if !g.usedLater(b.stmts[i+1:], s.name, false) {
+				fmt.Fprintf(buf, "_ = %s\n", name)
+			}
+		default:
+			fmt.Fprintf(buf, "return %s\n", g.value(s.x).src)
+		}
+	}
+}
+
+// usedLater reports whether any of stmts uses the named variable or
+// function, which Go requires of each local variable.
+func (g *goGen) usedLater(stmts []*stmt, name string, function bool) bool {
+	for _, s := range stmts {
+		shadowed := false
+		for _, p := range s.params {
+			shadowed = shadowed || !function && string(p) == name
+		}
+		if !shadowed && mentions(s.x, name, function) {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns a Go expression of type float64 for e.
+func (g *goGen) value(e Expr) goExpr {
+	switch e := e.(type) {
+	case literal:
+		return goNumber(float64(e))
+
+	case imaginary:
+		return goExpr{"math.NaN()", goPrimary} // not a real number
+
+	case Var:
+		return goExpr{g.names[e], goPrimary}
+
+	case unary:
+		if e.op == '!' {
+			return g.bool2float(g.cond(e))
+		}
+		x := g.operand(g.value(e.x), goUnary, false)
+		if strings.HasPrefix(x, "-") || strings.HasPrefix(x, "+") {
+			x = "(" + x + ")" // not a decrement
+		}
+		return goExpr{string(e.op) + x, goUnary}
+
+	case binary:
+		switch e.op {
+		case '+', '-':
+			return g.binary(g.value(e.x), opString(e.op), g.value(e.y), goAdd)
+		case '*', '/':
+			return g.binary(g.value(e.x), opString(e.op), g.value(e.y), goMul)
+		}
+		return g.bool2float(g.cond(e))
+
+	case conditional:
+		return goExpr{fmt.Sprintf("func() float64 {\nif %s {\nreturn %s\n}\nreturn %s\n}()",
+			g.cond(e.cond).src, g.value(e.x).src, g.value(e.y).src), goPrimary}
+
+	case call:
+		return g.call(e.fn, e.args)
+
+	case funcCall:
+		if isBuiltin(e.fn, e.f) {
+			return g.call(e.fn, e.args)
+		}
+		return goExpr{e.fn + "(" + g.args(e.args) + ")", goPrimary}
+
+	case apply:
+		return goExpr{g.funcs[e.fn] + "(" + g.args(e.args) + ")", goPrimary}
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+// cond returns a Go expression of type bool that is true if e is.
+func (g *goGen) cond(e Expr) goExpr {
+	switch e := e.(type) {
+	case unary:
+		if e.op == '!' {
+			return goExpr{"!" + g.operand(g.cond(e.x), goUnary, false), goUnary}
+		}
+	case binary:
+		switch e.op {
+		case tokAnd:
+			return g.binary(g.cond(e.x), "&&", g.cond(e.y), goAnd)
+		case tokOr:
+			return g.binary(g.cond(e.x), "||", g.cond(e.y), goOr)
+		case '<', '>', tokLE, tokGE, tokEQ, tokNE:
+			return g.binary(g.value(e.x), opString(e.op), g.value(e.y), goCompare)
+		}
+	}
+	return g.binary(g.value(e), "!=", goExpr{"0", goPrimary}, goCompare)
+}
+
+func (g *goGen) bool2float(x goExpr) goExpr {
+	g.b2f = true
+	return goExpr{"b2f(" + x.src + ")", goPrimary}
+}
+
+func (g *goGen) binary(x goExpr, op string, y goExpr, prec int) goExpr {
+	return goExpr{g.operand(x, prec, false) + " " + op + " " + g.operand(y, prec, true), prec}
+}
+
+// operand returns the source of x as an operand of an operator of the
+// given precedence, parenthesized if need be.
+func (g *goGen) operand(x goExpr, prec int, right bool) string {
+	if x.prec < prec || right && x.prec == prec {
+		return "(" + x.src + ")"
+	}
+	return x.src
+}
+
+func (g *goGen) args(args []Expr) string {
+	srcs := make([]string, len(args))
+	for i, arg := range args {
+		srcs[i] = g.value(arg).src
+	}
+	return strings.Join(srcs, ", ")
+}
+
+func (g *goGen) call(fn string, args []Expr) goExpr {
+	if name, ok := goMath[fn]; ok {
+		return goExpr{"math." + name + "(" + g.args(args) + ")", goPrimary}
+	}
+	switch fn {
+	case "max", "min":
+		// math.Max and math.Min take two arguments.
+		x := g.value(args[len(args)-1])
+		for i := len(args) - 2; i >= 0; i-- {
+			x = goExpr{"math." + goMinMax[fn] + "(" + g.value(args[i]).src + ", " + x.src + ")", goPrimary}
+		}
+		return x
+	case "re", "conj":
+		return g.value(args[0])
+	case "im":
+		return goNumber(0)
+	case "arg":
+		return goExpr{"math.Atan2(0, " + g.value(args[0]).src + ")", goPrimary}
+	}
+	return goExpr{fn + "(" + g.args(args) + ")", goPrimary}
+}
+
+// goNumber returns a Go constant for x, written as a floating-point
+// constant so that no division of two constants is an integer division.
+func goNumber(x float64) goExpr {
+	switch {
+	case math.IsInf(x, 0):
+		return goExpr{fmt.Sprintf("math.Inf(%+.0f)", x/math.Abs(x)), goPrimary}
+	case math.IsNaN(x):
+		return goExpr{"math.NaN()", goPrimary}
+	case x == 0 && math.Signbit(x):
+		return goExpr{"math.Copysign(0, -1)", goPrimary} // the constant -0.0 is zero
+	}
+	s := strconv.FormatFloat(x, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	if math.Signbit(x) {
+		return goExpr{s, goUnary}
+	}
+	return goExpr{s, goPrimary}
+}
@@ -0,0 +1,215 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"testing"
+)
+
+func TestNotations(t *testing.T) {
+	tests := []struct {
+		expr  string
+		infix string
+		latex string
+	}{
+		{"x * y + 1", "x * y + 1", `x \cdot y + 1`},
+		{"(x + y) * (x - y) / 2", "(x + y) * (x - y) / 2",
+			`\frac{\left(x + y\right) \cdot \left(x - y\right)}{2}`},
+		{"x - (y - z) + (x + y)", "x - (y - z) + (x + y)", `x - \left(y - z\right) + \left(x + y\right)`},
+		{"1 / (2 / x)", "1 / (2 / x)", `\frac{1}{\frac{2}{x}}`},
+		{"-(x + 1) - -2", "-(x + 1) - -2", `-\left(x + 1\right) - -2`},
+		{"x < 1 ? -x : pow(x + 1, 2)", "x < 1 ? -x : pow(x + 1, 2)",
+			`\begin{cases} -x & \text{if } x < 1 \\ \left(x + 1\right)^{2} & \text{otherwise} \end{cases}`},
+		{"(a ? b : c) ? d : (e ? f : g)", "(a ? b : c) ? d : e ? f : g", ""},
+		{"!(x && y) || z != 2", "!(x && y) || z != 2", `\lnot \left(x \land y\right) \lor z \ne 2`},
+		{"sin(theta) / sqrt(x_1) + cbrt(x)", "sin(theta) / sqrt(x_1) + cbrt(x)",
+			`\frac{\sin\left(\theta\right)}{\sqrt{\mathrm{x\_1}}} + \sqrt[3]{x}`},
+		{"abs(x) + floor(y) * log10(x) + log(y) + asin(x) + hypot(x, y)",
+			"abs(x) + floor(y) * log10(x) + log(y) + asin(x) + hypot(x, y)",
+			`\left|x\right| + \left\lfloor y \right\rfloor \cdot \log_{10}\left(x\right) + ` +
+				`\ln\left(y\right) + \arcsin\left(x\right) + \operatorname{hypot}\left(x, y\right)`},
+		{"1.5e-7 * 2i", "1.5e-07 * 2i", `1.5 \times 10^{-7} \cdot 2i`},
+		{"r = hypot(x, y); f(a) = a*a; f(r) / r", "r = hypot(x, y); f(a) = a * a; f(r) / r",
+			`r = \operatorname{hypot}\left(x, y\right);\quad f\left(a\right) = a \cdot a;\quad \frac{f\left(r\right)}{r}`},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got, _ := FormatAs(expr, Infix); got != test.infix {
+			t.Errorf("Infix(%s) = %s, want %s", test.expr, got, test.infix)
+		}
+		if got, _ := FormatAs(expr, LaTeX); test.latex != "" && got != test.latex {
+			t.Errorf("LaTeX(%s) = %s, want %s", test.expr, got, test.latex)
+		}
+	}
+}
+
+// TestInfixRoundTrip checks that Parse reads the Infix notation of
+// an expression, with and without simplification, as the same tree.
+func TestInfixRoundTrip(t *testing.T) {
+	exprs := []string{
+		"x - (y - (x - y)) / (x / (y / 2))",
+		"-(-x) - -(x * -y) + !x",
+		"x < y == (y < x) != (x <= 2) && (x || y) || !(x && y)",
+		"x > 0 ? (y > 0 ? x : y) : (x ? 1 : 2) ? 3 : 4",
+		"pow(sin(x) + cos(y), -2) / (x * (y + 1))",
+		"r = sqrt(x*x + y*y); g(a, b) = a - (b - r); g(x - y, r / (x / y))",
+	}
+	for _, input := range exprs {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := Derive(expr, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range []Expr{expr, Simplify(expr), Simplify(d)} {
+			infix, _ := FormatAs(e, Infix)
+			back, err := Parse(infix)
+			if err != nil {
+				t.Errorf("Parse(%s): %v", infix, err)
+				continue
+			}
+			if got, _ := FormatAs(back, Infix); got != infix {
+				t.Errorf("Infix(Parse(%s)) = %s", infix, got)
+			}
+			env := Env{"x": 0.7, "y": -1.3}
+			if x, y := e.Eval(env), back.Eval(env); x != y && !(math.IsNaN(x) && math.IsNaN(y)) {
+				t.Errorf("%s = %g, but Parse(%s) = %g", Format(e), x, infix, y)
+			}
+		}
+	}
+}
+
+func TestMathML(t *testing.T) {
+	tests := []struct{ expr, want string }{
+		{"x / 2", "<mfrac><mi>x</mi><mn>2</mn></mfrac>"},
+		{"-x * (y + 1)", "<mrow><mrow><mo>&#x2212;</mo><mi>x</mi></mrow><mo>&#x22C5;</mo>" +
+			"<mrow><mo>(</mo><mrow><mi>y</mi><mo>+</mo><mn>1</mn></mrow><mo>)</mo></mrow></mrow>"},
+		{"x <= pi", "<mrow><mi>x</mi><mo>&#x2264;</mo><mi>π</mi></mrow>"},
+		{"sqrt(pow(x, 2))", "<msqrt><msup><mi>x</mi><mn>2</mn></msup></msqrt>"},
+		{"sin(x)", "<mrow><mi>sin</mi><mo>&#x2061;</mo><mrow><mo>(</mo><mi>x</mi><mo>)</mo></mrow></mrow>"},
+		{"2e10", "<mrow><mn>2</mn><mo>&#xD7;</mo><msup><mn>10</mn><mn>10</mn></msup></mrow>"},
+		{"x ? 1 : 0", `<mrow><mo>{</mo><mtable columnalign="left"><mtr><mtd><mn>1</mn></mtd>` +
+			`<mtd><mtext>if&#xA0;</mtext><mi>x</mi></mtd></mtr><mtr><mtd><mn>0</mn></mtd>` +
+			`<mtd><mtext>otherwise</mtext></mtd></mtr></mtable></mrow>`},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		want := `<math xmlns="http://www.w3.org/1998/Math/MathML">` + test.want + `</math>`
+		if got, _ := FormatAs(expr, MathML); got != want {
+			t.Errorf("MathML(%s) = %s, want %s", test.expr, got, want)
+		}
+	}
+}
+
+func TestGoFunc(t *testing.T) {
+	tests := []struct {
+		expr string
+		fn   GoFunc
+		want string
+	}{
+		{"sin(r) / r", GoFunc{}, `
+func f(r float64) float64 {
+	return math.Sin(r) / r
+}`},
+		{"1 / 2 * x", GoFunc{Name: "half", Params: []Var{"x", "y"}}, `
+func half(x, y float64) float64 {
+	return 1.0 / 2.0 * x
+}`},
+		{"max(x, y, 0) - -x", GoFunc{}, `
+func f(x, y float64) float64 {
+	return math.Max(x, math.Max(y, 0.0)) - -x
+}`},
+		{"x > 0 && y ? -(-x) : x == (y < 1)", GoFunc{}, `
+func f(x, y float64) float64 {
+	b2f := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	return func() float64 {
+		if x > 0.0 && y != 0 {
+			return -(-x)
+		}
+		return b2f(x == b2f(y < 1.0))
+	}()
+}`},
+		{"r = hypot(x, y); a = 2; f(x) = x * r; f(1)", GoFunc{}, `
+func f(x, y float64) float64 {
+	r := math.Hypot(x, y)
+	a := 2.0
+	_ = a
+	f := func(x float64) float64 {
+		return x * r
+	}
+	return f(1.0)
+}`},
+		{"g = 2; g(x) = x * g; g(g)", GoFunc{}, `
+func f() float64 {
+	g := 2.0
+	g_ := func(x float64) float64 {
+		return x * g
+	}
+	return g_(g)
+}`},
+		{"func = 1; func + _ + math", GoFunc{}, `
+func f(__, math_ float64) float64 {
+	func_ := 1.0
+	return func_ + __ + math_
+}`},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got, err := FormatAs(expr, test.fn)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if want := test.want[1:] + "\n"; got != want {
+			t.Errorf("GoFunc(%s) = %s, want %s", test.expr, got, want)
+		}
+		if err := typeCheck(got); err != nil {
+			t.Errorf("GoFunc(%s): %v", test.expr, err)
+		}
+	}
+
+	expr, _ := Parse("x + y")
+	_, err := FormatAs(expr, GoFunc{Params: []Var{"x"}})
+	if err == nil || err.Error() != "undefined variable: y" {
+		t.Errorf("GoFunc with too few parameters: got %v", err)
+	}
+}
+
+// typeCheck reports any error in a file containing the declaration.
+func typeCheck(decl string) error {
+	src := "package p\n\nimport \"math\"\n\nvar _ = math.Pi\n\n" + decl
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		return err
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = conf.Check("p", fset, []*ast.File{f}, nil)
+	return err
+}
@@ -15,13 +15,97 @@ import (
 // This lexer is similar to the one described in Chapter 13.
 type lexer struct {
 	scan  scanner.Scanner
-	token rune // current lookahead token
+	token rune             // current lookahead token
+	pos   Pos              // position of token
+	imag  string           // text of a tokImag token, without the 'i'
+	funcs Funcs            // functions callable in addition to the registered ones
+	defs  map[string]*stmt // functions defined so far in the input
+	uses  []use            // each occurrence of a variable, in order
 }
 
-func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
-func (lex *lexer) text() string { return lex.scan.TokenText() }
+// A use records an occurrence of a variable in the input.
+type use struct {
+	v   Var
+	pos Pos
+}
+
+func (lex *lexer) text() string {
+	if lex.token == tokImag {
+		return lex.imag
+	}
+	return lex.scan.TokenText()
+}
+
+// tokenText returns the full text of the current token.
+func (lex *lexer) tokenText() string {
+	if lex.token == scanner.EOF {
+		return ""
+	}
+	if s, ok := tokens[lex.token]; ok {
+		return s
+	}
+	if lex.token == tokImag {
+		return lex.text() + "i"
+	}
+	return lex.text()
+}
+
+// Tokens for the operators of more than one character. They are
+// negative, like the token classes of text/scanner, so that they
+// cannot be confused with a rune of the input.
+const (
+	tokLE  = -(iota + 100) // <=
+	tokGE                  // >=
+	tokEQ                  // ==
+	tokNE                  // !=
+	tokAnd                 // &&
+	tokOr                  // ||
+
+	tokImag // an imaginary number, e.g., 2i
+)
+
+var tokens = map[rune]string{
+	tokLE:  "<=",
+	tokGE:  ">=",
+	tokEQ:  "==",
+	tokNE:  "!=",
+	tokAnd: "&&",
+	tokOr:  "||",
+}
+
+// opString returns the text of the operator op.
+func opString(op rune) string {
+	if s, ok := tokens[op]; ok {
+		return s
+	}
+	return string(op)
+}
 
-type lexPanic string
+func (lex *lexer) next() {
+	lex.token = lex.scan.Scan()
+	p := lex.scan.Position
+	lex.pos = Pos{p.Offset, p.Line, p.Column}
+	if (lex.token == scanner.Int || lex.token == scanner.Float) && lex.scan.Peek() == 'i' {
+		lex.imag = lex.text()
+		lex.scan.Next()
+		lex.token = tokImag
+		return
+	}
+	// Combine the runes of a two-character operator.
+	for tok, s := range tokens {
+		if lex.token == rune(s[0]) && lex.scan.Peek() == rune(s[1]) {
+			lex.scan.Next()
+			lex.token = tok
+			return
+		}
+	}
+}
+
+// errorf reports an error at the current token by panicking with an
+// *Error, which is recovered by Parse.
+func (lex *lexer) errorf(format string, args ...interface{}) {
+	panic(&Error{lex.pos, lex.tokenText(), fmt.Sprintf(format, args...)})
+}
 
 // describe returns a string describing the current token, for use in errors.
 func (lex *lexer) describe() string {
@@ -32,6 +116,11 @@ func (lex *lexer) describe() string {
 		return fmt.Sprintf("identifier %s", lex.text())
 	case scanner.Int, scanner.Float:
 		return fmt.Sprintf("number %s", lex.text())
+	case tokImag:
+		return fmt.Sprintf("number %si", lex.text())
+	}
+	if s, ok := tokens[lex.token]; ok {
+		return fmt.Sprintf("'%s'", s)
 	}
 	return fmt.Sprintf("%q", rune(lex.token)) // any other rune
 }
@@ -39,8 +128,16 @@ func (lex *lexer) describe() string {
 func precedence(op rune) int {
 	switch op {
 	case '*', '/':
-		return 2
+		return 6
 	case '+', '-':
+		return 5
+	case '<', '>', tokLE, tokGE:
+		return 4
+	case tokEQ, tokNE:
+		return 3
+	case tokAnd:
+		return 2
+	case tokOr:
 		return 1
 	}
 	return 0
@@ -51,35 +148,169 @@ func precedence(op rune) int {
 // Parse parses the input string as an arithmetic expression.
 //
 //   expr = num                         a literal number, e.g., 3.14159
+//        | num 'i'                     an imaginary number, e.g., 2i
 //        | id                          a variable name, e.g., x
 //        | id '(' expr ',' ... ')'     a function call
-//        | '-' expr                    a unary operator (+-)
-//        | expr '+' expr               a binary operator (+-*/)
+//        | '-' expr                    a unary operator (+-!)
+//        | expr '+' expr               a binary operator (+-*/ < <= == etc)
+//        | expr '?' expr ':' expr      a conditional, also if(expr, expr, expr)
 //
-func Parse(input string) (_ Expr, err error) {
+// The input may also be a sequence of statements separated by ';', each
+// but the last of which defines a variable or a function for use by the
+// statements that follow:
+//
+//   stmt = id '=' expr                 a variable, e.g., r = sqrt(x*x + y*y)
+//        | id '(' id ',' ... ')' '=' expr  a function, e.g., f(a, b) = a*b + 1
+//        | expr
+//
+// The value of the sequence is that of its last statement.
+// Comparisons and logical operators yield 1 for true and 0 for false;
+// any nonzero operand is considered true.
+//
+func Parse(input string) (Expr, error) {
+	return ParseFuncs(input, nil)
+}
+
+// ParseFuncs is like Parse but also lets the expression call the
+// functions in funcs, which take precedence over registered functions
+// of the same name.
+func ParseFuncs(input string, funcs Funcs) (Expr, error) {
+	e, _, err := parse(input, funcs)
+	return e, err
+}
+
+// parse parses input and also returns each use of a variable.
+// A syntax error is reported as an *Error.
+func parse(input string, funcs Funcs) (_ Expr, _ []use, err error) {
 	defer func() {
 		switch x := recover().(type) {
 		case nil:
 			// no panic
-		case lexPanic:
-			err = fmt.Errorf("%s", x)
+		case *Error:
+			err = x
 		default:
 			// unexpected panic: resume state of panic.
 			panic(x)
 		}
 	}()
-	lex := new(lexer)
+	lex := &lexer{funcs: funcs, defs: make(map[string]*stmt)}
 	lex.scan.Init(strings.NewReader(input))
 	lex.scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats
+	lex.scan.Error = func(s *scanner.Scanner, msg string) {
+		p := s.Pos()
+		panic(&Error{Pos{p.Offset, p.Line, p.Column}, "", msg})
+	}
 	lex.next() // initial lookahead
-	e := parseExpr(lex)
+	e := parseBlock(lex)
 	if lex.token != scanner.EOF {
-		return nil, fmt.Errorf("unexpected %s", lex.describe())
+		lex.errorf("unexpected %s", lex.describe())
+	}
+	return e, lex.uses, nil
+}
+
+// Validate parses input and checks the resulting expression, like
+// Parse followed by Check, but it reports every problem it finds
+// as an ErrorList, together with its position. If vars is not nil,
+// any variable not in vars is also reported, wherever it is used.
+func Validate(input string, funcs Funcs, vars map[Var]bool) (Expr, error) {
+	e, uses, err := parse(input, funcs)
+	if err != nil {
+		return nil, errorList(err)
+	}
+	used := make(map[Var]bool)
+	errs := []error{e.Check(used)}
+	if vars != nil {
+		for _, u := range uses {
+			if used[u.v] && !vars[u.v] {
+				errs = append(errs, &Error{u.pos, string(u.v),
+					fmt.Sprintf("undefined variable: %s", u.v)})
+			}
+		}
+	}
+	if err := errorList(errs...); err != nil {
+		return nil, err
 	}
 	return e, nil
 }
 
-func parseExpr(lex *lexer) Expr { return parseBinary(lex, 1) }
+// block = stmt (';' stmt)* [';']
+// A block of a single expression is just that expression.
+func parseBlock(lex *lexer) Expr {
+	var stmts []*stmt
+	for {
+		if len(stmts) > 0 && stmts[len(stmts)-1].name == "" {
+			prev := stmts[len(stmts)-1]
+			panic(&Error{prev.pos, "", "expression value is not used"})
+		}
+		stmts = append(stmts, parseStmt(lex))
+		if lex.token != ';' {
+			break
+		}
+		lex.next() // consume ';'
+		if lex.token == scanner.EOF {
+			break
+		}
+	}
+	if len(stmts) == 1 && stmts[0].name == "" {
+		return stmts[0].x
+	}
+	return block{stmts}
+}
+
+// stmt = id '=' expr | id '(' id ',' ... ')' '=' expr | expr
+func parseStmt(lex *lexer) *stmt {
+	s := &stmt{pos: lex.pos}
+	start := len(lex.uses)
+	x := parseExpr(lex)
+	if lex.token == '=' {
+		// x is the left side of a definition.
+		if fc, ok := x.(funcCall); ok {
+			x = fc.call
+		}
+		switch x := x.(type) {
+		case Var:
+			s.name = string(x)
+		case call:
+			s.name, s.function = x.fn, true
+			for _, arg := range x.args {
+				param, ok := arg.(Var)
+				if !ok {
+					panic(&Error{s.pos, x.fn, fmt.Sprintf("parameter of %s is not a name", x.fn)})
+				}
+				s.params = append(s.params, param)
+			}
+		case apply:
+			panic(&Error{s.pos, x.fn, fmt.Sprintf("%s redefined", x.fn)})
+		default:
+			lex.errorf("cannot assign to %s", Format(x))
+		}
+		lex.next() // consume '='
+		lex.uses = lex.uses[:start]
+		x = parseExpr(lex)
+		if s.function {
+			lex.defs[s.name] = s
+		}
+	}
+	s.x = x
+	s.uses = lex.uses[start:]
+	return s
+}
+
+// expr = binary ['?' expr ':' expr]
+func parseExpr(lex *lexer) Expr {
+	cond := parseBinary(lex, 1)
+	if lex.token != '?' {
+		return cond
+	}
+	lex.next() // consume '?'
+	x := parseExpr(lex)
+	if lex.token != ':' {
+		lex.errorf("got %s, want ':'", lex.describe())
+	}
+	lex.next() // consume ':'
+	y := parseExpr(lex)
+	return conditional{cond, x, y}
+}
 
 // binary = unary ('+' binary)*
 // parseBinary stops when it encounters an
@@ -99,9 +330,9 @@ func parseBinary(lex *lexer, prec1 int) Expr {
 
 // unary = '+' expr | primary
 func parseUnary(lex *lexer) Expr {
-	if lex.token == '+' || lex.token == '-' {
+	if lex.token == '+' || lex.token == '-' || lex.token == '!' {
 		op := lex.token
-		lex.next() // consume '+' or '-'
+		lex.next() // consume '+', '-' or '!'
 		return unary{op, parseUnary(lex)}
 	}
 	return parsePrimary(lex)
@@ -114,9 +345,10 @@ func parseUnary(lex *lexer) Expr {
 func parsePrimary(lex *lexer) Expr {
 	switch lex.token {
 	case scanner.Ident:
-		id := lex.text()
+		id, pos := lex.text(), lex.pos
 		lex.next() // consume Ident
 		if lex.token != '(' {
+			lex.uses = append(lex.uses, use{Var(id), pos})
 			return Var(id)
 		}
 		lex.next() // consume '('
@@ -130,31 +362,47 @@ func parsePrimary(lex *lexer) Expr {
 				lex.next() // consume ','
 			}
 			if lex.token != ')' {
-				msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-				panic(lexPanic(msg))
+				lex.errorf("got %s, want ')'", lex.describe())
 			}
 		}
 		lex.next() // consume ')'
-		return call{id, args}
+		if id == "if" {
+			if len(args) != 3 {
+				msg := fmt.Sprintf("call to if has %d args, want 3", len(args))
+				panic(&Error{pos, id, msg})
+			}
+			return conditional{args[0], args[1], args[2]}
+		}
+		if def, ok := lex.defs[id]; ok {
+			return newApply(id, args, def, pos)
+		}
+		return newCall(id, args, lex.funcs, pos)
 
 	case scanner.Int, scanner.Float:
 		f, err := strconv.ParseFloat(lex.text(), 64)
 		if err != nil {
-			panic(lexPanic(err.Error()))
+			lex.errorf("%s", err)
 		}
 		lex.next() // consume number
 		return literal(f)
 
+	case tokImag:
+		f, err := strconv.ParseFloat(lex.text(), 64)
+		if err != nil {
+			lex.errorf("%s", err)
+		}
+		lex.next() // consume number
+		return imaginary(f)
+
 	case '(':
 		lex.next() // consume '('
 		e := parseExpr(lex)
 		if lex.token != ')' {
-			msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-			panic(lexPanic(msg))
+			lex.errorf("got %s, want ')'", lex.describe())
 		}
 		lex.next() // consume ')'
 		return e
 	}
-	msg := fmt.Sprintf("unexpected %s", lex.describe())
-	panic(lexPanic(msg))
+	lex.errorf("unexpected %s", lex.describe())
+	panic("unreachable")
 }
@@ -6,6 +6,7 @@ package eval
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
 // Format formats an expression as a string.
@@ -21,6 +22,9 @@ func write(buf *bytes.Buffer, e Expr) {
 	case literal:
 		fmt.Fprintf(buf, "%g", e)
 
+	case imaginary:
+		fmt.Fprintf(buf, "%gi", e)
+
 	case Var:
 		fmt.Fprintf(buf, "%s", e)
 
@@ -32,21 +36,71 @@ func write(buf *bytes.Buffer, e Expr) {
 	case binary:
 		buf.WriteByte('(')
 		write(buf, e.x)
-		fmt.Fprintf(buf, " %c ", e.op)
+		fmt.Fprintf(buf, " %s ", opString(e.op))
 		write(buf, e.y)
 		buf.WriteByte(')')
 
-	case call:
-		fmt.Fprintf(buf, "%s(", e.fn)
-		for i, arg := range e.args {
-			if i > 0 {
-				buf.WriteString(", ")
-			}
-			write(buf, arg)
-		}
+	case conditional:
+		buf.WriteByte('(')
+		write(buf, e.cond)
+		buf.WriteString(" ? ")
+		write(buf, e.x)
+		buf.WriteString(" : ")
+		write(buf, e.y)
 		buf.WriteByte(')')
 
+	case call:
+		writeCall(buf, e.fn, e.args, write)
+
+	case funcCall:
+		writeCall(buf, e.fn, e.args, write)
+
+	case apply:
+		writeCall(buf, e.fn, e.args, write)
+
+	case block:
+		writeBlock(buf, e, write)
+
 	default:
 		panic(fmt.Sprintf("unknown Expr: %T", e))
 	}
 }
+
+// writeCall writes a call of fn, writing each argument by calling
+// arg.
+func writeCall(buf *bytes.Buffer, fn string, args []Expr, arg func(*bytes.Buffer, Expr)) {
+	fmt.Fprintf(buf, "%s(", fn)
+	for i, x := range args {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		arg(buf, x)
+	}
+	buf.WriteByte(')')
+}
+
+// writeBlock writes the statements of a block separated by
+// semicolons, writing each expression by calling x.
+func writeBlock(buf *bytes.Buffer, b block, x func(*bytes.Buffer, Expr)) {
+	for i, s := range b.stmts {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		if s.function {
+			buf.WriteString(s.signature())
+			buf.WriteString(" = ")
+		} else if s.name != "" {
+			fmt.Fprintf(buf, "%s = ", s.name)
+		}
+		x(buf, s.x)
+	}
+}
+
+// signature returns the left side of a function definition, f(a, b).
+func (s *stmt) signature() string {
+	params := make([]string, len(s.params))
+	for i, p := range s.params {
+		params[i] = string(p)
+	}
+	return s.name + "(" + strings.Join(params, ", ") + ")"
+}
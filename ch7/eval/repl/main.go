@@ -0,0 +1,345 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// The repl command is an interactive calculator for the expressions
+// of package gopl.io/ch7/eval. It reads one line at a time and prints
+// its value. Variables and functions defined on one line, for example
+//
+//	r = 2; area(r) = 3.14159 * r * r
+//
+// may be used on the lines that follow, and _ holds the last value.
+// Lines beginning with a colon are commands; type :help to list them.
+// Previous lines may be recalled by !! (the last line) or !n (line n
+// of :history), and are saved in the file named by the -history flag.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopl.io/ch7/eval"
+)
+
+var historyFile = flag.String("history", defaultHistory(),
+	"file in which to keep the history of input lines, or \"\" for none")
+
+const maxHistory = 1000 // number of lines kept in the history file
+
+func main() {
+	flag.Parse()
+	var s session
+	s.init()
+	s.out = os.Stdout
+	if *historyFile != "" {
+		s.history = loadHistory(*historyFile)
+	}
+	start := len(s.history)
+
+	interactive := isTerminal(os.Stdin)
+	input := bufio.NewScanner(os.Stdin)
+	for {
+		if interactive {
+			fmt.Print("> ")
+		}
+		if !input.Scan() || !s.exec(input.Text()) {
+			break
+		}
+	}
+	if *historyFile != "" && len(s.history) > start {
+		if err := saveHistory(*historyFile, s.history); err != nil {
+			fmt.Fprintf(os.Stderr, "repl: %v\n", err)
+		}
+	}
+}
+
+// A session holds the state of the calculator between lines.
+type session struct {
+	env     eval.Env
+	funcs   eval.Funcs // functions defined by earlier lines
+	history []string
+	out     io.Writer
+}
+
+func (s *session) init() {
+	s.env = make(eval.Env)
+	s.funcs = make(eval.Funcs)
+}
+
+// exec executes one line of input, reporting whether to continue.
+func (s *session) exec(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return true
+	}
+	if isRecall(line) {
+		recalled, err := s.recall(line)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			return true
+		}
+		fmt.Fprintln(s.out, recalled)
+		line = recalled
+	}
+	s.history = append(s.history, line)
+
+	if !strings.HasPrefix(line, ":") {
+		s.calculate(line)
+		return true
+	}
+	cmd, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		cmd, arg = line[:i], strings.TrimSpace(line[i:])
+	}
+	switch cmd {
+	case ":vars":
+		s.vars()
+	case ":format":
+		s.format(arg)
+	case ":exact":
+		s.exact(arg)
+	case ":big":
+		s.big(arg)
+	case ":simplify":
+		if e := s.parse(arg, false); e != nil {
+			fmt.Fprintln(s.out, eval.Format(eval.Simplify(e)))
+		}
+	case ":history":
+		for i, h := range s.history {
+			fmt.Fprintf(s.out, "%5d  %s\n", i+1, h)
+		}
+	case ":help":
+		fmt.Fprint(s.out, help)
+	case ":quit":
+		return false
+	default:
+		fmt.Fprintf(s.out, "unknown command %s; try :help\n", cmd)
+	}
+	return true
+}
+
+const help = `expr                evaluate an expression, e.g., sqrt(x*x + y*y)
+x = expr            define a variable for the following lines
+f(a, b) = expr      define a function for the following lines
+:vars               list the variables and their values
+:format expr        print an expression with full parentheses
+:format n expr      print an expression in notation n: infix, latex,
+                    mathml or go
+:simplify expr      print an expression in simplified form
+:exact expr         compute an expression exactly, as a fraction
+:big bits expr      compute an expression to the given number of bits
+:history            list the previous lines
+!!, !n              repeat the last line, or line n of :history
+:help               print this message
+:quit               exit (as does end of file)
+`
+
+// calculate evaluates the line and prints its value.
+func (s *session) calculate(line string) {
+	e := s.parse(line, true)
+	if e == nil {
+		return
+	}
+	v := eval.Run(e, s.env, s.funcs)
+	s.env["_"] = v
+	fmt.Fprintf(s.out, "%.*g\n", digits, v)
+}
+
+// digits is the number of significant digits printed for each value.
+// Any more might show the rounding errors of floating point.
+const digits = 15
+
+// parse parses and checks input, in which the functions defined so
+// far may be called. If defined is set, only the variables defined so
+// far may be used. It prints any errors and returns nil.
+func (s *session) parse(input string, defined bool) eval.Expr {
+	if input == "" {
+		fmt.Fprintln(s.out, "missing expression")
+		return nil
+	}
+	var vars map[eval.Var]bool
+	if defined {
+		vars = make(map[eval.Var]bool)
+		for v := range s.env {
+			vars[v] = true
+		}
+	}
+	e, err := eval.Validate(input, s.funcs, vars)
+	if err != nil {
+		eval.PrintError(s.out, input, err)
+		return nil
+	}
+	return e
+}
+
+// format prints an expression, in the notation named by its first
+// word if that is one of eval.Notations.
+func (s *session) format(arg string) {
+	n := eval.Parens
+	if i := strings.IndexAny(arg, " \t"); i >= 0 {
+		if notation, ok := eval.Notations[arg[:i]]; ok {
+			n, arg = notation, strings.TrimSpace(arg[i:])
+		}
+	}
+	e := s.parse(arg, false)
+	if e == nil {
+		return
+	}
+	text, err := eval.FormatAs(e, n)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	fmt.Fprintln(s.out, strings.TrimSuffix(text, "\n"))
+}
+
+// exact evaluates an expression in rational arithmetic. The values of
+// variables are taken to be the shortest decimals that they round to.
+func (s *session) exact(arg string) {
+	e := s.parse(arg, true)
+	if e == nil {
+		return
+	}
+	env := make(eval.RatEnv)
+	for v, x := range s.env {
+		if r, ok := new(big.Rat).SetString(strconv.FormatFloat(x, 'g', -1, 64)); ok {
+			env[v] = r
+		}
+	}
+	r, err := eval.EvalRat(e, env)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	if r.IsInt() {
+		fmt.Fprintln(s.out, r.RatString())
+		return
+	}
+	// Show the decimal value too, or an approximation if it has
+	// more digits.
+	dec := r.FloatString(digits)
+	if d, _ := new(big.Rat).SetString(dec); d.Cmp(r) == 0 {
+		fmt.Fprintf(s.out, "%s = %s\n", r.RatString(), strings.TrimRight(dec, "0"))
+	} else {
+		fmt.Fprintf(s.out, "%s ≈ %s\n", r.RatString(), dec)
+	}
+}
+
+// big evaluates an expression in floating point of the given number
+// of bits, printing as many digits as that precision warrants.
+func (s *session) big(arg string) {
+	i := strings.IndexAny(arg, " \t")
+	if i < 0 {
+		fmt.Fprintln(s.out, "usage: :big bits expr")
+		return
+	}
+	prec, err := strconv.ParseUint(arg[:i], 10, 32)
+	if err != nil || prec == 0 {
+		fmt.Fprintf(s.out, "bad number of bits %s\n", arg[:i])
+		return
+	}
+	e := s.parse(strings.TrimSpace(arg[i:]), true)
+	if e == nil {
+		return
+	}
+	env := make(eval.BigEnv)
+	for v, x := range s.env {
+		if r, ok := new(big.Rat).SetString(strconv.FormatFloat(x, 'g', -1, 64)); ok {
+			env[v] = new(big.Float).SetPrec(uint(prec)).SetRat(r)
+		}
+	}
+	z, err := eval.EvalBig(e, env, uint(prec))
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	// Each decimal digit takes log2(10) bits.
+	fmt.Fprintln(s.out, z.Text('g', int(float64(prec)/math.Log2(10))))
+}
+
+// vars prints the variables in alphabetical order.
+func (s *session) vars() {
+	var names []string
+	for v := range s.env {
+		names = append(names, string(v))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%s = %.*g\n", name, digits, s.env[eval.Var(name)])
+	}
+}
+
+// isRecall reports whether line is !! or !n, rather than an expression
+// such as !x.
+func isRecall(line string) bool {
+	if line == "!!" {
+		return true
+	}
+	if len(line) < 2 || line[0] != '!' {
+		return false
+	}
+	for _, r := range line[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// recall returns the line of history denoted by !! or !n.
+func (s *session) recall(line string) (string, error) {
+	n := len(s.history)
+	if line != "!!" {
+		var err error
+		n, err = strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("bad history reference %s", line)
+		}
+	}
+	if n < 1 || n > len(s.history) {
+		return "", fmt.Errorf("no line %s in history", line[1:])
+	}
+	return s.history[n-1], nil
+}
+
+// ---- history file ----
+
+func defaultHistory() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".eval_history")
+}
+
+// loadHistory returns the lines of the history file, if any.
+func loadHistory(filename string) []string {
+	data, err := os.ReadFile(filename)
+	if err != nil || len(data) == 0 {
+		return nil // e.g., no history yet
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// saveHistory writes the last maxHistory lines of history to the file.
+func saveHistory(filename string, history []string) error {
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	return os.WriteFile(filename, []byte(strings.Join(history, "\n")+"\n"), 0600)
+}
+
+// isTerminal reports whether f is a terminal, in which case the
+// user is prompted for each line.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
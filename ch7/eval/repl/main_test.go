@@ -0,0 +1,112 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	lines := []string{
+		"1 + 2",
+		"_ * 10",
+		"r = 2; area(r) = 3.14159 * r * r",
+		"area(r + 1)",
+		"x + 1",
+		":vars",
+		":format 1 + 2 * x",
+		":format infix (1 + 2) * x",
+		":format latex sqrt(x) / 2",
+		":format go area(r) * 2",
+		":simplify x * 1 + 0 * y",
+		":exact 0.1 + 0.2 - r / 10",
+		":exact 1 / 3",
+		":big 100 1 / 3",
+		":big 64 sin(1)",
+		"sqrt(2",
+		"!2",
+		"!!",
+		"!99",
+		":history",
+		":frob",
+		":quit",
+		"1 + 1",
+	}
+	want := `3
+30
+0
+28.27431
+1:1: undefined variable: x
+  x + 1
+  ^
+_ = 28.27431
+r = 2
+(1 + (2 * x))
+(1 + 2) * x
+\frac{\sqrt{x}}{2}
+func f(r float64) float64 {
+	return area(r) * 2.0
+}
+x
+1/10 = 0.1
+1/3 ≈ 0.333333333333333
+0.333333333333333333333333333333
+sin cannot be computed to 64 bits
+1:7: got end of file, want ')'
+  sqrt(2
+        ^
+_ * 10
+282.7431
+_ * 10
+2827.431
+no line 99 in history
+    1  1 + 2
+    2  _ * 10
+    3  r = 2; area(r) = 3.14159 * r * r
+    4  area(r + 1)
+    5  x + 1
+    6  :vars
+    7  :format 1 + 2 * x
+    8  :format infix (1 + 2) * x
+    9  :format latex sqrt(x) / 2
+   10  :format go area(r) * 2
+   11  :simplify x * 1 + 0 * y
+   12  :exact 0.1 + 0.2 - r / 10
+   13  :exact 1 / 3
+   14  :big 100 1 / 3
+   15  :big 64 sin(1)
+   16  sqrt(2
+   17  _ * 10
+   18  _ * 10
+   19  :history
+unknown command :frob; try :help
+`
+	var s session
+	s.init()
+	var out bytes.Buffer
+	s.out = &out
+	for _, line := range lines {
+		if !s.exec(line) {
+			break
+		}
+	}
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNot(t *testing.T) {
+	var s session
+	s.init()
+	var out bytes.Buffer
+	s.out = &out
+	for _, line := range []string{"x = 0", "!x", "! x", "!(x + 1)", "!1"} {
+		s.exec(line)
+	}
+	want := "0\n1\n1\n0\nx = 0\n0\n"
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
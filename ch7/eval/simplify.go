@@ -0,0 +1,506 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// Simplify returns an expression equivalent to e that is easier to
+// read and cheaper to evaluate. It folds constant subexpressions,
+// flattens nested sums and products, collects like terms, and removes
+// identities such as x*1, x+0, x-x and pow(x, 1).
+//
+// Like most algebraic simplifiers, it assumes that variables are
+// finite, so x*0 and x-x become 0 even though x could be NaN.
+// Constants are folded only when the result is finite, so that the
+// simplified expression can still be printed by Format and parsed;
+// a constant left unfolded is not assumed finite, so 0*(1/0) is kept.
+// A quotient is left alone unless its divisor is a nonzero constant.
+// Definitions in a block that are no longer used are removed.
+func Simplify(e Expr) Expr {
+	return simplify(e, nil)
+}
+
+// simplify simplifies e. The map defs holds the simplified form of each
+// function definition of the enclosing block.
+func simplify(e Expr, defs map[*stmt]*stmt) Expr {
+	switch e := e.(type) {
+	case Var, literal, imaginary:
+		return e
+
+	case unary:
+		x := simplify(e.x, defs)
+		switch e.op {
+		case '+':
+			return x
+		case '-':
+			return negate(x)
+		case '!':
+			if lit, ok := x.(literal); ok {
+				return literal(truth(lit == 0))
+			}
+		}
+		return unary{e.op, x}
+
+	case binary:
+		x, y := simplify(e.x, defs), simplify(e.y, defs)
+		switch e.op {
+		case '+', '-':
+			var s sum
+			s.add(x, 1)
+			if e.op == '+' {
+				s.add(y, 1)
+			} else {
+				s.add(y, -1)
+			}
+			return s.expr()
+		case '*':
+			p := product{c: 1}
+			p.mul(x)
+			p.mul(y)
+			return p.expr()
+		case '/':
+			return quotient(x, y)
+		case tokAnd, tokOr:
+			return logical(e.op, x, y)
+		}
+		_, xconst := x.(literal)
+		_, yconst := y.(literal)
+		if xconst && yconst {
+			return literal(binary{e.op, x, y}.Eval(nil)) // a comparison
+		}
+		return binary{e.op, x, y}
+
+	case conditional:
+		cond, x, y := simplify(e.cond, defs), simplify(e.x, defs), simplify(e.y, defs)
+		if lit, ok := cond.(literal); ok {
+			if lit != 0 {
+				return x
+			}
+			return y
+		}
+		if equal(x, y) {
+			return x
+		}
+		return conditional{cond, x, y}
+
+	case call:
+		args, x := simplifyCall(e, e.fun(), defs)
+		if x != nil {
+			return x
+		}
+		return call{e.fn, args}
+
+	case funcCall:
+		args, x := simplifyCall(e.call, e.f, defs)
+		if x != nil {
+			return x
+		}
+		return funcCall{call{e.fn, args}, e.f, e.pos}
+
+	case apply:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = simplify(arg, defs)
+		}
+		def := e.def
+		if d, ok := defs[def]; ok {
+			def = d
+		}
+		return newApply(e.fn, args, def, e.pos)
+
+	case block:
+		defs := make(map[*stmt]*stmt)
+		stmts := make([]*stmt, len(e.stmts))
+		for i, s := range e.stmts {
+			s2 := *s
+			s2.x = simplify(s.x, defs)
+			stmts[i] = &s2
+			if s.function {
+				defs[s] = &s2
+			}
+		}
+		// Working backwards, keep the last statement
+		// and each definition used by a statement kept.
+		var kept []*stmt
+		for i := len(stmts) - 1; i >= 0; i-- {
+			s := stmts[i]
+			used := i == len(stmts)-1
+			for _, k := range kept {
+				if mentions(k.x, s.name, s.function) {
+					used = true
+					break
+				}
+			}
+			if used {
+				kept = append([]*stmt{s}, kept...)
+			}
+		}
+		if len(kept) == 1 && kept[0].name == "" {
+			return kept[0].x
+		}
+		return block{kept}
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+// simplifyCall simplifies the arguments of a call of f. If the call
+// itself simplifies to another expression, it returns that too.
+func simplifyCall(e call, f *Func, defs map[*stmt]*stmt) ([]Expr, Expr) {
+	args := make([]Expr, len(e.args))
+	consts := make([]float64, len(e.args))
+	folding := arityOK(f, len(args))
+	for i, arg := range e.args {
+		args[i] = simplify(arg, defs)
+		if lit, ok := args[i].(literal); ok {
+			consts[i] = float64(lit)
+		} else {
+			folding = false
+		}
+	}
+	if folding {
+		if x := f.Fn(consts); isFinite(x) {
+			return args, literal(x)
+		}
+	}
+	if e.fn == "pow" && len(args) == 2 && isBuiltin("pow", f) {
+		switch args[1] {
+		case literal(0):
+			return args, literal(1)
+		case literal(1):
+			return args, args[0]
+		}
+	}
+	return args, nil
+}
+
+// mentions reports whether e refers to the named variable,
+// or function if function is set.
+func mentions(e Expr, name string, function bool) bool {
+	switch e := e.(type) {
+	case Var:
+		return !function && string(e) == name
+	case literal, imaginary:
+		return false
+	case unary:
+		return mentions(e.x, name, function)
+	case binary:
+		return mentions(e.x, name, function) || mentions(e.y, name, function)
+	case conditional:
+		return mentions(e.cond, name, function) ||
+			mentions(e.x, name, function) || mentions(e.y, name, function)
+	case call:
+		for _, arg := range e.args {
+			if mentions(arg, name, function) {
+				return true
+			}
+		}
+		return false
+	case funcCall:
+		return mentions(e.call, name, function)
+	case apply:
+		if function && e.fn == name {
+			return true
+		}
+		for _, arg := range e.args {
+			if mentions(arg, name, function) {
+				return true
+			}
+		}
+		return false
+	}
+	return true // conservatively
+}
+
+// negate returns the simplified negation of the simplified expression x.
+func negate(x Expr) Expr {
+	var s sum
+	s.add(x, -1)
+	return s.expr()
+}
+
+// quotient returns the simplified quotient of the simplified
+// expressions x and y.
+func quotient(x, y Expr) Expr {
+	if u, ok := x.(unary); ok && u.op == '-' {
+		return negate(quotient(u.x, y))
+	}
+	if u, ok := y.(unary); ok && u.op == '-' {
+		return negate(quotient(x, u.x))
+	}
+	if b, ok := y.(literal); ok {
+		if a, ok := x.(literal); ok && isFinite(float64(a/b)) {
+			return a / b
+		}
+		switch b {
+		case 1:
+			return x
+		case -1:
+			return negate(x)
+		}
+	}
+	// Rewriting 0/x as 0 or x/x as 1 would be wrong where x is zero.
+	return binary{'/', x, y}
+}
+
+// logical returns the simplified form of x && y or x || y, where x and y
+// are simplified. A constant operand either decides the result or leaves
+// just the truth value of the other operand.
+func logical(op rune, x, y Expr) Expr {
+	// decisive is the operand value that decides the result:
+	// false for &&, true for ||.
+	decisive := op == tokOr
+	for _, pair := range [2][2]Expr{{x, y}, {y, x}} {
+		lit, ok := pair[0].(literal)
+		if !ok {
+			continue
+		}
+		if (lit != 0) == decisive {
+			return literal(truth(decisive))
+		}
+		if isBool(pair[1]) {
+			return pair[1]
+		}
+		if _, ok := pair[1].(literal); ok {
+			return literal(truth(pair[1] != literal(0)))
+		}
+		return binary{tokNE, pair[1], literal(0)}
+	}
+	return binary{op, x, y}
+}
+
+// isBool reports whether e always evaluates to 0 or 1.
+func isBool(e Expr) bool {
+	switch e := e.(type) {
+	case literal:
+		return e == 0 || e == 1
+	case unary:
+		return e.op == '!'
+	case binary:
+		switch e.op {
+		case '<', '>', tokLE, tokGE, tokEQ, tokNE, tokAnd, tokOr:
+			return true
+		}
+	case conditional:
+		return isBool(e.x) && isBool(e.y)
+	}
+	return false
+}
+
+// A sum is a flattened sequence of additions and subtractions:
+// a constant plus a linear combination of non-constant terms.
+type sum struct {
+	c     float64
+	terms []term
+}
+
+type term struct {
+	coef float64
+	x    Expr
+}
+
+// add adds coef times the simplified expression e to the sum.
+func (s *sum) add(e Expr, coef float64) {
+	switch e := e.(type) {
+	case literal:
+		if c := s.c + coef*float64(e); isFinite(c) {
+			s.c = c
+			return
+		}
+		// An overflowing constant is kept as a term.
+	case unary:
+		if e.op == '-' {
+			s.add(e.x, -coef)
+			return
+		}
+	case binary:
+		switch e.op {
+		case '+':
+			s.add(e.x, coef)
+			s.add(e.y, coef)
+			return
+		case '-':
+			s.add(e.x, coef)
+			s.add(e.y, -coef)
+			return
+		case '*':
+			if k, ok := e.x.(literal); ok && isFinite(coef*float64(k)) {
+				s.add(e.y, coef*float64(k))
+				return
+			}
+		}
+	}
+	for i := range s.terms {
+		if c := s.terms[i].coef + coef; equal(s.terms[i].x, e) && isFinite(c) {
+			s.terms[i].coef = c
+			return
+		}
+	}
+	s.terms = append(s.terms, term{coef, e})
+}
+
+// expr returns the simplest expression for the sum. A positive term is
+// placed first, if there is one, to avoid a leading unary minus.
+func (s *sum) expr() Expr {
+	var terms []term
+	for _, t := range s.terms {
+		if t.coef != 0 || isConstant(t.x) {
+			terms = append(terms, t)
+		}
+	}
+	for i, t := range terms {
+		if t.coef > 0 {
+			copy(terms[1:i+1], terms[:i])
+			terms[0] = t
+			break
+		}
+	}
+	var e Expr
+	for _, t := range terms {
+		switch {
+		case e == nil:
+			e = scale(t.coef, t.x)
+		case t.coef >= 0:
+			e = binary{'+', e, scale(t.coef, t.x)}
+		default:
+			e = binary{'-', e, scale(-t.coef, t.x)}
+		}
+	}
+	switch {
+	case e == nil:
+		return literal(s.c)
+	case s.c > 0:
+		return binary{'+', e, literal(s.c)}
+	case s.c < 0:
+		return binary{'-', e, literal(-s.c)}
+	}
+	return e
+}
+
+// scale returns k times the simplified expression x.
+func scale(k float64, x Expr) Expr {
+	p := product{c: 1}
+	p.mul(literal(k))
+	p.mul(x)
+	return p.expr()
+}
+
+// A product is a flattened sequence of multiplications:
+// a constant times a list of non-constant factors.
+type product struct {
+	c       float64
+	factors []Expr
+}
+
+// mul multiplies the product by the simplified expression e.
+func (p *product) mul(e Expr) {
+	switch e := e.(type) {
+	case literal:
+		if c := p.c * float64(e); isFinite(c) {
+			p.c = c
+			return
+		}
+		// An overflowing constant is kept as a factor.
+	case unary:
+		if e.op == '-' {
+			p.c = -p.c
+			p.mul(e.x)
+			return
+		}
+	case binary:
+		if e.op == '*' {
+			p.mul(e.x)
+			p.mul(e.y)
+			return
+		}
+	}
+	p.factors = append(p.factors, e)
+}
+
+// expr returns the simplest expression for the product,
+// with the constant factor, if any, first.
+func (p *product) expr() Expr {
+	if len(p.factors) == 0 {
+		return literal(p.c)
+	}
+	if p.c == 0 {
+		// Only variables are assumed finite: a constant
+		// factor that was not folded may be infinite or NaN.
+		zero := true
+		for _, f := range p.factors {
+			zero = zero && !isConstant(f)
+		}
+		if zero {
+			return literal(0)
+		}
+	}
+	e := p.factors[0]
+	for _, f := range p.factors[1:] {
+		e = binary{'*', e, f}
+	}
+	switch p.c {
+	case 1:
+		return e
+	case -1:
+		return unary{'-', e}
+	}
+	return binary{'*', literal(p.c), e}
+}
+
+// equal reports whether x and y are structurally identical.
+func equal(x, y Expr) bool {
+	switch x := x.(type) {
+	case Var, literal, imaginary:
+		return x == y
+	case unary:
+		y, ok := y.(unary)
+		return ok && x.op == y.op && equal(x.x, y.x)
+	case binary:
+		y, ok := y.(binary)
+		return ok && x.op == y.op && equal(x.x, y.x) && equal(x.y, y.y)
+	case conditional:
+		y, ok := y.(conditional)
+		return ok && equal(x.cond, y.cond) && equal(x.x, y.x) && equal(x.y, y.y)
+	case call:
+		y, ok := y.(call)
+		if !ok || x.fn != y.fn || len(x.args) != len(y.args) {
+			return false
+		}
+		for i := range x.args {
+			if !equal(x.args[i], y.args[i]) {
+				return false
+			}
+		}
+		return true
+	case funcCall:
+		y, ok := y.(funcCall)
+		return ok && x.f == y.f && equal(x.call, y.call)
+	case apply:
+		y, ok := y.(apply)
+		if !ok || x.def != y.def || len(x.args) != len(y.args) {
+			return false
+		}
+		for i := range x.args {
+			if !equal(x.args[i], y.args[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isConstant reports whether e has no variables, in which case, if
+// it was not folded, its value may not be finite.
+func isConstant(e Expr) bool {
+	vars := make(map[Var]bool)
+	e.Check(vars) // the errors don't matter here
+	return len(vars) == 0
+}
+
+func isFinite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
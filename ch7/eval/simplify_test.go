@@ -0,0 +1,102 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{"x", "x"},
+		{"1 + 2 * 3", "7"},
+		{"sqrt(16) + x", "(x + 4)"},
+		{"x * 1", "x"},
+		{"1 * x", "x"},
+		{"x + 0", "x"},
+		{"0 - x", "(-x)"},
+		{"x * 0", "0"},
+		{"x - x", "0"},
+		{"x / x", "(x / x)"}, // not 1: x may be 0
+		{"0 / x", "(0 / x)"},
+		{"x / 1", "x"},
+		{"pow(x, 1)", "x"},
+		{"pow(x + y, 0)", "1"},
+		{"pow(2, 10)", "1024"},
+		{"--x", "x"},
+		{"+x", "x"},
+		{"-(-x - y)", "(x + y)"},
+		{"x - -y", "(x + y)"},
+		{"-x + y", "(y - x)"},
+		{"-x / y", "(-(x / y))"},
+		{"(1 + x) + (2 + y) + 3", "((x + y) + 6)"},
+		{"x + x + x", "(3 * x)"},
+		{"2 * (3 * x) * 4", "(24 * x)"},
+		{"x * (y * z)", "((x * y) * z)"},
+		{"-2 * x * -3", "(6 * x)"},
+		{"sin(x) - sin(x) + cos(x)", "cos(x)"},
+		{"sqrt(-1)", "sqrt(-1)"}, // not folded: the result is NaN
+		{"1 / 0", "(1 / 0)"},     // not folded: the result is +Inf
+		{"0 / 0", "(0 / 0)"},
+		{"0 * (1 / 0)", "(0 * (1 / 0))"},
+		{"sqrt(-1) - sqrt(-1) + x", "(x + (0 * sqrt(-1)))"},
+		{"1e308 + 1e308", "(1e+308 + 1e+308)"},
+		{"1e308 * 10 * x", "(1e+308 * (10 * x))"},
+	}
+	env := Env{"x": 1.5, "y": -0.7, "z": 2.2}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		got := Simplify(expr)
+		if s := Format(got); s != test.want {
+			t.Errorf("Simplify(%s) = %s, want %s", test.expr, s, test.want)
+			continue
+		}
+		// The result must round-trip through Format and Parse
+		// and have the same value as the original.
+		again, err := Parse(Format(got))
+		if err != nil {
+			t.Errorf("Simplify(%s): can't parse %s: %v", test.expr, Format(got), err)
+			continue
+		}
+		x, y := expr.Eval(env), again.Eval(env)
+		if x != y && !(math.IsNaN(x) && math.IsNaN(y)) &&
+			math.Abs(x-y) > 1e-12*math.Abs(x) {
+			t.Errorf("Simplify(%s) = %s; Eval() = %g, want %g", test.expr, Format(got), y, x)
+		}
+	}
+}
+
+func TestSimplifyDerivative(t *testing.T) {
+	for _, test := range []struct {
+		expr, want string
+	}{
+		{"x * x", "(2 * x)"},
+		{"3 * x + 5", "3"},
+		{"pow(x, 3)", "(3 * pow(x, 2))"},
+		{"sin(x)", "cos(x)"},
+		{"sin(2 * x)", "(2 * cos((2 * x)))"},
+		{"x * y", "y"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		d, err := Derive(expr, "x")
+		if err != nil {
+			t.Errorf("Derive(%s): %v", test.expr, err)
+			continue
+		}
+		if got := Format(Simplify(d)); got != test.want {
+			t.Errorf("Simplify(Derive(%s)) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+)
+
+// contour writes an SVG image of the contour lines of the function,
+// seen from above, at levels evenly spaced between its least and
+// greatest heights on the canvas. The lines are found by marching
+// squares over a grid whose cells are 1/cells of the longer side of
+// the canvas, and colored like the heights of the surface. With the
+// labels parameter, each line long enough to bear one is labelled
+// with its height.
+func contour(w http.ResponseWriter, r *http.Request) {
+	v, _, f, ok := unpack(w, r)
+	if !ok {
+		return
+	}
+	g := newHeightGrid(newPlane(v), f)
+
+	bw := bufio.NewWriter(w)
+	w.Header().Set("Content-Type", "image/svg+xml")
+	fmt.Fprintf(bw, "<svg xmlns='http://www.w3.org/2000/svg' "+
+		"style='fill: none; stroke-width: 1' width='%d' height='%d'>\n", v.Width, v.Height)
+	for k := 1; k <= v.Levels && g.zmax > g.zmin; k++ {
+		level := g.zmin + (g.zmax-g.zmin)*float64(k)/float64(v.Levels+1)
+		c := heat(level, g.zmin, g.zmax)
+		fmt.Fprintf(bw, "<g stroke='#%02x%02x%02x'>\n", c.R, c.G, c.B)
+		var labels [][2]float64
+		for _, line := range g.contour(level) {
+			fmt.Fprint(bw, "<polyline points='")
+			for i, pt := range line {
+				if i > 0 {
+					bw.WriteByte(' ')
+				}
+				fmt.Fprintf(bw, "%.2f,%.2f", pt[0], pt[1])
+			}
+			fmt.Fprint(bw, "'/>\n")
+			if v.Labels && length(line) >= minLabelled {
+				labels = append(labels, line[len(line)/2])
+			}
+		}
+		// Draw the labels over the lines, each with a white outline
+		// so that it can be read where lines cross it.
+		for _, pt := range labels {
+			fmt.Fprintf(bw, "<text x='%.2f' y='%.2f' fill='#%02x%02x%02x' stroke='white' "+
+				"stroke-width='3' paint-order='stroke' font-size='10' "+
+				"text-anchor='middle' dominant-baseline='middle'>%.3g</text>\n",
+				pt[0], pt[1], c.R, c.G, c.B, level)
+		}
+		fmt.Fprintln(bw, "</g>")
+	}
+	fmt.Fprintln(bw, "</svg>")
+	bw.Flush() // NOTE: ignoring errors
+}
+
+// minLabelled is the length in pixels of the shortest labelled line.
+const minLabelled = 60
+
+// length returns the length of a polyline.
+func length(line [][2]float64) float64 {
+	total := 0.0
+	for i := 1; i < len(line); i++ {
+		total += math.Hypot(line[i][0]-line[i-1][0], line[i][1]-line[i-1][1])
+	}
+	return total
+}
+
+// A heightGrid holds the heights of a function at the points of a
+// square grid over the canvas of a plane.
+type heightGrid struct {
+	nx, ny     int       // number of points across and down
+	step       float64   // distance between points, in pixels
+	z          []float64 // height at point (i,j) is z[j*nx+i]
+	zmin, zmax float64   // least and greatest finite heights
+}
+
+func newHeightGrid(p *plane, f func(x, y float64) float64) *heightGrid {
+	// The step is taken from the longer side so that the grid has at
+	// most (cells+1)² points, however narrow the canvas.
+	g := &heightGrid{step: math.Max(float64(p.Width), float64(p.Height)) / float64(p.Cells)}
+	g.nx = int(math.Ceil(float64(p.Width)/g.step)) + 1
+	g.ny = int(math.Ceil(float64(p.Height)/g.step)) + 1
+	g.z = make([]float64, g.nx*g.ny)
+	g.zmin, g.zmax = math.Inf(+1), math.Inf(-1)
+	for j := 0; j < g.ny; j++ {
+		for i := 0; i < g.nx; i++ {
+			h := f(p.xy(float64(i)*g.step, float64(j)*g.step))
+			g.z[j*g.nx+i] = h
+			if !math.IsNaN(h) && !math.IsInf(h, 0) {
+				g.zmin = math.Min(g.zmin, h)
+				g.zmax = math.Max(g.zmax, h)
+			}
+		}
+	}
+	return g
+}
+
+// An edge joins point (i,j) of a grid to the next point across, or,
+// if down is set, to the next point down.
+type edge struct {
+	i, j int
+	down bool
+}
+
+// contour returns the lines along which the height equals level, as
+// polylines in canvas coordinates. Cells with a corner at which the
+// height is not finite are skipped.
+func (g *heightGrid) contour(level float64) [][][2]float64 {
+	// Find the segment or segments of line crossing each cell, by
+	// the edges of the cell that they cross.
+	var segments [][2]edge
+	for j := 0; j+1 < g.ny; j++ {
+		for i := 0; i+1 < g.nx; i++ {
+			// The corners, clockwise on the canvas from top left,
+			// and the edges that follow each of them.
+			corners := [4]float64{g.at(i, j), g.at(i+1, j), g.at(i+1, j+1), g.at(i, j+1)}
+			edges := [4]edge{{i, j, false}, {i + 1, j, true}, {i, j + 1, false}, {i, j, true}}
+			var crossed []edge
+			finite := true
+			for k, z := range corners {
+				finite = finite && !math.IsNaN(z) && !math.IsInf(z, 0)
+				if (z >= level) != (corners[(k+1)%4] >= level) {
+					crossed = append(crossed, edges[k])
+				}
+			}
+			switch {
+			case !finite:
+			case len(crossed) == 2:
+				segments = append(segments, [2]edge{crossed[0], crossed[1]})
+			case len(crossed) == 4:
+				// At a saddle, opposite corners are on the same
+				// side of the level. If the center is on their
+				// side too, they are joined through it, and the
+				// lines cut off the other two corners.
+				center := (corners[0] + corners[1] + corners[2] + corners[3]) / 4
+				if (center >= level) == (corners[0] >= level) {
+					segments = append(segments,
+						[2]edge{crossed[0], crossed[1]}, [2]edge{crossed[2], crossed[3]})
+				} else {
+					segments = append(segments,
+						[2]edge{crossed[3], crossed[0]}, [2]edge{crossed[1], crossed[2]})
+				}
+			}
+		}
+	}
+
+	// Join the segments that share an edge into lines. No more than
+	// two segments cross any edge, one from each cell beside it.
+	at := make(map[edge][]int)
+	for s, seg := range segments {
+		at[seg[0]] = append(at[seg[0]], s)
+		at[seg[1]] = append(at[seg[1]], s)
+	}
+	used := make([]bool, len(segments))
+	// extend adds to the end of line the segments that follow it.
+	extend := func(line []edge) []edge {
+		for {
+			end := line[len(line)-1]
+			next := -1
+			for _, s := range at[end] {
+				if !used[s] {
+					next = s
+				}
+			}
+			if next < 0 {
+				return line
+			}
+			used[next] = true
+			if seg := segments[next]; seg[0] == end {
+				line = append(line, seg[1])
+			} else {
+				line = append(line, seg[0])
+			}
+		}
+	}
+	var lines [][][2]float64
+	for s, seg := range segments {
+		if used[s] {
+			continue
+		}
+		used[s] = true
+		line := extend([]edge{seg[0], seg[1]})
+		// Extend the line from its other end too, unless it is closed.
+		for a, b := 0, len(line)-1; a < b; a, b = a+1, b-1 {
+			line[a], line[b] = line[b], line[a]
+		}
+		line = extend(line)
+
+		// Where the line passes through a point of the grid, the
+		// crossings of the edges that meet there coincide.
+		var points [][2]float64
+		for _, e := range line {
+			pt := g.crossing(e, level)
+			if len(points) == 0 || pt != points[len(points)-1] {
+				points = append(points, pt)
+			}
+		}
+		lines = append(lines, points)
+	}
+	return lines
+}
+
+// at returns the height at point (i,j).
+func (g *heightGrid) at(i, j int) float64 { return g.z[j*g.nx+i] }
+
+// crossing returns the canvas coordinates of the point along edge e
+// at which the height equals level, by linear interpolation.
+func (g *heightGrid) crossing(e edge, level float64) [2]float64 {
+	i1, j1 := e.i+1, e.j
+	if e.down {
+		i1, j1 = e.i, e.j+1
+	}
+	z0, z1 := g.at(e.i, e.j), g.at(i1, j1)
+	t := (level - z0) / (z1 - z0)
+	x := (float64(e.i) + t*float64(i1-e.i)) * g.step
+	y := (float64(e.j) + t*float64(j1-e.j)) * g.step
+	return [2]float64{x, y}
+}
@@ -0,0 +1,75 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestContour(t *testing.T) {
+	v := defaultView
+	v.Width, v.Height, v.Cells, v.XYRange = 200, 100, 50, 4
+	p := newPlane(v)
+
+	// The contour of a cone at height 1 is a circle of radius 1,
+	// which is 25 pixels on this canvas.
+	g := newHeightGrid(p, math.Hypot)
+	lines := g.contour(1)
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(lines))
+	}
+	line := lines[0]
+	if first, last := line[0], line[len(line)-1]; first != last {
+		t.Errorf("line from %v to %v is not closed", first, last)
+	}
+	for _, pt := range line {
+		if r := math.Hypot(pt[0]-100, pt[1]-50); math.Abs(r-25) > 0.1 {
+			t.Errorf("point %v is %g pixels from the center, want 25", pt, r)
+		}
+	}
+
+	// The saddle x*y has two lines at each level but 0, which
+	// crosses itself at the center.
+	g = newHeightGrid(p, func(x, y float64) float64 { return x * y })
+	for _, test := range []struct {
+		level float64
+		lines int
+	}{{-1, 2}, {0.5, 2}, {0, 2}} {
+		if got := len(g.contour(test.level)); got != test.lines {
+			t.Errorf("x*y = %g: got %d lines, want %d", test.level, got, test.lines)
+		}
+	}
+
+	// At a saddle, the lines cut off the corners on the other side
+	// of the level from the center.
+	g = &heightGrid{nx: 2, ny: 2, step: 10, z: []float64{1, 0, 0, 1}}
+	for _, test := range []struct {
+		level float64
+		want  [2][2]float64 // the first line, which cuts off a top corner
+	}{
+		{0.4, [2][2]float64{{10, 4}, {6, 0}}}, // top right, below the level
+		{0.6, [2][2]float64{{4, 0}, {0, 4}}},  // top left, above it
+	} {
+		lines := g.contour(test.level)
+		if len(lines) != 2 || len(lines[0]) != 2 || [2][2]float64{lines[0][0], lines[0][1]} != test.want {
+			t.Errorf("saddle at %g: got %v, want %v first", test.level, lines, test.want)
+		}
+	}
+
+	// The grid has at most cells+1 points along each side, however
+	// narrow the canvas.
+	v.Width, v.Height, v.Cells = 4096, 1, 500
+	g = newHeightGrid(newPlane(v), math.Hypot)
+	if g.nx > v.Cells+1 || g.ny > v.Cells+1 {
+		t.Errorf("4096×1 canvas: got %d×%d points, want at most %d each way", g.nx, g.ny, v.Cells+1)
+	}
+
+	// Cells with a corner at which the height is not finite are
+	// skipped, and so is the line that crosses them.
+	g = newHeightGrid(p, func(x, y float64) float64 { return 1 / x })
+	for _, line := range g.contour(0) {
+		t.Errorf("1/x = 0: unexpected line %v", line)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+)
+
+// A plane maps the x, y plane, seen from above, onto the canvas of a
+// view: the square of side xyrange centered on (0,0) fills the shorter
+// side of the canvas, x increases to the right and y upward.
+type plane struct {
+	view
+	scale float64 // pixels per x or y unit
+}
+
+func newPlane(v view) *plane {
+	side := math.Min(float64(v.Width), float64(v.Height))
+	return &plane{view: v, scale: side / v.XYRange}
+}
+
+// xy returns the point (x,y) at (sx,sy) on the canvas.
+func (p *plane) xy(sx, sy float64) (float64, float64) {
+	x := (sx - float64(p.Width)/2) / p.scale
+	y := (float64(p.Height)/2 - sy) / p.scale
+	return x, y
+}
+
+// heat returns the color for height z within [zmin, zmax], from blue
+// at the bottom to red at the top, as for the cells of the surface.
+func heat(z, zmin, zmax float64) color.RGBA {
+	t := 0.5
+	if zmax > zmin {
+		t = (z - zmin) / (zmax - zmin)
+	}
+	red := uint8(math.Round(255 * t))
+	return color.RGBA{red, 0, 255 - red, 255}
+}
+
+// maxHeatmapPixels bounds the size of a heat map, each pixel of which
+// costs an evaluation of the function.
+const maxHeatmapPixels = 2 << 20
+
+// heatmap writes a PNG image of the function seen from above, each
+// pixel colored by the height at its center. Pixels at which the
+// function is not finite are transparent. The canvas may have at most
+// maxHeatmapPixels pixels.
+func heatmap(w http.ResponseWriter, r *http.Request) {
+	v, _, f, ok := unpack(w, r)
+	if !ok {
+		return
+	}
+	if v.Width*v.Height > maxHeatmapPixels {
+		http.Error(w, fmt.Sprintf("%d×%d heat map has more than %d pixels",
+			v.Width, v.Height, maxHeatmapPixels), http.StatusBadRequest)
+		return
+	}
+	p := newPlane(v)
+
+	z := make([]float64, v.Width*v.Height)
+	zmin, zmax := math.Inf(+1), math.Inf(-1)
+	for py := 0; py < v.Height; py++ {
+		for px := 0; px < v.Width; px++ {
+			h := f(p.xy(float64(px)+0.5, float64(py)+0.5))
+			z[py*v.Width+px] = h
+			if !math.IsNaN(h) && !math.IsInf(h, 0) {
+				zmin = math.Min(zmin, h)
+				zmax = math.Max(zmax, h)
+			}
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, v.Width, v.Height))
+	for py := 0; py < v.Height; py++ {
+		for px := 0; px < v.Width; px++ {
+			if h := z[py*v.Width+px]; !math.IsNaN(h) && !math.IsInf(h, 0) {
+				img.SetRGBA(px, py, heat(h, zmin, zmax))
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, img) // NOTE: ignoring errors
+}
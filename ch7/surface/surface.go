@@ -4,14 +4,44 @@
 // See page 203.
 
 // The surface program plots the 3-D surface of a user-provided function.
+//
+// Optional query parameters set the size of the canvas (width and
+// height, in pixels), the number of cells in each direction of the
+// grid (cells), the range of x and y (xyrange), and the direction of
+// view, in degrees (azimuth, the rotation of the x, y plane, and
+// elevation, the angle above it). The zscale parameter sets the number
+// of pixels per unit of height, or, if it is "auto", scales the
+// surface to fit the canvas. For example:
+//
+//	/plot?expr=sin(x)*cos(y)&cells=50&azimuth=20&elevation=60&zscale=auto
+//
+// The format parameter, if not svg, requests the mesh of the whole
+// surface in the units of x, y and z for other 3-D programs: in
+// Wavefront OBJ (obj), ASCII or binary STL (stl, stl-binary) or PLY
+// (ply) format.
+//
+// Cells of the grid that cannot appear on the canvas are omitted, as
+// are those with a corner at which the function is not finite. The
+// others are drawn from back to front and colored by height, from
+// blue valleys to red peaks.
+//
+// The /heatmap handler draws the same function seen from above, as a
+// PNG image colored by height, and the /contour handler draws its
+// contour lines as SVG. Their levels parameter sets the number of
+// contour lines, and labels=false omits their labels.
+//
+// The /format handler writes the expression in the notation given by
+// the notation parameter: infix, latex, mathml, or go.
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
 	"math"
 	"net/http"
+	"strconv"
 )
 
 //!+parseAndCheck
@@ -19,93 +49,326 @@ import "gopl.io/ch7/eval"
 
 //!-parseAndCheck
 
-// -- copied from gopl.io/ch3/surface --
-
-const (
-	width, height = 600, 320            // canvas size in pixels
-	cells         = 100                 // number of grid cells
-	xyrange       = 30.0                // x, y axis range (-xyrange..+xyrange)
-	xyscale       = width / 2 / xyrange // pixels per x or y unit
-	zscale        = height * 0.4        // pixels per z unit
+import (
+	"gopl.io/ch12/params"
+	"gopl.io/ch3/surface/mesh"
 )
 
-var sin30, cos30 = 0.5, math.Sqrt(3.0 / 4.0) // sin(30°), cos(30°)
+// A view holds the parameters of a plot, each of which may be set by
+// the query parameter of the same name.
+type view struct {
+	Expr      string  `http:"expr"`
+	Width     int     `http:"width" min:"1" max:"4096"`     // canvas size in pixels
+	Height    int     `http:"height" min:"1" max:"4096"`    //
+	Cells     int     `http:"cells" min:"1" max:"500"`      // number of grid cells
+	XYRange   float64 `http:"xyrange" min:"1e-9" max:"1e9"` // x, y axis range (-xyrange/2..+xyrange/2)
+	ZScale    string  `http:"zscale"`                       // pixels per z unit, "auto", or "" for Height*0.4
+	Azimuth   float64 `http:"azimuth" min:"-360" max:"360"` // rotation of the x, y plane, in degrees
+	Elevation float64 `http:"elevation" min:"-90" max:"90"` // angle of view above the x, y plane, in degrees
+	Format    string  `http:"format"`                       // "svg", or one of mesh.Formats
+	Levels    int     `http:"levels" min:"1" max:"100"`     // number of contour lines
+	Labels    bool    `http:"labels"`                       // whether to label contour lines
+}
+
+// defaultView is the view of the original program: an isometric
+// projection, whose elevation of about 35.26° makes the x and y axes
+// 30° from the horizontal.
+var defaultView = view{
+	Width:     600,
+	Height:    320,
+	Cells:     100,
+	XYRange:   30,
+	Azimuth:   45,
+	Elevation: math.Asin(math.Tan(math.Pi/6)) * 180 / math.Pi,
+	Format:    "svg",
+	Levels:    10,
+	Labels:    true,
+}
+
+// A camera projects the points of a view onto its canvas.
+type camera struct {
+	view
+	xyscale      float64 // pixels per x or y unit
+	zscale       float64 // pixels per z unit
+	sinAz, cosAz float64
+	sinEl, cosEl float64
+}
+
+func newCamera(v view) *camera {
+	c := &camera{view: v}
+	c.sinAz, c.cosAz = math.Sincos(v.Azimuth * math.Pi / 180)
+	c.sinEl, c.cosEl = math.Sincos(v.Elevation * math.Pi / 180)
+	// Scale x and y so that the grid, whose projection is widest
+	// when seen from a corner, spans as much of the canvas at every
+	// azimuth as it does in the isometric view.
+	spread := math.Abs(c.sinAz) + math.Abs(c.cosAz)
+	c.xyscale = float64(v.Width) / v.XYRange * math.Sqrt(3.0/4.0) / spread
+	c.zscale = c.defaultZScale()
+	return c
+}
+
+func (c *camera) defaultZScale() float64 { return float64(c.Height) * 0.4 }
 
-func corner(f func(x, y float64) float64, i, j int) (float64, float64) {
-	// find point (x,y) at corner of cell (i,j)
-	x := xyrange * (float64(i)/cells - 0.5)
-	y := xyrange * (float64(j)/cells - 0.5)
+// xy returns the point (x,y) at corner (i,j) of the grid.
+func (c *camera) xy(i, j int) (float64, float64) {
+	x := c.XYRange * (float64(i)/float64(c.Cells) - 0.5)
+	y := c.XYRange * (float64(j)/float64(c.Cells) - 0.5)
+	return x, y
+}
 
-	z := f(x, y) // compute surface height z
+// project returns the position (sx,sy) on the canvas of the point
+// (x,y,z), and how near it is to the viewer, in arbitrary units.
+func (c *camera) project(x, y, z float64) (sx, sy, near float64) {
+	// Rotate the x, y plane by the azimuth, so that u is across
+	// the canvas and v is toward the viewer, then tilt it toward
+	// the viewer by the elevation.
+	u := x*c.cosAz - y*c.sinAz
+	v := x*c.sinAz + y*c.cosAz
+	sx = float64(c.Width)/2 + u*c.xyscale
+	sy = float64(c.Height)/2 + v*c.sinEl*c.xyscale - z*c.zscale
+	near = v*c.cosEl*c.cosEl*c.xyscale + z*c.zscale*c.sinEl
+	return sx, sy, near
+}
 
-	// project (x,y,z) isometrically onto 2-D SVG canvas (sx,sy)
-	sx := width/2 + (x-y)*cos30*xyscale
-	sy := height/2 + (x+y)*sin30*xyscale - z*zscale
-	return sx, sy
+// vertex projects a vertex of the mesh onto the canvas.
+func (c *camera) vertex(v mesh.Vertex) (sx, sy, near float64) {
+	return c.project(v.X, v.Y, v.Z)
 }
 
-func surface(w io.Writer, f func(x, y float64) float64) {
-	fmt.Fprintf(w, "<svg xmlns='http://www.w3.org/2000/svg' "+
-		"style='stroke: grey; fill: white; stroke-width: 0.7' "+
-		"width='%d' height='%d'>", width, height)
-	for i := 0; i < cells; i++ {
-		for j := 0; j < cells; j++ {
-			ax, ay := corner(f, i+1, j)
-			bx, by := corner(f, i, j)
-			cx, cy := corner(f, i, j+1)
-			dx, dy := corner(f, i+1, j+1)
-			fmt.Fprintf(w, "<polygon points='%g,%g %g,%g %g,%g %g,%g'/>\n",
-				ax, ay, bx, by, cx, cy, dx, dy)
+// visible reports whether any part of cell (i,j) may appear on the
+// canvas when its height is within z. A cell over which the surface
+// is nowhere defined is not visible.
+func (c *camera) visible(i, j int, z eval.Interval) bool {
+	if z.IsEmpty() {
+		return false
+	}
+	// Find the range of sy over the corners of the cell at the
+	// lowest and highest heights.
+	top, bottom := math.Inf(+1), math.Inf(-1)
+	for _, ij := range [4][2]int{{i, j}, {i + 1, j}, {i, j + 1}, {i + 1, j + 1}} {
+		x, y := c.xy(ij[0], ij[1])
+		for _, h := range [2]float64{z.Lo, z.Hi} {
+			if _, sy, _ := c.project(x, y, h); !math.IsNaN(sy) {
+				top = math.Min(top, sy)
+				bottom = math.Max(bottom, sy)
+			}
 		}
 	}
-	fmt.Fprintln(w, "</svg>")
+	return bottom >= -1 && top <= float64(c.Height)+1 // allow for stroke width
 }
 
-// -- main code for gopl.io/ch7/surface --
-
 //!+parseAndCheck
 func parseAndCheck(s string) (eval.Expr, error) {
 	if s == "" {
 		return nil, fmt.Errorf("empty expression")
 	}
-	expr, err := eval.Parse(s)
+	vars := map[eval.Var]bool{"x": true, "y": true, "r": true}
+	return eval.Validate(s, nil, vars)
+}
+
+//!-parseAndCheck
+
+//!+plot
+func plot(w http.ResponseWriter, r *http.Request) {
+	v, expr, f, ok := unpack(w, r)
+	if !ok {
+		return
+	}
+
+	if v.Format != "svg" {
+		out, ok := mesh.Formats[v.Format]
+		if !ok {
+			http.Error(w, "unknown format "+v.Format, http.StatusBadRequest)
+			return
+		}
+		// A model is of the whole surface, whatever the view.
+		w.Header().Set("Content-Type", out.ContentType)
+		w.Header().Set("Content-Disposition", "attachment; filename=surface"+out.Ext)
+		if err := out.Write(mesh.Grid(f, v.XYRange, v.Cells, nil), w); err != nil {
+			log.Print(err)
+		}
+		return
+	}
+
+	c := newCamera(v)
+
+	// Bound the height of the surface over each cell.
+	cellBounds := make([][]eval.Interval, c.Cells)
+	for i := range cellBounds {
+		cellBounds[i] = make([]eval.Interval, c.Cells)
+		for j := range cellBounds[i] {
+			x0, y0 := c.xy(i, j)
+			x1, y1 := c.xy(i+1, j+1)
+			cellBounds[i][j] = expr.EvalInterval(eval.IntervalEnv{
+				"x": {Lo: x0, Hi: x1},
+				"y": {Lo: y0, Hi: y1},
+				"r": distance(x0, x1, y0, y1),
+			})
+		}
+	}
+
+	switch v.ZScale {
+	case "":
+	case "auto":
+		c.zscale = c.fitZScale(cellBounds)
+	default:
+		var err error
+		c.zscale, err = strconv.ParseFloat(v.ZScale, 64)
+		if err == nil && (c.zscale == 0 || math.IsInf(c.zscale, 0) || math.IsNaN(c.zscale)) {
+			err = fmt.Errorf("%s is not a nonzero number", v.ZScale)
+		}
+		if err != nil {
+			http.Error(w, "bad zscale: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Omit the cells of the grid that cannot be seen: those whose
+	// heights would all be above or below the canvas.
+	visible := func(i, j int) bool { return c.visible(i, j, cellBounds[i][j]) }
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	m := mesh.Grid(f, v.XYRange, v.Cells, visible)
+	m.WriteSVG(w, v.Width, v.Height, c.vertex) // NOTE: ignoring errors
+}
+
+// unpack returns the view requested by r, the expression to plot, and
+// a function that computes it from x and y. If the request is bad, it
+// replies with the error instead, and returns ok=false.
+func unpack(w http.ResponseWriter, r *http.Request) (v view, expr eval.Expr,
+	f func(x, y float64) float64, ok bool) {
+	v = defaultView
+	if err := params.Unpack(r, &v); err != nil {
+		http.Error(w, "bad query: "+err.Error(), http.StatusBadRequest)
+		return v, nil, nil, false
+	}
+	expr, err := parseAndCheck(v.Expr)
+	if err != nil {
+		// Show the user where each mistake is in the formula.
+		var buf bytes.Buffer
+		buf.WriteString("bad expr:\n")
+		eval.PrintError(&buf, v.Expr, err)
+		http.Error(w, buf.String(), http.StatusBadRequest)
+		return v, nil, nil, false
+	}
+	// Compile the expression once so that each of the many
+	// evaluations reads x, y and r from fixed slots.
+	prog, err := eval.Compile(expr, []eval.Var{"x", "y", "r"})
 	if err != nil {
-		return nil, err
+		http.Error(w, "bad expr: "+err.Error(), http.StatusBadRequest)
+		return v, nil, nil, false
 	}
-	vars := make(map[eval.Var]bool)
-	if err := expr.Check(vars); err != nil {
-		return nil, err
+	var vm eval.VM
+	vals := make([]float64, 3)
+	f = func(x, y float64) float64 {
+		r := math.Hypot(x, y) // distance from (0,0)
+		vals[0], vals[1], vals[2] = x, y, r
+		return vm.Run(prog, vals)
+	}
+	return v, expr, f, true
+}
+
+// distance returns bounds on the distance from (0,0)
+// of the points in the box [x0, x1] × [y0, y1].
+func distance(x0, x1, y0, y1 float64) eval.Interval {
+	near := func(lo, hi float64) float64 {
+		return math.Max(0, math.Max(lo, -hi))
+	}
+	far := func(lo, hi float64) float64 {
+		return math.Max(-lo, hi)
 	}
-	for v := range vars {
-		if v != "x" && v != "y" && v != "r" {
-			return nil, fmt.Errorf("undefined variable: %s", v)
+	// Allow for the rounding errors of math.Hypot.
+	const eps = 1e-15
+	return eval.Interval{
+		Lo: math.Hypot(near(x0, x1), near(y0, y1)) * (1 - eps),
+		Hi: math.Hypot(far(x0, x1), far(y0, y1)) * (1 + eps),
+	}
+}
+
+// fitZScale returns the zscale at which the heights of the surface,
+// within the bounds on each cell, span at most the same part of the
+// canvas as heights from -1 to 1 do at the default zscale. Bounds that
+// are not finite, such as near a pole, are disregarded.
+func (c *camera) fitZScale(bounds [][]eval.Interval) float64 {
+	zmax := 0.0
+	for _, row := range bounds {
+		for _, z := range row {
+			if z.IsEmpty() {
+				continue
+			}
+			for _, h := range [2]float64{z.Lo, z.Hi} {
+				if !math.IsInf(h, 0) {
+					zmax = math.Max(zmax, math.Abs(h))
+				}
+			}
 		}
 	}
-	return expr, nil
+	if zmax == 0 {
+		return c.defaultZScale()
+	}
+	return c.defaultZScale() / zmax
 }
 
-//!-parseAndCheck
+//!-plot
 
-//!+plot
-func plot(w http.ResponseWriter, r *http.Request) {
+// format writes the expression in the notation named by the notation
+// parameter, by default infix, for use in reports or programs.
+// In Go, it is a func(x, y float64) float64 that computes r itself,
+// or, if the expression defines names that prevent that, a
+// func(x, y, r float64) float64.
+func format(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
-	expr, err := parseAndCheck(r.Form.Get("expr"))
+	input := r.Form.Get("expr")
+	expr, err := parseAndCheck(input)
+	if err != nil {
+		var buf bytes.Buffer
+		buf.WriteString("bad expr:\n")
+		eval.PrintError(&buf, input, err)
+		http.Error(w, buf.String(), http.StatusBadRequest)
+		return
+	}
+	name := r.Form.Get("notation")
+	if name == "" {
+		name = "infix"
+	}
+	notation, ok := eval.Notations[name]
+	if !ok {
+		http.Error(w, "unknown notation "+name, http.StatusBadRequest)
+		return
+	}
+	if name == "go" {
+		notation = eval.GoFunc{Params: []eval.Var{"x", "y"}}
+		if free := make(map[eval.Var]bool); expr.Check(free) == nil && free["r"] {
+			// Define r before the input, unless the input's own
+			// names get in the way, in which case r is a parameter.
+			withR, err := eval.Parse("r = hypot(x, y); " + input)
+			free := make(map[eval.Var]bool)
+			if err == nil && withR.Check(free) == nil && !free["r"] {
+				expr = withR
+			} else {
+				notation = eval.GoFunc{Params: []eval.Var{"x", "y", "r"}}
+			}
+		}
+	}
+	text, err := eval.FormatAs(expr, notation)
 	if err != nil {
 		http.Error(w, "bad expr: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "image/svg+xml")
-	surface(w, func(x, y float64) float64 {
-		r := math.Hypot(x, y) // distance from (0,0)
-		return expr.Eval(eval.Env{"x": x, "y": y, "r": r})
-	})
+	if name == "mathml" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	io.WriteString(w, text)
 }
 
-//!-plot
-
 //!+main
 func main() {
 	http.HandleFunc("/plot", plot)
+	http.HandleFunc("/heatmap", heatmap)
+	http.HandleFunc("/contour", contour)
+	http.HandleFunc("/format", format)
 	log.Fatal(http.ListenAndServe("localhost:8000", nil))
 }
 
@@ -2,4 +2,7 @@ module gopl.io
 
 go 1.16
 
-require golang.org/x/net v0.0.0-20210929193557-e81a3d93ecf6
+require (
+	golang.org/x/net v0.0.0-20210929193557-e81a3d93ecf6
+	golang.org/x/text v0.3.6
+)